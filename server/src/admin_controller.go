@@ -0,0 +1,499 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"./dbcontroller"
+	"./model"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// System bot which becomes the author of the messages of deleted users
+const (
+	deletedUserUsername = "deleted_user"
+	deletedUserFullName = "Deleted user"
+)
+
+type AdminChat struct {
+	model.Chat
+	MemberIDs    []string `json:"memberIds"`
+	MessageCount int64    `json:"messageCount"`
+}
+
+type ServerStats struct {
+	Users            int64 `json:"users"`
+	Chats            int64 `json:"chats"`
+	Messages         int64 `json:"messages"`
+	ActiveUsers      int   `json:"activeUsers"`
+	ConnectedSockets int   `json:"connectedSockets"`
+}
+
+type RoleData struct {
+	Role string `json:"role"`
+}
+
+func (c *apiController) adminListUsers(w http.ResponseWriter, r *http.Request) {
+	users := []model.User{}
+	err := c.store.UserRepo.List(&users)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, users)
+}
+
+func (c *apiController) adminUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	currentUserID := contextUserID(r)
+
+	data := RoleData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	if data.Role != model.UserRoleUser && data.Role != model.UserRoleAdmin {
+		c.writeValidationErrorResponse(w, r, validationErrors{
+			{Field: "role", Code: FieldErrInvalid, Message: "Role is not valid"},
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	if vars["userID"] == "" {
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if vars["userID"] == currentUserID {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Admins can't apply this action to themselves")
+		return
+	}
+
+	user, ok := c.adminGetUser(w, r, vars["userID"])
+	if !ok {
+		return
+	}
+
+	err = c.store.UserRepo.UpdateRole(user.ID, data.Role)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.wsHub.invalidateTokens(user.ID)
+
+	user.Role = data.Role
+
+	c.writeResponse(w, http.StatusOK, user)
+}
+
+func (c *apiController) adminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	currentUserID := contextUserID(r)
+
+	vars := mux.Vars(r)
+	if vars["userID"] == "" {
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if vars["userID"] == currentUserID {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Admins can't apply this action to themselves")
+		return
+	}
+
+	user, ok := c.adminGetUser(w, r, vars["userID"])
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	err := c.store.UserRepo.UpdateSuspendedAt(user.ID, &now)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	err = c.forceLogout(user.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	user.SuspendedAt = &now
+
+	c.writeResponse(w, http.StatusOK, user)
+}
+
+func (c *apiController) adminUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["userID"] == "" {
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := c.adminGetUser(w, r, vars["userID"])
+	if !ok {
+		return
+	}
+
+	err := c.store.UserRepo.UpdateSuspendedAt(user.ID, nil)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	user.SuspendedAt = nil
+
+	c.writeResponse(w, http.StatusOK, user)
+}
+
+func (c *apiController) adminLogoutUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["userID"] == "" {
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user, ok := c.adminGetUser(w, r, vars["userID"])
+	if !ok {
+		return
+	}
+
+	err := c.forceLogout(user.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *apiController) adminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	currentUserID := contextUserID(r)
+
+	vars := mux.Vars(r)
+	if vars["userID"] == "" {
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if vars["userID"] == currentUserID {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Admins can't apply this action to themselves")
+		return
+	}
+
+	if c.isSystemUser(vars["userID"]) {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "System users can't be deleted")
+		return
+	}
+
+	user, ok := c.adminGetUser(w, r, vars["userID"])
+	if !ok {
+		return
+	}
+
+	err := c.deleteUser(user.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// userDeletion collects the chats changed by deleting users, their members are notified
+// after the transaction is committed
+type userDeletion struct {
+	userIDs      []string
+	deletedChats []deletedChat
+	updatedChats []model.Chat
+}
+
+type deletedChat struct {
+	chat      model.Chat
+	memberIDs []string
+}
+
+// deleteUser removes the user together with the bots of the user in a single transaction. Their messages
+// are kept and reassigned to the deleted user placeholder. Their direct chats are removed, the chats
+// they created are handed over to the oldest members or removed when no other members are left.
+func (c *apiController) deleteUser(userID string) error {
+	if c.deletedUser == nil {
+		return fmt.Errorf("Deleted user placeholder is not available")
+	}
+
+	bots := []model.User{}
+	err := c.store.UserRepo.ListBotsByOwnerID(userID, &bots)
+	if err != nil {
+		return err
+	}
+
+	d := &userDeletion{}
+	d.userIDs = append(d.userIDs, userID)
+	for i := range bots {
+		d.userIDs = append(d.userIDs, bots[i].ID)
+	}
+
+	err = c.store.Transaction(func(tx *dbcontroller.Store) error {
+		for _, id := range d.userIDs {
+			err := c.deleteUserData(tx, id, d)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range d.userIDs {
+		c.wsHub.invalidateTokens(id)
+		c.wsHub.disconnectUser(id)
+	}
+
+	for i := range d.deletedChats {
+		c.broadcastChatChangeTo(d.deletedChats[i].memberIDs, &d.deletedChats[i].chat, WSTypeChatDelete)
+	}
+
+	for i := range d.updatedChats {
+		c.broadcastChatChange(&d.updatedChats[i], WSTypeChatUpdate)
+	}
+
+	for _, id := range d.userIDs {
+		c.broadcastUserChange(id, WSTypeUserDelete)
+	}
+
+	return nil
+}
+
+func (c *apiController) deleteUserData(tx *dbcontroller.Store, userID string, d *userDeletion) error {
+	chats := []model.Chat{}
+	err := tx.ChatRepo.ListByCreatorOrDirectUserID(userID, &chats)
+	if err != nil {
+		return err
+	}
+
+	for i := range chats {
+		chat := chats[i]
+
+		if chat.DirectUserID == "" {
+			successor := model.ChatUser{}
+			err = tx.ChatUserRepo.GetOldestMember(chat.ID, userID, &successor)
+			if err == nil {
+				err = tx.ChatRepo.UpdateCreatorID(chat.ID, successor.UserID)
+				if err != nil {
+					return err
+				}
+
+				chat.CreatorID = successor.UserID
+				d.updatedChats = append(d.updatedChats, chat)
+				continue
+			} else if !gorm.IsRecordNotFoundError(err) {
+				return err
+			}
+		}
+
+		chatUsers := []model.ChatUser{}
+		err = tx.ChatUserRepo.ListByChatID(chat.ID, &chatUsers)
+		if err != nil {
+			return err
+		}
+
+		memberIDs := []string{}
+		for j := range chatUsers {
+			if chatUsers[j].UserID != userID {
+				memberIDs = append(memberIDs, chatUsers[j].UserID)
+			}
+		}
+
+		err = deleteChatData(tx, chat.ID)
+		if err != nil {
+			return err
+		}
+
+		d.deletedChats = append(d.deletedChats, deletedChat{chat: chat, memberIDs: memberIDs})
+	}
+
+	err = tx.MessageRepo.ReassignUserID(userID, c.deletedUser.ID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.TokenRepo.DeleteByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.ChatUserRepo.DeleteByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.UserRepo.DeleteAvatar(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.PushSubscriptionRepo.DeleteByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.APITokenRepo.DeleteByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.BotCommandRepo.DeleteByBotUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.IncomingWebhookRepo.DeleteByBotUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.MessageMentionRepo.DeleteByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.ScheduledMessageRepo.DeleteByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.ChatInviteRepo.DeleteByCreatorID(userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.UserRepo.Delete(userID)
+}
+
+// isSystemUser tells whether the user is one of the bots which the server relies on
+func (c *apiController) isSystemUser(userID string) bool {
+	return (c.reminderBot != nil && c.reminderBot.ID == userID) || (c.deletedUser != nil && c.deletedUser.ID == userID)
+}
+
+func (c *apiController) adminGetChat(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["chatID"] == "" {
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
+		return
+	}
+
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(vars["chatID"], &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	chatUsers := []model.ChatUser{}
+	err = c.store.ChatUserRepo.ListByChatID(chat.ID, &chatUsers)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	messageCount, err := c.store.MessageRepo.CountByChatID(chat.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
+		return
+	}
+
+	result := AdminChat{
+		Chat:         chat,
+		MemberIDs:    make([]string, len(chatUsers)),
+		MessageCount: messageCount,
+	}
+	for i := range chatUsers {
+		result.MemberIDs[i] = chatUsers[i].UserID
+	}
+
+	c.writeResponse(w, http.StatusOK, result)
+}
+
+func (c *apiController) adminGetStats(w http.ResponseWriter, r *http.Request) {
+	var err error
+	stats := ServerStats{}
+
+	stats.Users, err = c.store.UserRepo.Count()
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	stats.Chats, err = c.store.ChatRepo.Count()
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	stats.Messages, err = c.store.MessageRepo.Count()
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
+		return
+	}
+
+	stats.ActiveUsers = len(c.wsHub.listActiveUserIDs())
+	stats.ConnectedSockets = c.wsHub.countConnections()
+
+	c.writeResponse(w, http.StatusOK, stats)
+}
+
+// adminGetUser loads the user and writes the matching error response if it fails
+func (c *apiController) adminGetUser(w http.ResponseWriter, r *http.Request, userID string) (*model.User, bool) {
+	user := model.User{}
+	err := c.store.UserRepo.Get(userID, &user)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// forceLogout invalidates all access tokens of the user and closes its WebSocket connections
+func (c *apiController) forceLogout(userID string) error {
+	err := c.store.TokenRepo.DeleteByUserID(userID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	c.wsHub.invalidateTokens(userID)
+	c.wsHub.disconnectUser(userID)
+
+	return nil
+}
+
+// promoteAdmins grants the admin role to the users with the given usernames
+func promoteAdmins(store *dbcontroller.Store, usernames []string) {
+	for _, username := range usernames {
+		user, err := store.UserRepo.GetByUsername(username)
+		if err != nil {
+			log.Printf("Failed to promote %s to admin: %+v\n", username, err)
+			continue
+		}
+
+		if user.IsAdmin() {
+			continue
+		}
+
+		err = store.UserRepo.UpdateRole(user.ID, model.UserRoleAdmin)
+		if err != nil {
+			log.Printf("Failed to promote %s to admin: %+v\n", username, err)
+		}
+	}
+}
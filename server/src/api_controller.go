@@ -8,24 +8,19 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"./dbcontroller"
+	"./markup"
 	"./model"
+	"./webpush"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/jinzhu/gorm"
 )
 
-// Default error response messages
-const (
-	IntServErr      = "Internal Server Error"
-	BadRequestErr   = "Bad Request"
-	NotFoundErr     = "Not Found"
-	UnauthorizedErr = "Unauthorized"
-	ForbiddenErr    = "Forbidden"
-)
-
 // WebSocket messages types
 const (
 	WSTypeMessageCreate = "message_create"
@@ -41,15 +36,58 @@ const (
 	WSTypeUserDelete       = "user_delete"
 	WSTypeUserAvatarUpdate = "user_avatar_update"
 	WSTypeUserStatusChange = "user_status_change"
+
+	WSTypeResyncRequired = "resync_required"
+
+	// Responses of slash commands, sent only to the user who invoked the command
+	WSTypeEphemeral = "ephemeral"
+
+	WSTypeMention = "mention"
 )
 
 const MAX_BLOB_SIZE = 1024 * 1024 * 15
 
+// List pagination limits
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
 var PERMITTED_AVATAR_CONTENT_TYPES = []string{"image/jpeg", "image/png"}
 
 type apiController struct {
-	store *dbcontroller.Store
-	wsHub *WSHub
+	store      *dbcontroller.Store
+	wsHub      *WSHub
+	tokenCache *TokenCache
+
+	// CORS allowlist, also used to validate the origin of WebSocket requests
+	allowedOrigins []string
+
+	pushDispatcher    *PushDispatcher
+	vapidKeys         *webpush.VAPIDKeys
+	allowInsecurePush bool
+
+	// Public URL of the server, used for links sent outside of the API
+	publicURL string
+
+	digestSender      *DigestSender
+	webhookDispatcher *WebhookDispatcher
+
+	// Client of the callbacks of bot commands
+	commandClient *http.Client
+
+	// Callbacks of bot commands may be registered on loopback and private network addresses
+	allowPrivateCommandCallbacks bool
+
+	linkPreviewer *LinkPreviewer
+
+	// System bot which sends the reminders, nil when it is not available
+	reminderBot *model.User
+
+	// System bot which becomes the author of the messages of deleted users
+	deletedUser *model.User
+
+	retentionSweeper *RetentionSweeper
 }
 
 type UserWithToken struct {
@@ -58,19 +96,19 @@ type UserWithToken struct {
 	AccessTokenExpiresAt *time.Time `json:"accessTokenExpiresAt"`
 }
 
-type ErrorMessage struct {
-	Message string `json:"error"`
-}
-
+// WebSocket events carry the ids of the changed entities. Connections which negotiated
+// the full payload mode also receive the entities themselves, except for delete events.
 type WSMessageData struct {
-	Type      string `json:"type"`
-	ChatID    string `json:"chatId"`
-	MessageID string `json:"messageId"`
+	Type      string         `json:"type"`
+	ChatID    string         `json:"chatId"`
+	MessageID string         `json:"messageId"`
+	Message   *model.Message `json:"message,omitempty"`
 }
 
 type WSUserData struct {
-	Type   string `json:"type"`
-	UserID string `json:"userId"`
+	Type   string            `json:"type"`
+	UserID string            `json:"userId"`
+	User   *model.PublicUser `json:"user,omitempty"`
 }
 
 type UserStatus struct {
@@ -79,8 +117,9 @@ type UserStatus struct {
 }
 
 type WSChatData struct {
-	Type   string `json:"type"`
-	ChatID string `json:"chatId"`
+	Type   string      `json:"type"`
+	ChatID string      `json:"chatId"`
+	Chat   *model.Chat `json:"chat,omitempty"`
 }
 
 func (c *apiController) readData(data io.Reader, result interface{}) error {
@@ -91,47 +130,80 @@ func (c *apiController) writeResponse(w http.ResponseWriter, statusCode int, dat
 	writeJSONResponse(w, statusCode, data)
 }
 
-func (c *apiController) writeDefaultErrorResponse(w http.ResponseWriter, statusCode int) {
-	var data interface{}
-
-	switch statusCode {
-	case http.StatusBadRequest:
-		data = ErrorMessage{BadRequestErr}
-		break
-	case http.StatusUnauthorized:
-		data = ErrorMessage{UnauthorizedErr}
-		break
-	case http.StatusForbidden:
-		data = ErrorMessage{ForbiddenErr}
-		break
-	case http.StatusNotFound:
-		data = ErrorMessage{NotFoundErr}
-		break
-	case http.StatusInternalServerError:
-		data = ErrorMessage{IntServErr}
-		break
-	default:
-		data = nil
+func (c *apiController) wsHandler(w http.ResponseWriter, r *http.Request) {
+	protocol, frameMode, accessToken, err := negotiateWSProtocol(websocket.Subprotocols(r))
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	token, _, err := c.authenticateWSRequest(r, accessToken)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, err.Error())
+		return
 	}
 
-	writeJSONResponse(w, statusCode, data)
-}
+	if !token.HasScope(model.ScopeChatsRead) {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "API token doesn't grant the "+model.ScopeChatsRead+" scope")
+		return
+	}
 
-func (c *apiController) wsHandler(w http.ResponseWriter, r *http.Request) {
-	protocol := r.Header.Get("Sec-WebSocket-Protocol")
-	arr := strings.Split(protocol, ", ")
-	if len(arr) != 2 || arr[0] != "access_token" {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
+	// Reconnecting clients pass the sequence number of the last received event
+	// to replay the events they missed
+	errs := validationErrors{}
+	resume := false
+	resumeSince := int64(0)
+	if value := r.URL.Query().Get("since"); value != "" {
+		resumeSince, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || resumeSince < 0 {
+			errs.add("since", FieldErrInvalid, "Since must be a non-negative sequence number")
+		}
+		resume = true
+	}
+
+	fullPayload := parsePayloadMode(r, &errs)
+
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
+		return
+	}
+
+	lastSeq, err := c.store.EventRepo.LastSeq()
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
 		return
 	}
 
-	token, err := c.validateAccessToken(arr[1])
+	hello := &WSHelloData{
+		Type:              WSTypeHello,
+		ServerVersion:     serverVersion,
+		Protocol:          protocol,
+		FrameMode:         frameMode,
+		PayloadMode:       payloadModeIDs,
+		HeartbeatInterval: int64(pingPeriod / time.Millisecond),
+		Session: WSSession{
+			ConnectionID:         generateRequestID(),
+			UserID:               token.UserID,
+			AccessTokenExpiresAt: token.ExpiresAt,
+		},
+		LastSeq: lastSeq,
+	}
+	if fullPayload {
+		hello.PayloadMode = payloadModeFull
+	}
+
+	helloData, err := json.Marshal(hello)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
+		c.writeDefaultErrorResponse(w, r, http.StatusInternalServerError)
 		return
 	}
 
-	conn, err := c.wsHub.upgrader.Upgrade(w, r, nil)
+	responseHeader := http.Header{}
+	if protocol != "" {
+		responseHeader.Set("Sec-WebSocket-Protocol", protocol)
+	}
+
+	conn, err := c.wsHub.upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		log.Println(err)
 		return
@@ -139,15 +211,21 @@ func (c *apiController) wsHandler(w http.ResponseWriter, r *http.Request) {
 	client := &WsClient{
 		hub:         c.wsHub,
 		conn:        conn,
-		send:        make(chan []byte, 256),
+		send:        make(chan *wsFrame, 256),
+		hello:       helloData,
 		userID:      token.UserID,
 		accessToken: token,
+		frameMode:   frameMode,
+		fullPayload: fullPayload,
+		resume:      resume,
+		resumeSince: resumeSince,
 	}
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
 	go client.writePump()
+	go client.readPump()
 }
 
 func (c *apiController) register(w http.ResponseWriter, r *http.Request) {
@@ -157,8 +235,7 @@ func (c *apiController) register(w http.ResponseWriter, r *http.Request) {
 	user := model.User{}
 	err := c.readData(r.Body, &user)
 	if err != nil {
-		log.Println(err)
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
 		return
 	}
 
@@ -166,15 +243,32 @@ func (c *apiController) register(w http.ResponseWriter, r *http.Request) {
 
 	// Validate user
 	{
+		errs := validationErrors{}
+
 		nameLen := len(user.Username)
-		if nameLen < 4 || nameLen >= 256 || !usernameRe.MatchString(user.Username) {
-			c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Username is not valid"})
-			return
+		if nameLen == 0 {
+			errs.add("username", FieldErrRequired, "Username is required")
+		} else if nameLen < 4 {
+			errs.add("username", FieldErrTooShort, "Username must be at least 4 characters long")
+		} else if nameLen >= 256 {
+			errs.add("username", FieldErrTooLong, "Username must be less than 256 characters long")
+		} else if !usernameRe.MatchString(user.Username) {
+			errs.add("username", FieldErrInvalid, "Username may contain only letters, digits, '_' and '-'")
 		}
 
 		passLen := len(user.Password)
-		if passLen < 6 || passLen >= 256 || !passwordRe.MatchString(user.Password) {
-			c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Password is not valid"})
+		if passLen == 0 {
+			errs.add("password", FieldErrRequired, "Password is required")
+		} else if passLen < 6 {
+			errs.add("password", FieldErrTooShort, "Password must be at least 6 characters long")
+		} else if passLen >= 256 {
+			errs.add("password", FieldErrTooLong, "Password must be less than 256 characters long")
+		} else if !passwordRe.MatchString(user.Password) {
+			errs.add("password", FieldErrInvalid, "Password may contain only letters, digits, '_' and '-'")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
 			return
 		}
 	}
@@ -182,23 +276,30 @@ func (c *apiController) register(w http.ResponseWriter, r *http.Request) {
 	// check if already registered
 	exists, err := c.store.UserRepo.ExistsUsername(user.Username)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
 		return
 	} else if exists {
-		c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Already Registered"})
+		writeJSONResponse(w, http.StatusConflict, &APIError{
+			Code:    ErrCodeConflict,
+			Message: "Username is already registered",
+			Details: []FieldError{
+				{Field: "username", Code: FieldErrTaken, Message: "Username is already registered"},
+			},
+			RequestID: contextRequestID(r),
+		})
 		return
 	}
 
 	err = c.store.UserRepo.Create(&user)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
 	token := model.AccessToken{UserID: user.ID}
 	err = c.store.TokenRepo.Create(&token)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
 		return
 	}
 
@@ -208,6 +309,8 @@ func (c *apiController) register(w http.ResponseWriter, r *http.Request) {
 		AccessTokenExpiresAt: token.ExpiresAt,
 	}
 
+	setAccessTokenCookie(w, r, &token)
+
 	c.broadcastUserChange(user.ID, WSTypeUserCreate)
 
 	c.writeResponse(w, http.StatusOK, result)
@@ -217,31 +320,51 @@ func (c *apiController) login(w http.ResponseWriter, r *http.Request) {
 	user := model.User{}
 	err := c.readData(r.Body, &user)
 	if err != nil {
-		log.Println(err)
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
 		return
 	}
 
-	if user.Username == "" || user.Password == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
-		return
+	{
+		errs := validationErrors{}
+		if user.Username == "" {
+			errs.add("username", FieldErrRequired, "Username is required")
+		}
+
+		if user.Password == "" {
+			errs.add("password", FieldErrRequired, "Password is required")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
 	}
 
 	dbUser, err := c.store.UserRepo.GetByUsername(user.Username)
 	if err != nil {
-		c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Invalid username or password"})
+		if gorm.IsRecordNotFoundError(err) {
+			c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeInvalidCredentials, "Invalid username or password")
+			return
+		}
+
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
 	if !c.store.UserRepo.VerifyPassword(dbUser.PasswordHash, user.Password) {
-		c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Invalid username or password"})
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeInvalidCredentials, "Invalid username or password")
+		return
+	}
+
+	if dbUser.IsSuspended() {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeUserSuspended, "User is suspended")
 		return
 	}
 
 	token := model.AccessToken{UserID: dbUser.ID}
 	err = c.store.TokenRepo.Create(&token)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
 		return
 	}
 
@@ -251,52 +374,57 @@ func (c *apiController) login(w http.ResponseWriter, r *http.Request) {
 		AccessTokenExpiresAt: token.ExpiresAt,
 	}
 
+	setAccessTokenCookie(w, r, &token)
+
 	c.writeResponse(w, http.StatusOK, result)
 }
 
 func (c *apiController) logout(w http.ResponseWriter, r *http.Request) {
 
-	token, err := c.authenticateWithToken(r)
+	token := contextToken(r)
+	err := c.store.TokenRepo.Delete(token)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
 		return
 	}
 
-	err = c.store.TokenRepo.Delete(token)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
-		return
-	}
+	// The other tokens of the user are dropped from the caches of the other nodes too, they are validated again
+	c.tokenCache.delete(token.Token)
+	c.wsHub.invalidateTokens(token.UserID)
+	clearAccessTokenCookie(w, r)
 
 	c.writeResponse(w, http.StatusNoContent, nil)
 }
 
 func (c *apiController) updateUser(w http.ResponseWriter, r *http.Request) {
 
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
+	currentUserID := contextUserID(r)
 
 	user := model.User{}
-	err = c.readData(r.Body, &user)
+	err := c.readData(r.Body, &user)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
 		return
 	}
 
 	// validate userdata
 	{
-		if user.ID != currentUserID || len(user.FullName) > 255 {
-			c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		if user.ID != currentUserID {
+			c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the current user can be updated")
+			return
+		}
+
+		if len(user.FullName) > 255 {
+			c.writeValidationErrorResponse(w, r, validationErrors{
+				{Field: "fullName", Code: FieldErrTooLong, Message: "Full name must be less than 256 characters long"},
+			})
 			return
 		}
 	}
 
 	err = c.store.UserRepo.Update(&user)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
@@ -307,55 +435,72 @@ func (c *apiController) updateUser(w http.ResponseWriter, r *http.Request) {
 
 func (c *apiController) createChat(w http.ResponseWriter, r *http.Request) {
 
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
+	currentUserID := contextUserID(r)
 
 	chat := model.Chat{}
-	err = c.readData(r.Body, &chat)
+	err := c.readData(r.Body, &chat)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
 		return
 	}
 
 	// Validate chat data
 	{
+		errs := validationErrors{}
+
 		titleLen := len(chat.Title)
 		if titleLen >= 256 {
-			c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Title is not valid"})
-			return
+			errs.add("title", FieldErrTooLong, "Title must be less than 256 characters long")
+		}
+
+		if chat.Visibility == "" {
+			chat.Visibility = model.ChatVisibilityPrivate
+		} else if !isChatVisibility(chat.Visibility) {
+			errs.add("visibility", FieldErrInvalid, "Visibility must be private or public")
+		} else if chat.DirectUserID != "" && chat.Visibility != model.ChatVisibilityPrivate {
+			errs.add("visibility", FieldErrInvalid, "Direct chats can't be public")
 		}
 
 		if chat.DirectUserID != "" {
 			du := model.User{}
 			err = c.store.UserRepo.Get(chat.DirectUserID, &du)
-			if err != nil {
-				log.Printf("User with id %s is not found\n", chat.DirectUserID)
-				c.writeDefaultErrorResponse(w, http.StatusBadRequest)
-				return
-			}
-
-			var exists bool
-			exists, err = c.store.ChatRepo.DirectChatExists(currentUserID, chat.DirectUserID)
-			if err != nil {
-				log.Println(err)
-				c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+			if gorm.IsRecordNotFoundError(err) {
+				errs.add("directUserId", FieldErrNotFound, "Direct user is not found")
+			} else if err != nil {
+				c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 				return
 			}
+		}
 
-			if exists {
-				c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Direct chat already exists"})
-				return
-			}
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
 		}
 	}
 
 	chat.CreatorID = currentUserID
+
+	if chat.DirectUserID != "" {
+		created, err := c.store.ChatRepo.GetOrCreateDirectChat(&chat)
+		if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+			return
+		}
+
+		if !created {
+			c.writeErrorResponse(w, r, http.StatusConflict, ErrCodeConflict, "Direct chat already exists")
+			return
+		}
+
+		c.broadcastChatChange(&chat, WSTypeChatCreate)
+
+		c.writeResponse(w, http.StatusCreated, chat)
+		return
+	}
+
 	err = c.store.ChatRepo.Create(&chat)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
 		return
 	}
 
@@ -365,38 +510,63 @@ func (c *apiController) createChat(w http.ResponseWriter, r *http.Request) {
 	}
 	err = c.store.ChatUserRepo.Create(&currChatUser)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
 		return
 	}
 
-	if chat.DirectUserID != "" {
-		directChatUser := model.ChatUser{
-			ChatID: chat.ID,
-			UserID: chat.DirectUserID,
-		}
-		err := c.store.ChatUserRepo.Create(&directChatUser)
-		if err != nil {
-			c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
-			return
-		}
-	}
-
-	c.broadcastChatChange(chat.ID, WSTypeChatCreate)
+	c.broadcastChatChange(&chat, WSTypeChatCreate)
 
 	c.writeResponse(w, http.StatusCreated, chat)
 }
 
-func (c *apiController) listUsers(w http.ResponseWriter, r *http.Request) {
-	_, err := c.authenticate(r)
+// putDirectChat returns the direct chat of the current user with the user, the chat is created
+// if they don't have one yet. The direct chat of the current user with themselves keeps notes to self.
+func (c *apiController) putDirectChat(w http.ResponseWriter, r *http.Request) {
+	user := model.User{}
+	err := c.store.UserRepo.Get(mux.Vars(r)["userID"], &user)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
+	chat, created, err := c.getOrCreateDirectChat(contextUserID(r), user.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	if created {
+		c.writeResponse(w, http.StatusCreated, chat)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, chat)
+}
+
+// getOrCreateDirectChat returns the direct chat of the users, a new chat is created by the creator
+// and broadcast to both users. It reports whether the chat was created.
+func (c *apiController) getOrCreateDirectChat(creatorID, directUserID string) (*model.Chat, bool, error) {
+	chat := model.Chat{
+		CreatorID:    creatorID,
+		DirectUserID: directUserID,
+	}
+	created, err := c.store.ChatRepo.GetOrCreateDirectChat(&chat)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		c.broadcastChatChange(&chat, WSTypeChatCreate)
+	}
+
+	return &chat, created, nil
+}
+
+func (c *apiController) listUsers(w http.ResponseWriter, r *http.Request) {
 	users := []model.User{}
-	err = c.store.UserRepo.List(&users)
+	err := c.store.UserRepo.List(&users)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
@@ -409,39 +579,22 @@ func (c *apiController) listUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *apiController) listActiveUserIDs(w http.ResponseWriter, r *http.Request) {
-	_, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
-
 	c.writeResponse(w, http.StatusOK, map[string]interface{}{
 		"activeUserIds": c.wsHub.listActiveUserIDs(),
 	})
 }
 
 func (c *apiController) getUser(w http.ResponseWriter, r *http.Request) {
-	_, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
-
 	vars := mux.Vars(r)
 	if vars["userID"] == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
 		return
 	}
 
 	user := model.User{}
-	err = c.store.UserRepo.Get(vars["userID"], &user)
+	err := c.store.UserRepo.Get(vars["userID"], &user)
 	if err != nil {
-		if gorm.IsRecordNotFoundError(err) {
-			c.writeDefaultErrorResponse(w, http.StatusNotFound)
-			return
-		}
-
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
@@ -450,22 +603,36 @@ func (c *apiController) getUser(w http.ResponseWriter, r *http.Request) {
 
 func (c *apiController) listChats(w http.ResponseWriter, r *http.Request) {
 
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
+	currentUserID := contextUserID(r)
+
+	limit, offset, errs := parsePagination(r)
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
 		return
 	}
 
-	chats := []model.Chat{}
-	err = c.store.ChatRepo.ListByUserID(currentUserID, &chats)
+	chats := []model.ChatListItem{}
+	err := c.store.ChatRepo.ListItemsByUserID(currentUserID, limit, offset, &chats)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
 		return
 	}
 
 	c.writeResponse(w, http.StatusOK, chats)
 }
 
+func (c *apiController) markChatRead(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	err := c.store.ChatUserRepo.UpdateLastReadAt(vars["chatID"], contextUserID(r), nil)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
 func (c *apiController) isContentTypePermitted(ct string) bool {
 	for _, pct := range PERMITTED_AVATAR_CONTENT_TYPES {
 		if ct == pct {
@@ -477,70 +644,86 @@ func (c *apiController) isContentTypePermitted(ct string) bool {
 }
 
 func (c *apiController) getAvatar(w http.ResponseWriter, r *http.Request) {
-	_, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
-
 	vars := mux.Vars(r)
 	if vars["userID"] == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
 		return
 	}
 
 	exists, err := c.store.UserRepo.HasAvatar(vars["userID"])
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
 	if !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeAvatarNotFound, "User has no avatar")
 		return
 	}
 
 	avatar := model.UserAvatar{}
 	err = c.store.UserRepo.GetAvatar(vars["userID"], &avatar)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeAvatarNotFound)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", avatar.ContentType)
+	w.WriteHeader(http.StatusOK)
 	w.Write(avatar.Blob)
 }
 
 func (c *apiController) uploadAvatar(w http.ResponseWriter, r *http.Request) {
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
+	currentUserID := contextUserID(r)
+
+	vars := mux.Vars(r)
+	if vars["userID"] == "" {
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
 		return
 	}
 
-	vars := mux.Vars(r)
-	if vars["userID"] == "" || currentUserID != vars["userID"] {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+	if currentUserID != vars["userID"] {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the current user's avatar can be updated")
 		return
 	}
 
 	avatar, err := ioutil.ReadAll(r.Body)
-	contentType := r.Header.Get("Content-Type")
-	if err != nil || len(avatar) == 0 || len(avatar) > MAX_BLOB_SIZE || len(contentType) == 0 || !c.isContentTypePermitted(contentType) {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, "Failed to read the request body")
 		return
 	}
 
+	// Validate avatar
+	{
+		errs := validationErrors{}
+		if len(avatar) == 0 {
+			errs.add("body", FieldErrRequired, "Avatar is required")
+		} else if len(avatar) > MAX_BLOB_SIZE {
+			errs.add("body", FieldErrTooLong, "Avatar must not be bigger than 15MB")
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		if len(contentType) == 0 {
+			errs.add("Content-Type", FieldErrRequired, "Content type is required")
+		} else if !c.isContentTypePermitted(contentType) {
+			errs.add("Content-Type", FieldErrInvalid, "Content type must be one of: "+strings.Join(PERMITTED_AVATAR_CONTENT_TYPES, ", "))
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
 	exists, err := c.store.UserRepo.HasAvatar(currentUserID)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
 	userAvatar := model.UserAvatar{
 		UserID:      currentUserID,
-		ContentType: contentType,
+		ContentType: r.Header.Get("Content-Type"),
 		Blob:        avatar,
 	}
 
@@ -550,7 +733,7 @@ func (c *apiController) uploadAvatar(w http.ResponseWriter, r *http.Request) {
 		err = c.store.UserRepo.UpdateAvatar(&userAvatar)
 	}
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
 		return
 	}
 
@@ -562,34 +745,16 @@ func (c *apiController) uploadAvatar(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *apiController) getChat(w http.ResponseWriter, r *http.Request) {
-
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
-
 	vars := mux.Vars(r)
 	if vars["chatID"] == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
-		return
-	}
-
-	exists, err := c.store.ChatUserRepo.Exists(vars["chatID"], currentUserID)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusForbidden)
-		return
-	}
-
-	if !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
 		return
 	}
 
 	chat := model.Chat{}
-	err = c.store.ChatRepo.Get(vars["chatID"], &chat)
+	err := c.store.ChatRepo.Get(vars["chatID"], &chat)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
 		return
 	}
 
@@ -597,209 +762,325 @@ func (c *apiController) getChat(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *apiController) updateChat(w http.ResponseWriter, r *http.Request) {
-
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
-
 	chat := model.Chat{}
-	err = c.readData(r.Body, &chat)
+	err := c.readData(r.Body, &chat)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
 		return
 	}
 
 	vars := mux.Vars(r)
-	if vars["chatID"] == "" || vars["chatID"] != chat.ID {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
-		return
-	}
 
 	// validate chat data
 	{
+		errs := validationErrors{}
+		if chat.ID != vars["chatID"] {
+			errs.add("id", FieldErrMismatch, "Chat id doesn't match the requested chat")
+		}
+
 		titleLen := len(chat.Title)
 		if titleLen >= 256 {
-			c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Title is not valid"})
+			errs.add("title", FieldErrTooLong, "Title must be less than 256 characters long")
+		}
+
+		if chat.Visibility != "" && !isChatVisibility(chat.Visibility) {
+			errs.add("visibility", FieldErrInvalid, "Visibility must be private or public")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
 			return
 		}
 	}
 
-	exists, err := c.store.ChatUserRepo.Exists(vars["chatID"], currentUserID)
-	if err != nil || !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
-		return
+	// Only the creator can change the visibility, an empty visibility keeps it
+	if chat.Visibility != "" {
+		oldChat := model.Chat{}
+		err = c.store.ChatRepo.Get(chat.ID, &oldChat)
+		if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+			return
+		}
+
+		if chat.Visibility != oldChat.Visibility {
+			if oldChat.DirectUserID != "" {
+				c.writeValidationErrorResponse(w, r, validationErrors{
+					{Field: "visibility", Code: FieldErrInvalid, Message: "Direct chats can't be public"},
+				})
+				return
+			}
+
+			if oldChat.CreatorID != contextUserID(r) {
+				c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the chat creator can change the visibility")
+				return
+			}
+		}
 	}
 
 	err = c.store.ChatRepo.Update(&chat)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
 		return
 	}
 
-	c.broadcastChatChange(chat.ID, WSTypeChatUpdate)
+	c.broadcastChatChange(&chat, WSTypeChatUpdate)
 
 	c.writeResponse(w, http.StatusOK, chat)
 }
 
 func (c *apiController) deleteChat(w http.ResponseWriter, r *http.Request) {
 
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
+	currentUserID := contextUserID(r)
 
 	vars := mux.Vars(r)
 	if vars["chatID"] == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
-		return
-	}
-
-	exists, err := c.store.ChatUserRepo.Exists(vars["chatID"], currentUserID)
-	if err != nil || !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
 		return
 	}
 
 	chat := model.Chat{}
-	err = c.store.ChatRepo.Get(vars["chatID"], &chat)
+	err := c.store.ChatRepo.Get(vars["chatID"], &chat)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
 		return
 	}
 
 	if chat.CreatorID != currentUserID {
-		c.writeDefaultErrorResponse(w, http.StatusForbidden)
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the chat creator can delete the chat")
 		return
 	}
 
-	err = c.store.ChatUserRepo.DeleteByChatID(vars["chatID"])
+	// The members are needed to notify them after the chat is deleted
+	userIDs, err := c.listChatUserIDs(chat.ID)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
 		return
 	}
 
-	err = c.store.ChatRepo.Delete(vars["chatID"])
+	err = c.store.Transaction(func(tx *dbcontroller.Store) error {
+		return deleteChatData(tx, chat.ID)
+	})
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
 		return
 	}
 
-	err = c.store.MessageRepo.DeleteByChatID(vars["chatID"])
+	c.broadcastChatChangeTo(userIDs, &chat, WSTypeChatDelete)
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// deleteChatData removes the chat with its members, messages, mentions, webhooks, scheduled messages and invites
+func deleteChatData(store *dbcontroller.Store, chatID string) error {
+	err := store.ChatUserRepo.DeleteByChatID(chatID)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	c.broadcastChatChange(vars["chatID"], WSTypeChatDelete)
+	err = store.ChatRepo.Delete(chatID)
+	if err != nil {
+		return err
+	}
 
-	c.writeResponse(w, http.StatusNoContent, nil)
-}
+	err = store.MessageRepo.DeleteByChatID(chatID)
+	if err != nil {
+		return err
+	}
 
-func (c *apiController) createMessage(w http.ResponseWriter, r *http.Request) {
+	err = store.MessageMentionRepo.DeleteByChatID(chatID)
+	if err != nil {
+		return err
+	}
 
-	currentUserID, err := c.authenticate(r)
+	err = store.WebhookRepo.DeleteByChatID(chatID)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
+		return err
 	}
 
-	msg := model.Message{}
-	err = c.readData(r.Body, &msg)
+	err = store.IncomingWebhookRepo.DeleteByChatID(chatID)
+	if err != nil {
+		return err
+	}
+
+	err = store.ScheduledMessageRepo.DeleteByChatID(chatID)
+	if err != nil {
+		return err
+	}
+
+	return store.ChatInviteRepo.DeleteByChatID(chatID)
+}
+
+func (c *apiController) createMessage(w http.ResponseWriter, r *http.Request) {
+
+	currentUserID := contextUserID(r)
+
+	data := MessageData{}
+	err := c.readData(r.Body, &data)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
 		return
 	}
+	msg := data.Message
 
 	vars := mux.Vars(r)
 	// Validate message data
 	{
-		if msg.ChatID != vars["chatID"] || msg.UserID != currentUserID {
-			c.writeResponse(w, http.StatusBadRequest, ErrorMessage{"Invalid message data"})
+		errs := validationErrors{}
+		if msg.ChatID != vars["chatID"] {
+			errs.add("chatId", FieldErrMismatch, "Chat id doesn't match the requested chat")
+		}
+
+		if msg.UserID != currentUserID {
+			errs.add("userId", FieldErrMismatch, "User id doesn't match the current user")
+		}
+
+		if data.SendAt != nil {
+			now := time.Now()
+			if !data.SendAt.After(now) {
+				errs.add("sendAt", FieldErrInvalid, "Send time must be in the future")
+			} else if data.SendAt.After(now.Add(maxScheduleAhead)) {
+				errs.add("sendAt", FieldErrInvalid, "Send time must be at most 1 year ahead")
+			}
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
 			return
 		}
 	}
 
-	exists, err := c.store.ChatUserRepo.Exists(vars["chatID"], currentUserID)
-	if err != nil || !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+	// Messages of users which start with a command name invoke the command, a leading "//" posts
+	// the message with a single slash instead. Bots can't invoke commands.
+	if strings.HasPrefix(msg.Message, "//") {
+		if _, _, ok := parseCommand(msg.Message[1:]); ok {
+			msg.Message = msg.Message[1:]
+		}
+	} else if name, args, ok := parseCommand(msg.Message); ok && !contextUser(r).Bot {
+		if data.SendAt != nil {
+			c.writeValidationErrorResponse(w, r, validationErrors{
+				{Field: "message", Code: FieldErrInvalid, Message: "Commands can't be scheduled"},
+			})
+			return
+		}
+
+		c.runCommand(w, r, name, args)
+		return
+	}
+
+	if data.SendAt != nil {
+		c.scheduleMessage(w, r, &msg, data.SendAt)
 		return
 	}
 
-	err = c.store.MessageRepo.Create(&msg)
+	msg.Type = model.MessageTypeText
+	err = c.postMessage(&msg)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
 		return
 	}
 
-	c.store.ChatRepo.UpdateUpdatedAt(msg.ChatID, msg.UpdatedAt)
+	c.writeResponse(w, http.StatusCreated, msg)
+}
 
-	c.broadcastMessageChange(&msg, WSTypeMessageCreate)
+// renderMissingMessageHTML renders the markup of the messages created before it was supported
+func renderMissingMessageHTML(store *dbcontroller.Store) {
+	for {
+		messages := []model.Message{}
+		err := store.MessageRepo.ListWithoutHTML(500, &messages)
+		if err != nil {
+			log.Printf("Failed to list messages without HTML: %+v\n", err)
+			return
+		}
 
-	c.writeResponse(w, http.StatusCreated, msg)
+		rendered := 0
+		for i := range messages {
+			html := markup.ToHTML(messages[i].Message)
+			if html == "" {
+				continue
+			}
+
+			err = store.MessageRepo.UpdateHTML(messages[i].ID, html)
+			if err != nil {
+				log.Printf("Failed to store HTML of message %s: %+v\n", messages[i].ID, err)
+				return
+			}
+			rendered++
+		}
+
+		// Messages with only white space don't have any HTML, so they are listed again
+		if rendered == 0 {
+			return
+		}
+	}
 }
 
-func (c *apiController) listMessages(w http.ResponseWriter, r *http.Request) {
+// postMessage creates the message and notifies the chat members
+func (c *apiController) postMessage(msg *model.Message) error {
+	msg.HTML = markup.ToHTML(msg.Message)
 
-	currentUserID, err := c.authenticate(r)
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(msg.ChatID, &chat)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
+		return err
 	}
 
-	vars := mux.Vars(r)
-	if vars["chatID"] == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
-		return
+	if chat.MessageTTL > 0 {
+		expiresAt := time.Now().Add(time.Duration(chat.MessageTTL) * time.Second)
+		msg.ExpiresAt = &expiresAt
 	}
 
-	exists, err := c.store.ChatUserRepo.Exists(vars["chatID"], currentUserID)
-	if err != nil || !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
-		return
+	err = c.store.MessageRepo.Create(msg)
+	if err != nil {
+		return err
 	}
 
-	messages := []model.Message{}
-	err = c.store.MessageRepo.ListByChatID(vars["chatID"], &messages)
+	c.store.ChatRepo.UpdateUpdatedAt(msg.ChatID, msg.UpdatedAt)
+
+	c.broadcastMessageChange(msg, WSTypeMessageCreate)
+
+	err = c.updateMentions(msg)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
-		return
+		log.Printf("Failed to store mentions of message %s: %+v\n", msg.ID, err)
 	}
 
-	c.writeResponse(w, http.StatusOK, messages)
+	c.linkPreviewer.notifyMessage(msg)
+
+	return nil
 }
 
-func (c *apiController) getMessage(w http.ResponseWriter, r *http.Request) {
+func (c *apiController) listMessages(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["chatID"] == "" {
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
+		return
+	}
 
-	currentUserID, err := c.authenticate(r)
+	messages := []model.Message{}
+	err := c.store.MessageRepo.ListByChatID(vars["chatID"], &messages)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
 		return
 	}
 
+	c.writeResponse(w, http.StatusOK, messages)
+}
+
+func (c *apiController) getMessage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if vars["chatID"] == "" || vars["messageID"] == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
-		return
-	}
-
-	exists, err := c.store.ChatUserRepo.Exists(vars["chatID"], currentUserID)
-	if err != nil || !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
 		return
 	}
 
 	msg := model.Message{}
-	err = c.store.MessageRepo.Get(vars["messageID"], &msg)
+	err := c.store.MessageRepo.Get(vars["messageID"], &msg)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
 		return
 	}
 
 	if msg.ChatID != vars["chatID"] {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeMessageNotFound, "Message is not found")
 		return
 	}
 
@@ -808,51 +1089,49 @@ func (c *apiController) getMessage(w http.ResponseWriter, r *http.Request) {
 
 func (c *apiController) updateMessage(w http.ResponseWriter, r *http.Request) {
 
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
+	currentUserID := contextUserID(r)
 
 	msg := model.Message{}
-	err = c.readData(r.Body, &msg)
+	err := c.readData(r.Body, &msg)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
 		return
 	}
 
 	vars := mux.Vars(r)
 	if vars["chatID"] == "" || vars["messageID"] == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
 		return
 	}
 
-	exists, err := c.store.ChatUserRepo.Exists(vars["chatID"], currentUserID)
-	if err != nil || !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+	if msg.ID != vars["messageID"] {
+		c.writeValidationErrorResponse(w, r, validationErrors{
+			{Field: "id", Code: FieldErrMismatch, Message: "Message id doesn't match the requested message"},
+		})
 		return
 	}
 
 	old := model.Message{}
 	err = c.store.MessageRepo.Get(vars["messageID"], &old)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
 		return
 	}
 
 	if old.ChatID != vars["chatID"] {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeMessageNotFound, "Message is not found")
 		return
 	}
 
 	if old.UserID != currentUserID {
-		c.writeDefaultErrorResponse(w, http.StatusForbidden)
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the message author can update the message")
 		return
 	}
 
+	msg.HTML = markup.ToHTML(msg.Message)
 	err = c.store.MessageRepo.Update(&msg)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
 		return
 	}
 
@@ -860,49 +1139,52 @@ func (c *apiController) updateMessage(w http.ResponseWriter, r *http.Request) {
 
 	c.broadcastMessageChange(&msg, WSTypeMessageUpdate)
 
+	err = c.updateMentions(&msg)
+	if err != nil {
+		log.Printf("Failed to store mentions of message %s: %+v\n", msg.ID, err)
+	}
+
+	c.linkPreviewer.notifyMessage(&msg)
+
 	c.writeResponse(w, http.StatusOK, msg)
 }
 
 func (c *apiController) deleteMessage(w http.ResponseWriter, r *http.Request) {
 
-	currentUserID, err := c.authenticate(r)
-	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusUnauthorized)
-		return
-	}
+	currentUserID := contextUserID(r)
 
 	vars := mux.Vars(r)
 	if vars["chatID"] == "" || vars["messageID"] == "" {
-		c.writeDefaultErrorResponse(w, http.StatusBadRequest)
-		return
-	}
-
-	exists, err := c.store.ChatUserRepo.Exists(vars["chatID"], currentUserID)
-	if err != nil || !exists {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+		c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
 		return
 	}
 
 	msg := model.Message{}
-	err = c.store.MessageRepo.Get(vars["messageID"], &msg)
+	err := c.store.MessageRepo.Get(vars["messageID"], &msg)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
 		return
 	}
 
 	if msg.ChatID != vars["chatID"] {
-		c.writeDefaultErrorResponse(w, http.StatusNotFound)
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeMessageNotFound, "Message is not found")
 		return
 	}
 
 	if msg.UserID != currentUserID {
-		c.writeDefaultErrorResponse(w, http.StatusForbidden)
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the message author can delete the message")
 		return
 	}
 
 	err = c.store.MessageRepo.Delete(msg.ID)
 	if err != nil {
-		c.writeDefaultErrorResponse(w, http.StatusInternalServerError)
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
+		return
+	}
+
+	err = c.store.MessageMentionRepo.DeleteByMessageID(msg.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
 		return
 	}
 
@@ -913,83 +1195,127 @@ func (c *apiController) deleteMessage(w http.ResponseWriter, r *http.Request) {
 	c.writeResponse(w, http.StatusNoContent, nil)
 }
 
-func (c *apiController) authenticateWithToken(req *http.Request) (*model.AccessToken, error) {
-	tokenString := ""
-	bearerToken := req.Header.Get("Authorization")
-	parts := strings.Split(bearerToken, " ")
-	if len(parts) == 2 && parts[0] == "Bearer" {
-		tokenString = parts[1]
+func (c *apiController) broadcastMessageChange(msg *model.Message, messageType string) {
+	userIDs, err := c.listChatUserIDs(msg.ChatID)
+	if err != nil || len(userIDs) == 0 {
+		return
 	}
 
-	return c.validateAccessToken(tokenString)
-}
+	data := &WSMessageData{
+		Type:      messageType,
+		MessageID: msg.ID,
+		ChatID:    msg.ChatID,
+	}
 
-func (c *apiController) validateAccessToken(tokenString string) (*model.AccessToken, error) {
-	if tokenString == "" {
-		return nil, fmt.Errorf("Access token is missing")
+	var fullData interface{}
+	if messageType != WSTypeMessageDelete {
+		full := *data
+		full.Message = msg
+		fullData = &full
 	}
 
-	token, err := c.store.TokenRepo.Get(tokenString)
-	if err != nil {
-		log.Println("Failed to get access token from store: ", err)
-		return nil, fmt.Errorf("Access token is invalid")
+	c.wsHub.broadcastData(userIDs, data, fullData)
+
+	if fullData != nil {
+		c.webhookDispatcher.notify(msg.ChatID, messageType, fullData)
+	} else {
+		c.webhookDispatcher.notify(msg.ChatID, messageType, data)
 	}
 
-	if !token.IsValid() {
-		c.store.TokenRepo.Delete(token)
-		return nil, fmt.Errorf("Access token is expired")
+	if messageType == WSTypeMessageCreate {
+		c.pushDispatcher.notifyMessage(msg)
+	}
+}
+
+func (c *apiController) broadcastChatChange(chat *model.Chat, messageType string) {
+	userIDs, err := c.listChatUserIDs(chat.ID)
+	if err != nil || len(userIDs) == 0 {
+		return
 	}
 
-	return token, nil
+	c.broadcastChatChangeTo(userIDs, chat, messageType)
 }
 
-func (c *apiController) authenticate(req *http.Request) (string, error) {
-	token, err := c.authenticateWithToken(req)
-	if err != nil {
-		return "", err
+// broadcastChatChangeTo notifies the given users, used when the chat members are already removed
+func (c *apiController) broadcastChatChangeTo(userIDs []string, chat *model.Chat, messageType string) {
+	data := &WSChatData{
+		Type:   messageType,
+		ChatID: chat.ID,
+	}
+
+	var fullData interface{}
+	if messageType != WSTypeChatDelete {
+		full := *data
+		full.Chat = chat
+		fullData = &full
 	}
 
-	return token.UserID, nil
+	c.wsHub.broadcastData(userIDs, data, fullData)
+
+	if messageType == WSTypeChatUpdate {
+		c.webhookDispatcher.notify(chat.ID, messageType, fullData)
+	}
 }
 
-func (c *apiController) broadcastMessageChange(msg *model.Message, messageType string) {
-	chatUsers := []model.ChatUser{}
-	err := c.store.ChatUserRepo.ListByChatID(msg.ChatID, &chatUsers)
-	if err == nil && len(chatUsers) > 0 {
-		userIDs := []string{}
-		for i := range chatUsers {
-			userIDs = append(userIDs, chatUsers[i].UserID)
-		}
+func (c *apiController) broadcastUserChange(userID string, messageType string) {
+	data := &WSUserData{
+		Type:   messageType,
+		UserID: userID,
+	}
 
-		c.wsHub.broadcastData(userIDs, &WSMessageData{
-			Type:      messageType,
-			MessageID: msg.ID,
-			ChatID:    msg.ChatID,
-		})
+	var fullData interface{}
+	if messageType != WSTypeUserDelete {
+		user := model.User{}
+		err := c.store.UserRepo.Get(userID, &user)
+		if err == nil {
+			full := *data
+			full.User = &user.PublicUser
+			fullData = &full
+		}
 	}
+
+	c.wsHub.broadcastDataToAll(data, fullData)
 }
 
-func (c *apiController) broadcastChatChange(chatID string, messageType string) {
+func (c *apiController) listChatUserIDs(chatID string) ([]string, error) {
 	chatUsers := []model.ChatUser{}
 	err := c.store.ChatUserRepo.ListByChatID(chatID, &chatUsers)
-	if err == nil && len(chatUsers) > 0 {
-		userIDs := []string{}
-		for i := range chatUsers {
-			userIDs = append(userIDs, chatUsers[i].UserID)
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		c.wsHub.broadcastData(userIDs, &WSMessageData{
-			Type:   messageType,
-			ChatID: chatID,
-		})
+	userIDs := []string{}
+	for i := range chatUsers {
+		userIDs = append(userIDs, chatUsers[i].UserID)
 	}
+
+	return userIDs, nil
 }
 
-func (c *apiController) broadcastUserChange(userID string, messageType string) {
-	c.wsHub.broadcastDataToAll(&WSUserData{
-		Type:   messageType,
-		UserID: userID,
-	})
+// parsePagination reads the limit and offset query parameters of list requests
+func parsePagination(r *http.Request) (int, int, validationErrors) {
+	errs := validationErrors{}
+	query := r.URL.Query()
+
+	limit := defaultPageLimit
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			errs.add("limit", FieldErrInvalid, fmt.Sprintf("Limit must be a number between 1 and %d", maxPageLimit))
+		}
+	}
+
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		var err error
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			errs.add("offset", FieldErrInvalid, "Offset must be a non-negative number")
+		}
+	}
+
+	return limit, offset, errs
 }
 
 func parseJSONData(data io.Reader, result interface{}) error {
@@ -1007,18 +1333,20 @@ func parseJSONData(data io.Reader, result interface{}) error {
 }
 
 func writeJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.WriteHeader(statusCode)
 	if data == nil {
+		w.WriteHeader(statusCode)
 		return
 	}
 
 	jsonData, err := marshalJSONData(data)
 	if err != nil {
 		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
 	w.Write(jsonData)
 }
 
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"./dbcontroller"
+)
+
+// testDB is a database/sql connector which records the statements and answers the queries of a table
+// with its fixture rows
+type testDB struct {
+	mu         sync.Mutex
+	statements []string
+	columns    map[string][]string
+	rows       map[string][][]driver.Value
+}
+
+func (db *testDB) Connect(ctx context.Context) (driver.Conn, error) {
+	return &testDBConn{db: db}, nil
+}
+
+func (db *testDB) Driver() driver.Driver {
+	return nil
+}
+
+func (db *testDB) record(statement string) {
+	db.mu.Lock()
+	db.statements = append(db.statements, statement)
+	db.mu.Unlock()
+}
+
+func (db *testDB) count(prefix string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n := 0
+	for _, statement := range db.statements {
+		if strings.HasPrefix(statement, prefix) {
+			n++
+		}
+	}
+
+	return n
+}
+
+type testDBConn struct {
+	db *testDB
+}
+
+func (c *testDBConn) Prepare(query string) (driver.Stmt, error) {
+	return &testDBStmt{db: c.db, query: query}, nil
+}
+
+func (c *testDBConn) Close() error {
+	return nil
+}
+
+func (c *testDBConn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN")
+	return &testDBTx{db: c.db}, nil
+}
+
+type testDBTx struct {
+	db *testDB
+}
+
+func (tx *testDBTx) Commit() error {
+	tx.db.record("COMMIT")
+	return nil
+}
+
+func (tx *testDBTx) Rollback() error {
+	tx.db.record("ROLLBACK")
+	return nil
+}
+
+type testDBStmt struct {
+	db    *testDB
+	query string
+}
+
+func (s *testDBStmt) Close() error {
+	return nil
+}
+
+func (s *testDBStmt) NumInput() int {
+	return -1
+}
+
+func (s *testDBStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.record(s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *testDBStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.record(s.query)
+
+	for table, columns := range s.db.columns {
+		if strings.Contains(s.query, "FROM `"+table+"`") {
+			return &testDBRows{columns: columns, rows: s.db.rows[table]}, nil
+		}
+	}
+
+	return &testDBRows{}, nil
+}
+
+type testDBRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *testDBRows) Columns() []string {
+	return r.columns
+}
+
+func (r *testDBRows) Close() error {
+	return nil
+}
+
+func (r *testDBRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestDeleteChatDataWithWebhooks(t *testing.T) {
+	db := &testDB{
+		columns: map[string][]string{"webhook": {"id", "chat_id"}},
+		rows: map[string][][]driver.Value{"webhook": {
+			{"webhook1", "chat1"},
+			{"webhook2", "chat1"},
+		}},
+	}
+
+	store, err := dbcontroller.NewStoreWithDB(sql.OpenDB(db))
+	if err != nil {
+		t.Fatalf("Failed to create the store: %v", err)
+	}
+
+	// The webhooks are deleted in the transaction of the chat instead of their own
+	err = store.Transaction(func(tx *dbcontroller.Store) error {
+		return deleteChatData(tx, "chat1")
+	})
+	if err != nil {
+		t.Fatalf("Failed to delete the chat: %v", err)
+	}
+
+	if n := db.count("BEGIN"); n != 1 {
+		t.Errorf("Deleting the chat began %d transactions, want 1", n)
+	}
+	if n := db.count("COMMIT"); n != 1 {
+		t.Errorf("Deleting the chat committed %d transactions, want 1", n)
+	}
+	if n := db.count("ROLLBACK"); n != 0 {
+		t.Errorf("Deleting the chat rolled back %d transactions", n)
+	}
+	if n := db.count("DELETE FROM `webhook_delivery`"); n != 2 {
+		t.Errorf("Deliveries of %d webhooks were deleted, want 2", n)
+	}
+	if n := db.count("DELETE FROM `webhook` "); n != 2 {
+		t.Errorf("%d webhooks were deleted, want 2", n)
+	}
+	if n := db.count("DELETE FROM `chat` "); n != 1 {
+		t.Errorf("Chat was deleted %d times, want 1", n)
+	}
+	if last := db.statements[len(db.statements)-1]; last != "COMMIT" {
+		t.Errorf("Last statement is %q, want COMMIT", last)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/jinzhu/gorm"
+)
+
+// API error codes. They are part of the API contract and must not be changed.
+const (
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeValidationFailed   = "validation_failed"
+	ErrCodeInvalidCredentials = "invalid_credentials"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeUserSuspended      = "user_suspended"
+	ErrCodeNotChatMember      = "not_chat_member"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeUserNotFound       = "user_not_found"
+	ErrCodeChatNotFound       = "chat_not_found"
+	ErrCodeMessageNotFound    = "message_not_found"
+	ErrCodeAvatarNotFound     = "avatar_not_found"
+	ErrCodeMethodNotAllowed   = "method_not_allowed"
+	ErrCodeConflict           = "conflict"
+	ErrCodeEventsExpired      = "events_expired"
+	ErrCodeUnknownCommand     = "unknown_command"
+	ErrCodeInvalidCommand     = "invalid_command"
+	ErrCodeInternal           = "internal_error"
+	ErrCodeInviteNotFound     = "invite_not_found"
+	ErrCodeInviteExpired      = "invite_expired"
+)
+
+// Field validation error codes
+const (
+	FieldErrRequired = "required"
+	FieldErrInvalid  = "invalid"
+	FieldErrTooShort = "too_short"
+	FieldErrTooLong  = "too_long"
+	FieldErrMismatch = "mismatch"
+	FieldErrNotFound = "not_found"
+	FieldErrTaken    = "taken"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+const contextKeyRequestID contextKey = "requestId"
+
+var requestIDRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type APIError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type validationErrors []FieldError
+
+func (v *validationErrors) add(field, code, message string) {
+	*v = append(*v, FieldError{
+		Field:   field,
+		Code:    code,
+		Message: message,
+	})
+}
+
+func (c *apiController) writeErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, code, message string) {
+	writeJSONResponse(w, statusCode, &APIError{
+		Code:      code,
+		Message:   message,
+		RequestID: contextRequestID(r),
+	})
+}
+
+func (c *apiController) writeDefaultErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int) {
+	var code string
+
+	switch statusCode {
+	case http.StatusBadRequest:
+		code = ErrCodeBadRequest
+	case http.StatusUnauthorized:
+		code = ErrCodeUnauthorized
+	case http.StatusForbidden:
+		code = ErrCodeForbidden
+	case http.StatusNotFound:
+		code = ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		code = ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		code = ErrCodeConflict
+	default:
+		code = ErrCodeInternal
+	}
+
+	c.writeErrorResponse(w, r, statusCode, code, http.StatusText(statusCode))
+}
+
+func (c *apiController) writeValidationErrorResponse(w http.ResponseWriter, r *http.Request, details validationErrors) {
+	writeJSONResponse(w, http.StatusBadRequest, &APIError{
+		Code:      ErrCodeValidationFailed,
+		Message:   "Request data is not valid",
+		Details:   details,
+		RequestID: contextRequestID(r),
+	})
+}
+
+// writeStoreErrorResponse maps missing records to 404 with the given code
+// and every other store failure to 500
+func (c *apiController) writeStoreErrorResponse(w http.ResponseWriter, r *http.Request, err error, notFoundCode string) {
+	if gorm.IsRecordNotFoundError(err) {
+		c.writeErrorResponse(w, r, http.StatusNotFound, notFoundCode, "Resource is not found")
+		return
+	}
+
+	log.Printf("Store error(request %s): %+v\n", contextRequestID(r), err)
+	c.writeDefaultErrorResponse(w, r, http.StatusInternalServerError)
+}
+
+func (c *apiController) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	c.writeDefaultErrorResponse(w, r, http.StatusNotFound)
+}
+
+func (c *apiController) methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	c.writeDefaultErrorResponse(w, r, http.StatusMethodNotAllowed)
+}
+
+// requestIDMiddleware assigns an ID to every request, so errors reported
+// by clients can be matched with the server logs
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !requestIDRe.MatchString(requestID) {
+			requestID = generateRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), contextKeyRequestID, requestID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func contextRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(contextKeyRequestID).(string)
+	return requestID
+}
+
+func generateRequestID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		log.Println("Failed to generate request id: ", err)
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
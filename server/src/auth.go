@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"./model"
+	"github.com/gorilla/mux"
+)
+
+type contextKey string
+
+// Request context keys
+const (
+	contextKeyUser  contextKey = "user"
+	contextKeyToken contextKey = "accessToken"
+)
+
+// authMiddleware authenticates the request once and stores
+// the current user and its access token in the request context
+func (c *apiController) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, user, err := c.authenticateRequest(r)
+		if err != nil {
+			c.writeErrorResponse(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, err.Error())
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyToken, token)
+		ctx = context.WithValue(ctx, contextKeyUser, user)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// chatMemberMiddleware rejects requests to /chat/{chatID}/... routes
+// from users which are not members of the chat
+func (c *apiController) chatMemberMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if vars["chatID"] == "" {
+			c.writeDefaultErrorResponse(w, r, http.StatusBadRequest)
+			return
+		}
+
+		isMember, err := c.store.ChatUserRepo.Exists(vars["chatID"], contextUserID(r))
+		if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+			return
+		}
+
+		if !isMember {
+			chatExists, err := c.store.ChatRepo.Exists(vars["chatID"])
+			if err != nil {
+				c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+				return
+			}
+
+			if !chatExists {
+				c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeChatNotFound, "Chat is not found")
+				return
+			}
+
+			c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeNotChatMember, "User is not a member of the chat")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireRole rejects requests from users which don't have the given server-wide role.
+// It must be used after authMiddleware.
+func (c *apiController) requireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if contextUser(r).Role != role {
+				c.writeDefaultErrorResponse(w, r, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func contextUser(r *http.Request) *model.User {
+	user, _ := r.Context().Value(contextKeyUser).(*model.User)
+	return user
+}
+
+func contextUserID(r *http.Request) string {
+	user := contextUser(r)
+	if user == nil {
+		return ""
+	}
+
+	return user.ID
+}
+
+func contextToken(r *http.Request) *model.AccessToken {
+	token, _ := r.Context().Value(contextKeyToken).(*model.AccessToken)
+	return token
+}
+
+func (c *apiController) authenticateRequest(req *http.Request) (*model.AccessToken, *model.User, error) {
+	tokenString := ""
+	bearerToken := req.Header.Get("Authorization")
+	parts := strings.Split(bearerToken, " ")
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		tokenString = parts[1]
+	}
+
+	return c.validateAccessToken(tokenString)
+}
+
+func (c *apiController) validateAccessToken(tokenString string) (*model.AccessToken, *model.User, error) {
+	if tokenString == "" {
+		return nil, nil, fmt.Errorf("Access token is missing")
+	}
+
+	if token, user, ok := c.tokenCache.get(tokenString); ok {
+		return token, user, nil
+	}
+
+	if strings.HasPrefix(tokenString, model.APITokenPrefix) {
+		return c.validateAPIToken(tokenString)
+	}
+
+	token, err := c.store.TokenRepo.Get(tokenString)
+	if err != nil {
+		log.Println("Failed to get access token from store: ", err)
+		return nil, nil, fmt.Errorf("Access token is invalid")
+	}
+
+	if !token.IsValid() {
+		c.store.TokenRepo.Delete(token)
+		return nil, nil, fmt.Errorf("Access token is expired")
+	}
+
+	user := model.User{}
+	err = c.store.UserRepo.Get(token.UserID, &user)
+	if err != nil {
+		log.Println("Failed to get access token's user from store: ", err)
+		return nil, nil, fmt.Errorf("Access token is invalid")
+	}
+
+	if user.IsSuspended() {
+		return nil, nil, fmt.Errorf("User is suspended")
+	}
+
+	c.tokenCache.set(token, &user)
+
+	return token, &user, nil
+}
+
+// validateAPIToken authenticates a bot with a long-lived API token. The token is represented
+// as an access token with scopes, so it is cached and checked like session tokens.
+func (c *apiController) validateAPIToken(tokenString string) (*model.AccessToken, *model.User, error) {
+	apiToken := model.APIToken{}
+	err := c.store.APITokenRepo.GetByToken(tokenString, &apiToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Access token is invalid")
+	}
+
+	if !apiToken.IsValid() {
+		return nil, nil, fmt.Errorf("Access token is expired")
+	}
+
+	user := model.User{}
+	err = c.store.UserRepo.Get(apiToken.UserID, &user)
+	if err != nil {
+		log.Println("Failed to get API token's user from store: ", err)
+		return nil, nil, fmt.Errorf("Access token is invalid")
+	}
+
+	if user.IsSuspended() {
+		return nil, nil, fmt.Errorf("User is suspended")
+	}
+
+	now := time.Now()
+	err = c.store.APITokenRepo.UpdateLastUsedAt(apiToken.ID, now)
+	if err != nil {
+		log.Println("Failed to update API token usage: ", err)
+	}
+
+	expiresAt := apiToken.ExpiresAt
+	if expiresAt == nil {
+		far := now.AddDate(100, 0, 0)
+		expiresAt = &far
+	}
+
+	token := &model.AccessToken{
+		UserID:     user.ID,
+		Token:      tokenString,
+		ExpiresAt:  expiresAt,
+		APITokenID: apiToken.ID,
+		Scopes:     apiToken.Scopes,
+	}
+
+	c.tokenCache.set(token, &user)
+
+	return token, &user, nil
+}
+
+// apiTokenScopeMiddleware limits requests authenticated with API tokens to the routes listed
+// in apiTokenRouteScopes, which require the listed scope. It must be used after authMiddleware.
+func (c *apiController) apiTokenScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := contextToken(r)
+		if token == nil || token.APITokenID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := mux.CurrentRoute(r)
+		template := ""
+		if route != nil {
+			template, _ = route.GetPathTemplate()
+		}
+
+		scope, ok := apiTokenRouteScopes[r.Method+" "+strings.TrimPrefix(template, apiV1Prefix)]
+		if !ok {
+			c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "API tokens can't be used for this endpoint")
+			return
+		}
+
+		if !token.HasScope(scope) {
+			c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "API token doesn't grant the "+scope+" scope")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
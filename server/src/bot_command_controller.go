@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+
+	"./model"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// BotCommandData is the request body of registering bot commands
+type BotCommandData struct {
+	Description string `json:"description"`
+	Hint        string `json:"hint"`
+	CallbackURL string `json:"callbackUrl"`
+
+	// Generated when a command is registered without it. Updates keep the current secret when it is empty.
+	Secret string `json:"secret"`
+}
+
+func (c *apiController) listBotCommands(w http.ResponseWriter, r *http.Request) {
+	if !contextUser(r).Bot {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only bot users can register commands")
+		return
+	}
+
+	commands := []model.BotCommand{}
+	err := c.store.BotCommandRepo.ListByBotUserID(contextUserID(r), &commands)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	for i := range commands {
+		commands[i].Secret = ""
+	}
+
+	c.writeResponse(w, http.StatusOK, commands)
+}
+
+// putBotCommand registers the command of the current bot or updates it, if it is already registered
+func (c *apiController) putBotCommand(w http.ResponseWriter, r *http.Request) {
+	if !contextUser(r).Bot {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only bot users can register commands")
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	data := BotCommandData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	errs := validateBotCommandData(name, &data, c.allowPrivateCommandCallbacks)
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
+		return
+	}
+
+	command := model.BotCommand{}
+	err = c.store.BotCommandRepo.GetByName(contextUserID(r), name, &command)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+	created := err != nil
+
+	command.Description = data.Description
+	command.Hint = data.Hint
+	command.CallbackURL = data.CallbackURL
+	command.Secret = data.Secret
+
+	if !created {
+		err = c.store.BotCommandRepo.Update(&command)
+		if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+			return
+		}
+
+		command.Secret = ""
+
+		c.writeResponse(w, http.StatusOK, command)
+		return
+	}
+
+	if command.Secret == "" {
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		if err != nil {
+			c.writeErrorResponse(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate command secret")
+			return
+		}
+		command.Secret = hex.EncodeToString(secret)
+	}
+
+	command.BotUserID = contextUserID(r)
+	command.Name = name
+	err = c.store.BotCommandRepo.Create(&command)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusCreated, command)
+}
+
+func (c *apiController) deleteBotCommand(w http.ResponseWriter, r *http.Request) {
+	if !contextUser(r).Bot {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only bot users can register commands")
+		return
+	}
+
+	command := model.BotCommand{}
+	err := c.store.BotCommandRepo.GetByName(contextUserID(r), mux.Vars(r)["name"], &command)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	err = c.store.BotCommandRepo.Delete(command.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// getChatCommands lists the commands which the members can invoke in the chat
+func (c *apiController) getChatCommands(w http.ResponseWriter, r *http.Request) {
+	commands, err := c.listChatCommands(mux.Vars(r)["chatID"])
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, commands)
+}
+
+func validateBotCommandData(name string, data *BotCommandData, allowPrivateNetworks bool) validationErrors {
+	errs := validationErrors{}
+
+	if !commandNameRe.MatchString(name) {
+		errs.add("name", FieldErrInvalid, "Name must be 1 to 32 lowercase letters, digits, '_' or '-'")
+	} else if findBuiltinCommand(name) != nil {
+		errs.add("name", FieldErrTaken, "Name is used by a built-in command")
+	}
+
+	if len(data.Description) >= 256 {
+		errs.add("description", FieldErrTooLong, "Description must be less than 256 characters long")
+	}
+
+	if len(data.Hint) >= 256 {
+		errs.add("hint", FieldErrTooLong, "Hint must be less than 256 characters long")
+	}
+
+	target, err := url.Parse(data.CallbackURL)
+	if data.CallbackURL == "" {
+		errs.add("callbackUrl", FieldErrRequired, "Callback URL is required")
+	} else if len(data.CallbackURL) > 2048 {
+		errs.add("callbackUrl", FieldErrTooLong, "Callback URL must be at most 2048 characters long")
+	} else if err != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") {
+		errs.add("callbackUrl", FieldErrInvalid, "Callback URL must be an http or https URL")
+	} else if !allowPrivateNetworks && checkPublicHost(target.Hostname()) != nil {
+		errs.add("callbackUrl", FieldErrInvalid, "Callback URL host must resolve to a public address")
+	}
+
+	if len(data.Secret) > 128 {
+		errs.add("secret", FieldErrTooLong, "Secret must be at most 128 characters long")
+	}
+
+	return errs
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateBotCommandDataBlockedHosts(t *testing.T) {
+	tests := []struct {
+		url                  string
+		allowPrivateNetworks bool
+		valid                bool
+	}{
+		{"https://93.184.216.34/command", false, true},
+		{"http://127.0.0.1:8080/command", false, false},
+		{"http://localhost/command", false, false},
+		{"http://[::1]/command", false, false},
+		{"http://169.254.169.254/latest/meta-data", false, false},
+		{"http://192.168.1.1/command", false, false},
+		{"http://127.0.0.1:8080/command", true, true},
+	}
+
+	for _, test := range tests {
+		data := BotCommandData{CallbackURL: test.url}
+		errs := validateBotCommandData("deploy", &data, test.allowPrivateNetworks)
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("%s with private networks allowed %v: got valid %v, want %v: %v", test.url, test.allowPrivateNetworks, valid, test.valid, errs)
+		}
+	}
+}
+
+func TestCommandClientBlockedAddress(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Commands registered before their host started resolving to a private address are rejected when they are dialed
+	_, err := newCommandClient(false).Post(server.URL+"/command", "application/json", strings.NewReader("{}"))
+	if err == nil || !strings.Contains(err.Error(), errLinkPreviewForbiddenAddress.Error()) {
+		t.Errorf("Callback on a loopback address returned %v, want %v", err, errLinkPreviewForbiddenAddress)
+	}
+	if requests != 0 {
+		t.Errorf("Blocked callback received %d requests", requests)
+	}
+
+	resp, err := newCommandClient(true).Post(server.URL+"/command", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("Callback with private networks allowed returned %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Callback with private networks allowed returned %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"./dbcontroller"
+	"./model"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+type BotData struct {
+	Username string `json:"username"`
+	FullName string `json:"fullName"`
+}
+
+type APITokenData struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// APITokenWithValue is returned only when the token is created, the value can't be read later
+type APITokenWithValue struct {
+	model.APIToken
+	Token string `json:"token"`
+}
+
+var botUsernameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func (c *apiController) listBots(w http.ResponseWriter, r *http.Request) {
+	bots := []model.User{}
+	err := c.store.UserRepo.ListBotsByOwnerID(contextUserID(r), &bots)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, bots)
+}
+
+func (c *apiController) createBot(w http.ResponseWriter, r *http.Request) {
+	data := BotData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Validate bot data
+	{
+		errs := validationErrors{}
+
+		nameLen := len(data.Username)
+		if nameLen == 0 {
+			errs.add("username", FieldErrRequired, "Username is required")
+		} else if nameLen < 4 {
+			errs.add("username", FieldErrTooShort, "Username must be at least 4 characters long")
+		} else if nameLen >= 256 {
+			errs.add("username", FieldErrTooLong, "Username must be less than 256 characters long")
+		} else if !botUsernameRe.MatchString(data.Username) {
+			errs.add("username", FieldErrInvalid, "Username may contain only letters, digits, '_' and '-'")
+		}
+
+		if len(data.FullName) > 255 {
+			errs.add("fullName", FieldErrTooLong, "Full name must be less than 256 characters long")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
+	exists, err := c.store.UserRepo.ExistsUsername(data.Username)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	} else if exists {
+		writeJSONResponse(w, http.StatusConflict, &APIError{
+			Code:    ErrCodeConflict,
+			Message: "Username is already registered",
+			Details: []FieldError{
+				{Field: "username", Code: FieldErrTaken, Message: "Username is already registered"},
+			},
+			RequestID: contextRequestID(r),
+		})
+		return
+	}
+
+	bot := model.User{}
+	bot.Username = data.Username
+	bot.FullName = data.FullName
+	bot.OwnerID = contextUserID(r)
+	err = c.store.UserRepo.CreateBot(&bot)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.broadcastUserChange(bot.ID, WSTypeUserCreate)
+
+	c.writeResponse(w, http.StatusCreated, bot)
+}
+
+func (c *apiController) updateBot(w http.ResponseWriter, r *http.Request) {
+	bot, ok := c.loadOwnBot(w, r)
+	if !ok {
+		return
+	}
+
+	data := BotData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	if len(data.FullName) > 255 {
+		c.writeValidationErrorResponse(w, r, validationErrors{
+			{Field: "fullName", Code: FieldErrTooLong, Message: "Full name must be less than 256 characters long"},
+		})
+		return
+	}
+
+	bot.FullName = data.FullName
+	err = c.store.UserRepo.Update(bot)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.broadcastUserChange(bot.ID, WSTypeUserUpdate)
+
+	c.writeResponse(w, http.StatusOK, bot)
+}
+
+// deleteBot removes the bot with its API tokens. Its messages are kept and attributed to the deleted user placeholder.
+func (c *apiController) deleteBot(w http.ResponseWriter, r *http.Request) {
+	bot, ok := c.loadOwnBot(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.deleteUser(bot.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *apiController) listAPITokens(w http.ResponseWriter, r *http.Request) {
+	bot, ok := c.loadOwnBot(w, r)
+	if !ok {
+		return
+	}
+
+	tokens := []model.APIToken{}
+	err := c.store.APITokenRepo.ListByUserID(bot.ID, &tokens)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, tokens)
+}
+
+func (c *apiController) createAPIToken(w http.ResponseWriter, r *http.Request) {
+	bot, ok := c.loadOwnBot(w, r)
+	if !ok {
+		return
+	}
+
+	data := APITokenData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Validate token data
+	{
+		errs := validationErrors{}
+
+		if data.Name == "" {
+			errs.add("name", FieldErrRequired, "Name is required")
+		} else if len(data.Name) >= 256 {
+			errs.add("name", FieldErrTooLong, "Name must be less than 256 characters long")
+		}
+
+		if len(data.Scopes) == 0 {
+			errs.add("scopes", FieldErrRequired, "At least one scope is required")
+		}
+		seen := make(map[string]bool)
+		for _, scope := range data.Scopes {
+			if !isAPITokenScope(scope) || seen[scope] {
+				errs.add("scopes", FieldErrInvalid, "Scopes must be distinct values of "+strings.Join(model.APITokenScopes, ", "))
+				break
+			}
+			seen[scope] = true
+		}
+
+		if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+			errs.add("expiresAt", FieldErrInvalid, "Expiration date must be in the future")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
+	token := model.APIToken{
+		UserID:    bot.ID,
+		Name:      data.Name,
+		Scopes:    data.Scopes,
+		ExpiresAt: data.ExpiresAt,
+	}
+	value, err := c.store.APITokenRepo.Create(&token)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusCreated, &APITokenWithValue{
+		APIToken: token,
+		Token:    value,
+	})
+}
+
+// revokeAPIToken deletes the token and disconnects the bot, so cached sessions of the token end immediately
+func (c *apiController) revokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	bot, ok := c.loadOwnBot(w, r)
+	if !ok {
+		return
+	}
+
+	token := model.APIToken{}
+	err := c.store.APITokenRepo.Get(mux.Vars(r)["tokenID"], &token)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	if token.UserID != bot.ID {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeNotFound, "API token is not found")
+		return
+	}
+
+	err = c.store.APITokenRepo.Delete(token.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.wsHub.invalidateTokens(bot.ID)
+	c.wsHub.disconnectUser(bot.ID)
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// loadOwnBot reads the bot of the URL and checks that the current user owns it
+func (c *apiController) loadOwnBot(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	bot := model.User{}
+	err := c.store.UserRepo.Get(mux.Vars(r)["botID"], &bot)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return nil, false
+	}
+
+	if !bot.Bot || bot.OwnerID != contextUserID(r) {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeUserNotFound, "Bot is not found")
+		return nil, false
+	}
+
+	return &bot, true
+}
+
+func isAPITokenScope(scope string) bool {
+	for _, s := range model.APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ensureSystemBot loads the system bot with the username, it is created on the first start. Bots created by
+// the users have an owner, so a bot without an owner is a system bot.
+func ensureSystemBot(store *dbcontroller.Store, username, fullName string) (*model.User, error) {
+	user, err := store.UserRepo.GetByUsername(username)
+	if err == nil {
+		if !user.Bot || user.OwnerID != "" {
+			return nil, fmt.Errorf("username %s is used by another user", username)
+		}
+
+		return user, nil
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	bot := &model.User{}
+	bot.Username = username
+	bot.FullName = fullName
+	err = store.UserRepo.CreateBot(bot)
+	if err != nil {
+		return nil, err
+	}
+
+	return bot, nil
+}
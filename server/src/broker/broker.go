@@ -0,0 +1,39 @@
+package broker
+
+// BroadcastData is a WebSocket event which is delivered to the hubs of all server nodes
+type BroadcastData struct {
+	BroadcastToAll bool     `json:"broadcastToAll"`
+	UserIDs        []string `json:"userIds"`
+	Data           []byte   `json:"data"`
+
+	// Variant of Data with embedded entities, sent to the clients in the full payload mode
+	FullData []byte `json:"fullData,omitempty"`
+
+	// Sequence number of the event in the event log, 0 for events which are not logged
+	Seq int64 `json:"seq,omitempty"`
+
+	// Disconnect closes the connections of UserIDs instead of sending Data to them
+	Disconnect bool `json:"disconnect"`
+
+	// InvalidateTokens drops the cached access tokens of UserIDs instead of sending Data to them
+	InvalidateTokens bool `json:"invalidateTokens"`
+}
+
+// Broker distributes WebSocket events and user presence between server nodes.
+// Each server node owns a separate Broker instance.
+type Broker interface {
+	// Publish sends the data to the subscribers of all nodes, including the current one
+	Publish(data *BroadcastData) error
+
+	// Subscribe registers the handler of the data published by any node.
+	// It must be called once, before the first Publish.
+	Subscribe(handler func(*BroadcastData)) error
+
+	// SetPresence marks the user as online or offline on the current node
+	SetPresence(userID string, online bool) error
+
+	// ListOnlineUserIDs lists the users which are online on any node
+	ListOnlineUserIDs() ([]string, error)
+
+	Close() error
+}
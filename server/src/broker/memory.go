@@ -0,0 +1,113 @@
+package broker
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryBus connects in-process brokers. It is used when the server runs as a single node
+// and allows running several hubs against each other in one process.
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers map[string]func(*BroadcastData)
+	presence map[string]map[string]bool
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		handlers: make(map[string]func(*BroadcastData)),
+		presence: make(map[string]map[string]bool),
+	}
+}
+
+// Connect returns the broker of the node with the given id
+func (b *MemoryBus) Connect(nodeID string) Broker {
+	b.mu.Lock()
+	b.presence[nodeID] = make(map[string]bool)
+	b.mu.Unlock()
+
+	return &MemoryBroker{
+		bus:    b,
+		nodeID: nodeID,
+	}
+}
+
+type MemoryBroker struct {
+	bus    *MemoryBus
+	nodeID string
+}
+
+// NewMemoryBroker creates a single node in-process broker
+func NewMemoryBroker() Broker {
+	return NewMemoryBus().Connect("local")
+}
+
+func (mb *MemoryBroker) Publish(data *BroadcastData) error {
+	mb.bus.mu.RLock()
+	handlers := make([]func(*BroadcastData), 0, len(mb.bus.handlers))
+	for _, handler := range mb.bus.handlers {
+		handlers = append(handlers, handler)
+	}
+	mb.bus.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(data)
+	}
+
+	return nil
+}
+
+func (mb *MemoryBroker) Subscribe(handler func(*BroadcastData)) error {
+	mb.bus.mu.Lock()
+	mb.bus.handlers[mb.nodeID] = handler
+	mb.bus.mu.Unlock()
+
+	return nil
+}
+
+func (mb *MemoryBroker) SetPresence(userID string, online bool) error {
+	mb.bus.mu.Lock()
+	defer mb.bus.mu.Unlock()
+
+	users, ok := mb.bus.presence[mb.nodeID]
+	if !ok {
+		return nil
+	}
+
+	if online {
+		users[userID] = true
+	} else {
+		delete(users, userID)
+	}
+
+	return nil
+}
+
+func (mb *MemoryBroker) ListOnlineUserIDs() ([]string, error) {
+	mb.bus.mu.RLock()
+	defer mb.bus.mu.RUnlock()
+
+	unique := make(map[string]bool)
+	for _, users := range mb.bus.presence {
+		for userID := range users {
+			unique[userID] = true
+		}
+	}
+
+	result := make([]string, 0, len(unique))
+	for userID := range unique {
+		result = append(result, userID)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+func (mb *MemoryBroker) Close() error {
+	mb.bus.mu.Lock()
+	delete(mb.bus.handlers, mb.nodeID)
+	delete(mb.bus.presence, mb.nodeID)
+	mb.bus.mu.Unlock()
+
+	return nil
+}
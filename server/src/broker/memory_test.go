@@ -0,0 +1,70 @@
+package broker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryBusPublishReachesAllNodes(t *testing.T) {
+	bus := NewMemoryBus()
+	a := bus.Connect("a")
+	b := bus.Connect("b")
+
+	received := map[string][]string{}
+	a.Subscribe(func(data *BroadcastData) {
+		received["a"] = append(received["a"], string(data.Data))
+	})
+	b.Subscribe(func(data *BroadcastData) {
+		received["b"] = append(received["b"], string(data.Data))
+	})
+
+	a.Publish(&BroadcastData{BroadcastToAll: true, Data: []byte("from a")})
+	b.Publish(&BroadcastData{UserIDs: []string{"user"}, Data: []byte("from b")})
+
+	want := []string{"from a", "from b"}
+	for _, node := range []string{"a", "b"} {
+		if !reflect.DeepEqual(received[node], want) {
+			t.Errorf("Node %s received %v, want %v", node, received[node], want)
+		}
+	}
+
+	b.Close()
+	a.Publish(&BroadcastData{BroadcastToAll: true, Data: []byte("after close")})
+	if len(received["b"]) != 2 {
+		t.Errorf("Closed node received %v", received["b"])
+	}
+	if len(received["a"]) != 3 {
+		t.Errorf("Node a received %v after b was closed", received["a"])
+	}
+}
+
+func TestMemoryBusPresenceOfAllNodes(t *testing.T) {
+	bus := NewMemoryBus()
+	a := bus.Connect("a")
+	b := bus.Connect("b")
+
+	a.SetPresence("user1", true)
+	a.SetPresence("shared", true)
+	b.SetPresence("user2", true)
+	b.SetPresence("shared", true)
+
+	want := []string{"shared", "user1", "user2"}
+	for name, node := range map[string]Broker{"a": a, "b": b} {
+		userIDs, err := node.ListOnlineUserIDs()
+		if err != nil {
+			t.Fatalf("Failed to list online users of node %s: %v", name, err)
+		}
+		if !reflect.DeepEqual(userIDs, want) {
+			t.Errorf("Node %s lists %v, want %v", name, userIDs, want)
+		}
+	}
+
+	// The user stays online while it is connected to the other node
+	a.SetPresence("shared", false)
+	b.Close()
+
+	userIDs, _ := a.ListOnlineUserIDs()
+	if !reflect.DeepEqual(userIDs, []string{"user1"}) {
+		t.Errorf("Node a lists %v after b was closed, want [user1]", userIDs)
+	}
+}
@@ -0,0 +1,276 @@
+package broker
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	redisDialTimeout = 5 * time.Second
+
+	// Time to wait before reconnecting the subscription after a failure
+	redisRetryInterval = time.Second
+
+	// Nodes which didn't send a heartbeat within presenceTTL are considered offline
+	presenceHeartbeatPeriod = 10 * time.Second
+	presenceTTL             = 30 * time.Second
+
+	redisKeyPrefix = "chatapp:"
+	redisChannel   = redisKeyPrefix + "events"
+	redisNodesKey  = redisKeyPrefix + "nodes"
+)
+
+// RedisBroker distributes events through Redis Pub/Sub and keeps
+// the presence of every node in a Redis set, refreshed by heartbeats
+type RedisBroker struct {
+	addr   string
+	nodeID string
+
+	mu      sync.Mutex
+	conn    *redisConn
+	subConn *redisConn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func NewRedisBroker(addr, nodeID string) (*RedisBroker, error) {
+	conn, err := dialRedis(addr, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &RedisBroker{
+		addr:   addr,
+		nodeID: nodeID,
+		conn:   conn,
+		closed: make(chan struct{}),
+	}
+
+	// Drop the presence left by a previous run of a node with the same id
+	_, err = b.do("DEL", b.nodeUsersKey())
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+
+	b.heartbeat()
+	go b.runHeartbeat()
+
+	return b, nil
+}
+
+func (b *RedisBroker) Publish(data *BroadcastData) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.do("PUBLISH", redisChannel, string(payload))
+
+	return err
+}
+
+func (b *RedisBroker) Subscribe(handler func(*BroadcastData)) error {
+	conn, err := b.subscribe()
+	if err != nil {
+		return err
+	}
+
+	go b.receive(conn, handler)
+
+	return nil
+}
+
+func (b *RedisBroker) SetPresence(userID string, online bool) error {
+	command := "SREM"
+	if online {
+		command = "SADD"
+	}
+
+	_, err := b.do(command, b.nodeUsersKey(), userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.do("EXPIRE", b.nodeUsersKey(), strconv.Itoa(int(presenceTTL/time.Second)))
+
+	return err
+}
+
+func (b *RedisBroker) ListOnlineUserIDs() ([]string, error) {
+	minScore := strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10)
+	reply, err := b.do("ZRANGEBYSCORE", redisNodesKey, minScore, "+inf")
+	if err != nil {
+		return nil, err
+	}
+
+	nodeIDs := replyStrings(reply)
+	if len(nodeIDs) == 0 {
+		return []string{}, nil
+	}
+
+	args := []string{"SUNION"}
+	for _, nodeID := range nodeIDs {
+		args = append(args, nodeUsersKey(nodeID))
+	}
+
+	reply, err = b.do(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return replyStrings(reply), nil
+}
+
+func (b *RedisBroker) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+
+		b.do("ZREM", redisNodesKey, b.nodeID)
+		b.do("DEL", b.nodeUsersKey())
+
+		b.mu.Lock()
+		b.conn.close()
+		if b.subConn != nil {
+			b.subConn.close()
+		}
+		b.mu.Unlock()
+	})
+
+	return nil
+}
+
+// do executes the command on the shared connection and reconnects once if it is broken
+func (b *RedisBroker) do(args ...string) (interface{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	reply, err := b.conn.do(args...)
+	if err == nil {
+		return reply, nil
+	}
+
+	if _, ok := err.(redisError); ok {
+		return nil, err
+	}
+
+	b.conn.close()
+	conn, dialErr := dialRedis(b.addr, redisDialTimeout)
+	if dialErr != nil {
+		return nil, err
+	}
+	b.conn = conn
+
+	return b.conn.do(args...)
+}
+
+func (b *RedisBroker) subscribe() (*redisConn, error) {
+	conn, err := dialRedis(b.addr, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.send("SUBSCRIBE", redisChannel)
+	if err != nil {
+		conn.close()
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.subConn = conn
+	b.mu.Unlock()
+
+	return conn, nil
+}
+
+func (b *RedisBroker) receive(conn *redisConn, handler func(*BroadcastData)) {
+	for {
+		reply, err := conn.receive()
+		if err != nil {
+			conn.close()
+
+			select {
+			case <-b.closed:
+				return
+			default:
+			}
+
+			log.Printf("Redis subscription failed, reconnecting: %+v\n", err)
+			for {
+				time.Sleep(redisRetryInterval)
+				conn, err = b.subscribe()
+				if err == nil {
+					break
+				}
+
+				select {
+				case <-b.closed:
+					return
+				default:
+				}
+			}
+
+			continue
+		}
+
+		// Pushed messages have the form ["message", channel, payload]
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 {
+			continue
+		}
+
+		if kind, _ := items[0].([]byte); string(kind) != "message" {
+			continue
+		}
+
+		payload, _ := items[2].([]byte)
+		data := &BroadcastData{}
+		err = json.Unmarshal(payload, data)
+		if err != nil {
+			log.Printf("Failed to unmarshal broadcast data: %+v\n", err)
+			continue
+		}
+
+		handler(data)
+	}
+}
+
+func (b *RedisBroker) runHeartbeat() {
+	ticker := time.NewTicker(presenceHeartbeatPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.heartbeat()
+		case <-b.closed:
+			return
+		}
+	}
+}
+
+func (b *RedisBroker) heartbeat() {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	_, err := b.do("ZADD", redisNodesKey, now, b.nodeID)
+	if err != nil {
+		log.Printf("Failed to send presence heartbeat: %+v\n", err)
+		return
+	}
+
+	b.do("EXPIRE", b.nodeUsersKey(), strconv.Itoa(int(presenceTTL/time.Second)))
+
+	// Forget nodes which stopped without cleaning up after themselves
+	b.do("ZREMRANGEBYSCORE", redisNodesKey, "-inf", strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10))
+}
+
+func (b *RedisBroker) nodeUsersKey() string {
+	return nodeUsersKey(b.nodeID)
+}
+
+func nodeUsersKey(nodeID string) string {
+	return redisKeyPrefix + "node:" + nodeID + ":users"
+}
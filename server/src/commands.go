@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"./model"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	botCommandTimeout         = 5 * time.Second
+	botCommandMaxResponseSize = 64 * 1024
+)
+
+// Response types of bot commands
+const (
+	commandResponseEphemeral = "ephemeral"
+	commandResponseInChannel = "in_channel"
+)
+
+// Value of the event header of the bot command callbacks
+const botCommandEvent = "command"
+
+// A command is a message which starts with "/" and the command name, followed by the arguments
+var (
+	commandRe     = regexp.MustCompile(`^/([a-zA-Z0-9_-]{1,32})(?:\s+([\s\S]*))?$`)
+	commandNameRe = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+)
+
+// WSEphemeralData is the response of a command, visible only to the user who invoked it.
+// It is not stored in the event log.
+type WSEphemeralData struct {
+	Type    string `json:"type"`
+	ChatID  string `json:"chatId"`
+	Command string `json:"command"`
+	Text    string `json:"text"`
+}
+
+// ChatCommand is a command which can be invoked in a chat. BotUserID is empty for the built-in commands.
+type ChatCommand struct {
+	Name        string `json:"name"`
+	Hint        string `json:"hint"`
+	Description string `json:"description"`
+	BotUserID   string `json:"botUserId,omitempty"`
+}
+
+// BotCommandPayload is the body of the callback requests of bot commands
+type BotCommandPayload struct {
+	Command   string    `json:"command"`
+	Text      string    `json:"text"`
+	ChatID    string    `json:"chatId"`
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BotCommandResponse is the optional response body of the callbacks. The text is sent only to the
+// invoking user, unless the response type is in_channel, which posts it to the chat as the bot.
+type BotCommandResponse struct {
+	Text         string `json:"text"`
+	ResponseType string `json:"responseType"`
+}
+
+type commandInvocation struct {
+	chat *model.Chat
+	user *model.User
+	name string
+	args string
+}
+
+// commandError is a mistake of the invoking user, reported as 400 response
+type commandError struct {
+	code    string
+	message string
+}
+
+func (e *commandError) Error() string {
+	return e.message
+}
+
+func newCommandUsageError(name, hint string) error {
+	return &commandError{code: ErrCodeInvalidCommand, message: "Usage: /" + name + " " + hint}
+}
+
+type builtinCommand struct {
+	name        string
+	hint        string
+	description string
+
+	// run returns the message created by the command, if any
+	run func(c *apiController, inv *commandInvocation) (*model.Message, error)
+}
+
+// The list is initialized in init, because /help reads it
+var builtinCommands []*builtinCommand
+
+func init() {
+	builtinCommands = []*builtinCommand{
+		{name: "help", description: "List the commands available in the chat", run: (*apiController).runHelpCommand},
+		{name: "me", hint: "<action>", description: "Post an action, e.g. /me waves", run: (*apiController).runMeCommand},
+		{name: "topic", hint: "<title>", description: "Change the title of the chat", run: (*apiController).runTopicCommand},
+		{name: "invite", hint: "@<username> ...", description: "Add users to the chat", run: (*apiController).runInviteCommand},
+		{name: "leave", description: "Leave the chat", run: (*apiController).runLeaveCommand},
+		{name: "mute", description: "Mute the notifications of the chat", run: (*apiController).runMuteCommand},
+		{name: "unmute", description: "Unmute the notifications of the chat", run: (*apiController).runUnmuteCommand},
+		{name: "remind", hint: "me in <time> <text>", description: "Get a reminder later, e.g. /remind me in 2h call Bob", run: (*apiController).runRemindCommand},
+	}
+}
+
+func findBuiltinCommand(name string) *builtinCommand {
+	for _, command := range builtinCommands {
+		if command.name == name {
+			return command
+		}
+	}
+
+	return nil
+}
+
+// newCommandClient calls the callbacks only on public addresses, unless private networks are allowed.
+// The responses are posted to the chats, so internal services must not be reachable through them.
+func newCommandClient(allowPrivateNetworks bool) *http.Client {
+	dialer := newPublicDialer(botCommandTimeout, allowPrivateNetworks)
+
+	return &http.Client{
+		Timeout: botCommandTimeout,
+		Transport: &http.Transport{
+			// Proxies from the environment would dial the addresses instead of the dialer
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   botCommandTimeout,
+			ResponseHeaderTimeout: botCommandTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// parseCommand reads the command name and the arguments of a message. Names are case-insensitive.
+func parseCommand(text string) (string, string, bool) {
+	match := commandRe.FindStringSubmatch(text)
+	if match == nil {
+		return "", "", false
+	}
+
+	return strings.ToLower(match[1]), strings.TrimSpace(match[2]), true
+}
+
+// runCommand invokes the command in the chat of the request. Commands which post a message
+// respond with it, the other commands respond with 204 and send their output as ephemeral events.
+func (c *apiController) runCommand(w http.ResponseWriter, r *http.Request, name, args string) {
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(mux.Vars(r)["chatID"], &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	inv := &commandInvocation{
+		chat: &chat,
+		user: contextUser(r),
+		name: name,
+		args: args,
+	}
+
+	var msg *model.Message
+	if builtin := findBuiltinCommand(name); builtin != nil {
+		msg, err = builtin.run(c, inv)
+	} else {
+		err = c.runBotCommand(inv)
+	}
+
+	if cmdErr, ok := err.(*commandError); ok {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, cmdErr.code, cmdErr.message)
+		return
+	} else if err == errDirectChatMembers || err == errRemoveChatCreator || err == errAddSuspendedUser {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		return
+	} else if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	if msg != nil {
+		c.writeResponse(w, http.StatusCreated, msg)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// sendEphemeral sends the command output only to the connections of the invoking user
+func (c *apiController) sendEphemeral(inv *commandInvocation, text string) {
+	c.wsHub.sendTransientData([]string{inv.user.ID}, &WSEphemeralData{
+		Type:    WSTypeEphemeral,
+		ChatID:  inv.chat.ID,
+		Command: inv.name,
+		Text:    text,
+	})
+}
+
+// listChatCommands lists the built-in commands and the commands of the bots which are members of the chat
+func (c *apiController) listChatCommands(chatID string) ([]ChatCommand, error) {
+	result := []ChatCommand{}
+	for _, command := range builtinCommands {
+		result = append(result, ChatCommand{
+			Name:        command.name,
+			Hint:        command.hint,
+			Description: command.description,
+		})
+	}
+
+	botCommands := []model.BotCommand{}
+	err := c.store.BotCommandRepo.ListByChatID(chatID, &botCommands)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for i := range botCommands {
+		if seen[botCommands[i].Name] {
+			continue
+		}
+		seen[botCommands[i].Name] = true
+
+		result = append(result, ChatCommand{
+			Name:        botCommands[i].Name,
+			Hint:        botCommands[i].Hint,
+			Description: botCommands[i].Description,
+			BotUserID:   botCommands[i].BotUserID,
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func (c *apiController) runHelpCommand(inv *commandInvocation) (*model.Message, error) {
+	commands, err := c.listChatCommands(inv.chat.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	for _, command := range commands {
+		usage := "/" + command.Name
+		if command.Hint != "" {
+			usage += " " + command.Hint
+		}
+
+		lines = append(lines, usage+" - "+command.Description)
+	}
+
+	c.sendEphemeral(inv, strings.Join(lines, "\n"))
+
+	return nil, nil
+}
+
+func (c *apiController) runMeCommand(inv *commandInvocation) (*model.Message, error) {
+	if inv.args == "" {
+		return nil, newCommandUsageError("me", "<action>")
+	}
+
+	msg := &model.Message{
+		UserID:  inv.user.ID,
+		ChatID:  inv.chat.ID,
+		Message: inv.args,
+		Type:    model.MessageTypeAction,
+	}
+	err := c.postMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (c *apiController) runTopicCommand(inv *commandInvocation) (*model.Message, error) {
+	if inv.args == "" {
+		return nil, newCommandUsageError("topic", "<title>")
+	}
+
+	if inv.chat.DirectUserID != "" {
+		return nil, &commandError{code: ErrCodeInvalidCommand, message: "Direct chats don't have a topic"}
+	}
+
+	if len(inv.args) >= 256 {
+		return nil, &commandError{code: ErrCodeInvalidCommand, message: "Title must be less than 256 characters long"}
+	}
+
+	inv.chat.Title = inv.args
+	err := c.store.ChatRepo.Update(inv.chat)
+	if err != nil {
+		return nil, err
+	}
+
+	c.broadcastChatChange(inv.chat, WSTypeChatUpdate)
+
+	return nil, nil
+}
+
+// runInviteCommand adds the users to the chat. All usernames are resolved first, so a typo doesn't
+// add only some of the users.
+func (c *apiController) runInviteCommand(inv *commandInvocation) (*model.Message, error) {
+	usernames := strings.Fields(inv.args)
+	if len(usernames) == 0 {
+		return nil, newCommandUsageError("invite", "@<username> ...")
+	}
+
+	users := []*model.User{}
+	for _, username := range usernames {
+		username = strings.TrimPrefix(username, "@")
+
+		user, err := c.store.UserRepo.GetByUsername(username)
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, &commandError{code: ErrCodeInvalidCommand, message: "User @" + username + " is not found"}
+		} else if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	lines := []string{}
+	for _, user := range users {
+		isMember, err := c.store.ChatUserRepo.Exists(inv.chat.ID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if isMember {
+			lines = append(lines, "@"+user.Username+" is already a member of the chat")
+			continue
+		}
+
+		err = c.addChatMember(inv.chat, user)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, "@"+user.Username+" was added to the chat")
+	}
+
+	c.sendEphemeral(inv, strings.Join(lines, "\n"))
+
+	return nil, nil
+}
+
+func (c *apiController) runLeaveCommand(inv *commandInvocation) (*model.Message, error) {
+	return nil, c.removeChatMember(inv.chat, inv.user.ID, inv.user.ID)
+}
+
+func (c *apiController) runMuteCommand(inv *commandInvocation) (*model.Message, error) {
+	err := c.store.ChatUserRepo.UpdateMuted(inv.chat.ID, inv.user.ID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendEphemeral(inv, "Notifications of the chat are muted")
+
+	return nil, nil
+}
+
+func (c *apiController) runUnmuteCommand(inv *commandInvocation) (*model.Message, error) {
+	err := c.store.ChatUserRepo.UpdateMuted(inv.chat.ID, inv.user.ID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendEphemeral(inv, "Notifications of the chat are unmuted")
+
+	return nil, nil
+}
+
+// runBotCommand finds the command among the commands of the chat's bots and dispatches it in the
+// background. Failures of the callback are reported to the user as ephemeral responses.
+func (c *apiController) runBotCommand(inv *commandInvocation) error {
+	command := model.BotCommand{}
+	err := c.store.BotCommandRepo.FindInChat(inv.chat.ID, inv.name, &command)
+	if gorm.IsRecordNotFoundError(err) {
+		return &commandError{code: ErrCodeUnknownCommand, message: "Unknown command /" + inv.name + ", send //" + inv.name + " to post it as a message"}
+	} else if err != nil {
+		return err
+	}
+
+	go c.dispatchBotCommand(&command, inv)
+
+	return nil
+}
+
+func (c *apiController) dispatchBotCommand(command *model.BotCommand, inv *commandInvocation) {
+	resp, err := c.sendBotCommand(command, inv)
+	if err != nil {
+		log.Printf("Bot command /%s of %s failed: %+v\n", command.Name, command.BotUserID, err)
+		c.sendEphemeral(inv, "/"+command.Name+" failed, try again later")
+		return
+	}
+
+	if resp.Text == "" {
+		return
+	}
+
+	if utf8.RuneCountInString(resp.Text) > incomingWebhookMaxTextLen {
+		resp.Text = truncate(resp.Text, incomingWebhookMaxTextLen)
+	}
+
+	if resp.ResponseType != commandResponseInChannel {
+		c.sendEphemeral(inv, resp.Text)
+		return
+	}
+
+	err = c.postMessage(&model.Message{
+		UserID:  command.BotUserID,
+		ChatID:  inv.chat.ID,
+		Message: resp.Text,
+	})
+	if err != nil {
+		log.Printf("Failed to post the response of bot command /%s: %+v\n", command.Name, err)
+	}
+}
+
+// sendBotCommand posts the invocation to the callback URL, signed the same way as webhook requests
+func (c *apiController) sendBotCommand(command *model.BotCommand, inv *commandInvocation) (*BotCommandResponse, error) {
+	payload, err := json.Marshal(&BotCommandPayload{
+		Command:   command.Name,
+		Text:      inv.args,
+		ChatID:    inv.chat.ID,
+		UserID:    inv.user.ID,
+		Username:  inv.user.Username,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, command.CallbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	invocationID := make([]byte, 8)
+	_, err = rand.Read(invocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ChatApp-Command/"+serverVersion)
+	req.Header.Set(webhookHeaderEvent, botCommandEvent)
+	req.Header.Set(webhookHeaderDelivery, hex.EncodeToString(invocationID))
+	req.Header.Set(webhookHeaderTimestamp, timestamp)
+	req.Header.Set(webhookHeaderSignature, "sha256="+signWebhookPayload(command.Secret, timestamp, string(payload)))
+
+	resp, err := c.commandClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, botCommandMaxResponseSize))
+		return nil, fmt.Errorf("Callback responded with status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, botCommandMaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > botCommandMaxResponseSize {
+		return nil, fmt.Errorf("Callback response is larger than %d bytes", botCommandMaxResponseSize)
+	}
+
+	result := &BotCommandResponse{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return result, nil
+	}
+
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
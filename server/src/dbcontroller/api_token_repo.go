@@ -0,0 +1,118 @@
+package dbcontroller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"../model"
+)
+
+type APITokenRepo struct {
+	BaseEntityRepo
+}
+
+func (r *APITokenRepo) Get(id string, token *model.APIToken) error {
+	err := r.BaseEntityRepo.Get(id, token)
+	if err != nil {
+		return err
+	}
+
+	decodeAPIToken(token)
+
+	return nil
+}
+
+// GetByToken finds the API token by its value. Only hashes of the tokens are stored.
+func (r *APITokenRepo) GetByToken(tokenString string, token *model.APIToken) error {
+	err := r.db.Where("token_hash = ?", HashAPIToken(tokenString)).First(token).Error
+	if err != nil {
+		return err
+	}
+
+	decodeAPIToken(token)
+
+	return nil
+}
+
+func (r *APITokenRepo) ListByUserID(userID string, tokens *[]model.APIToken) error {
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(tokens).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range *tokens {
+		decodeAPIToken(&(*tokens)[i])
+	}
+
+	return nil
+}
+
+// Create stores the token and returns its value, which can't be read later
+func (r *APITokenRepo) Create(token *model.APIToken) (string, error) {
+	var err error
+	token.ID, err = r.GetValidID(r)
+	if err != nil {
+		return "", err
+	}
+
+	// Long-lived tokens are generated with crypto/rand instead of the id generator
+	secret := make([]byte, 30)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	tokenString := model.APITokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	token.TokenHash = HashAPIToken(tokenString)
+	token.Prefix = tokenString[:len(model.APITokenPrefix)+4]
+	token.Scope = strings.Join(token.Scopes, " ")
+	token.LastUsedAt = nil
+	token.CreatedAt = &now
+
+	err = r.db.Create(token).Error
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+func (r *APITokenRepo) UpdateLastUsedAt(id string, date time.Time) error {
+	return r.db.Model(&model.APIToken{}).Where("id = ?", id).Update("last_used_at", date).Error
+}
+
+func (r *APITokenRepo) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(model.APIToken{}).Error
+}
+
+func (r *APITokenRepo) DeleteByUserID(userID string) error {
+	return r.db.Where("user_id = ?", userID).Delete(model.APIToken{}).Error
+}
+
+func (r *APITokenRepo) Exists(id string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&model.APIToken{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return true, err
+	}
+
+	exists := count > 0
+
+	return exists, nil
+}
+
+func HashAPIToken(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func decodeAPIToken(token *model.APIToken) {
+	token.Scopes = strings.Fields(token.Scope)
+}
@@ -0,0 +1,92 @@
+package dbcontroller
+
+import (
+	"time"
+
+	"../model"
+)
+
+type BotCommandRepo struct {
+	BaseEntityRepo
+}
+
+func (r *BotCommandRepo) GetByName(botUserID, name string, command *model.BotCommand) error {
+	return r.db.Where("bot_user_id = ? AND name = ?", botUserID, name).First(command).Error
+}
+
+func (r *BotCommandRepo) ListByBotUserID(botUserID string, commands *[]model.BotCommand) error {
+	return r.db.Where("bot_user_id = ?", botUserID).Order("name").Find(commands).Error
+}
+
+// ListByChatID lists the commands of the bots which are members of the chat. Commands with the same
+// name are ordered by the registration time, the first one is used.
+func (r *BotCommandRepo) ListByChatID(chatID string, commands *[]model.BotCommand) error {
+	return r.db.
+		Select("bot_command.*").
+		Joins("INNER JOIN chat_user ON chat_user.user_id = bot_command.bot_user_id AND chat_user.chat_id = ?", chatID).
+		Order("bot_command.name, bot_command.created_at").
+		Find(commands).Error
+}
+
+// FindInChat reads the command with the given name of the bots which are members of the chat
+func (r *BotCommandRepo) FindInChat(chatID, name string, command *model.BotCommand) error {
+	return r.db.
+		Select("bot_command.*").
+		Joins("INNER JOIN chat_user ON chat_user.user_id = bot_command.bot_user_id AND chat_user.chat_id = ?", chatID).
+		Where("bot_command.name = ?", name).
+		Order("bot_command.created_at").
+		First(command).Error
+}
+
+func (r *BotCommandRepo) Create(command *model.BotCommand) error {
+	var err error
+	command.ID, err = r.GetValidID(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	command.CreatedAt = &now
+	command.UpdatedAt = &now
+
+	return r.db.Create(command).Error
+}
+
+// Update changes the command's settings. The secret is changed only when a new one is given.
+func (r *BotCommandRepo) Update(command *model.BotCommand) error {
+	now := time.Now()
+	command.UpdatedAt = &now
+
+	fields := map[string]interface{}{
+		"description":  command.Description,
+		"hint":         command.Hint,
+		"callback_url": command.CallbackURL,
+		"updated_at":   command.UpdatedAt,
+	}
+	if command.Secret != "" {
+		fields["secret"] = command.Secret
+	}
+
+	return r.db.Model(&model.BotCommand{}).Where("id = ?", command.ID).Updates(fields).Error
+}
+
+func (r *BotCommandRepo) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(model.BotCommand{}).Error
+}
+
+func (r *BotCommandRepo) DeleteByBotUserID(botUserID string) error {
+	return r.db.Where("bot_user_id = ?", botUserID).Delete(model.BotCommand{}).Error
+}
+
+func (r *BotCommandRepo) Exists(id string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&model.BotCommand{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return true, err
+	}
+
+	exists := count > 0
+
+	return exists, nil
+}
@@ -0,0 +1,83 @@
+package dbcontroller
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"../model"
+	"github.com/jinzhu/gorm"
+)
+
+type ChatInviteRepo struct {
+	BaseEntityRepo
+}
+
+func (r *ChatInviteRepo) GetByCode(code string, invite *model.ChatInvite) error {
+	return r.db.Where("code = ?", code).First(invite).Error
+}
+
+func (r *ChatInviteRepo) ListByChatID(chatID string, invites *[]model.ChatInvite) error {
+	return r.db.Where("chat_id = ?", chatID).Order("created_at").Find(invites).Error
+}
+
+// Create stores the invite with a new code
+func (r *ChatInviteRepo) Create(invite *model.ChatInvite) error {
+	var err error
+	invite.ID, err = r.GetValidID(r)
+	if err != nil {
+		return err
+	}
+
+	// Codes are shared outside of the server, so they are generated with crypto/rand instead of the id generator
+	code := make([]byte, 15)
+	_, err = rand.Read(code)
+	if err != nil {
+		return err
+	}
+	invite.Code = base64.RawURLEncoding.EncodeToString(code)
+
+	now := time.Now()
+	invite.Uses = 0
+	invite.CreatedAt = &now
+	invite.UpdatedAt = &now
+
+	return r.db.Create(invite).Error
+}
+
+// Redeem counts a use of the invite, false means it was used up or expired in the meantime
+func (r *ChatInviteRepo) Redeem(id string, now time.Time) (bool, error) {
+	result := r.db.Model(&model.ChatInvite{}).
+		Where("id = ? AND (max_uses = 0 OR uses < max_uses) AND (expires_at IS NULL OR expires_at > ?)", id, now).
+		UpdateColumns(map[string]interface{}{
+			"uses":       gorm.Expr("uses + 1"),
+			"updated_at": now,
+		})
+
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *ChatInviteRepo) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(model.ChatInvite{}).Error
+}
+
+func (r *ChatInviteRepo) DeleteByChatID(chatID string) error {
+	return r.db.Where("chat_id = ?", chatID).Delete(model.ChatInvite{}).Error
+}
+
+func (r *ChatInviteRepo) DeleteByCreatorID(creatorID string) error {
+	return r.db.Where("creator_id = ?", creatorID).Delete(model.ChatInvite{}).Error
+}
+
+func (r *ChatInviteRepo) Exists(id string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&model.ChatInvite{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return true, err
+	}
+
+	exists := count > 0
+
+	return exists, nil
+}
@@ -1,24 +1,151 @@
 package dbcontroller
 
 import (
+	"strings"
 	"time"
 
 	"../model"
+	"github.com/jinzhu/gorm"
 )
 
 type ChatRepo struct {
 	BaseEntityRepo
 }
 
+// Maximum number of characters of the last message included in a chat list item
+const messageSnippetLen = 100
+
+type chatListRow struct {
+	model.Chat
+	MemberCount          int64
+	UnreadCount          int64
+	LastMessageID        *string
+	LastMessageUserID    *string
+	LastMessageSnippet   *string
+	LastMessageCreatedAt *time.Time
+	LastMessageUsername  *string
+	LastMessageFullName  *string
+	PeerID               *string
+	PeerUsername         *string
+	PeerFullName         *string
+	PeerCreatedAt        *time.Time
+	PeerUpdatedAt        *time.Time
+	Muted                bool
+}
+
+const chatListQuery = "SELECT chat.*, cu.muted AS muted," +
+	" (SELECT COUNT(*) FROM chat_user AS members WHERE members.chat_id = chat.id) AS member_count," +
+	" (SELECT COUNT(*) FROM message AS unread WHERE unread.chat_id = chat.id AND unread.user_id <> cu.user_id" +
+	" AND (cu.last_read_at IS NULL OR unread.created_at > cu.last_read_at)) AS unread_count," +
+	" lm.id AS last_message_id, lm.user_id AS last_message_user_id, SUBSTRING(lm.message, 1, ?) AS last_message_snippet," +
+	" lm.created_at AS last_message_created_at, lmu.username AS last_message_username, lmu.full_name AS last_message_full_name," +
+	" peer.id AS peer_id, peer.username AS peer_username, peer.full_name AS peer_full_name," +
+	" peer.created_at AS peer_created_at, peer.updated_at AS peer_updated_at" +
+	" FROM chat" +
+	" INNER JOIN chat_user AS cu ON cu.chat_id = chat.id AND cu.user_id = ?" +
+	" LEFT JOIN message AS lm ON lm.id = (SELECT m.id FROM message AS m WHERE m.chat_id = chat.id ORDER BY m.created_at DESC, m.id DESC LIMIT 1)" +
+	" LEFT JOIN `user` AS lmu ON lmu.id = lm.user_id" +
+	" LEFT JOIN `user` AS peer ON chat.direct_user_id <> '' AND peer.id = IF(chat.creator_id = cu.user_id, chat.direct_user_id, chat.creator_id)" +
+	" ORDER BY chat.updated_at DESC, chat.id" +
+	" LIMIT ? OFFSET ?"
+
+// Public chats whose title contains the search, the chats with most members first
+const discoverableChatsQuery = "SELECT chat.*," +
+	" (SELECT COUNT(*) FROM chat_user AS members WHERE members.chat_id = chat.id) AS member_count," +
+	" EXISTS (SELECT 1 FROM chat_user AS cu WHERE cu.chat_id = chat.id AND cu.user_id = ?) AS member" +
+	" FROM chat" +
+	" WHERE chat.visibility = ? AND chat.title LIKE ?" +
+	" ORDER BY member_count DESC, chat.updated_at DESC, chat.id" +
+	" LIMIT ? OFFSET ?"
+
+// ListPublic lists the public chats for the chat discovery, member tells whether userID is a member of them
+func (r *ChatRepo) ListPublic(search, userID string, limit, offset int, chats *[]model.DiscoverableChat) error {
+	pattern := "%" + likeEscaper.Replace(search) + "%"
+
+	return r.db.Raw(discoverableChatsQuery, userID, model.ChatVisibilityPublic, pattern, limit, offset).Scan(chats).Error
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 func (r *ChatRepo) ListByUserID(userID string, chats *[]model.Chat) error {
 	return r.db.Joins("left join chat_user on chat_user.chat_id = chat.id").Where("chat_user.user_id = ?", userID).Find(&chats).Error
 }
 
+// ListItemsByUserID lists the chats of the user, most recently updated first,
+// together with their last message, member count, unread count and direct chat peer
+func (r *ChatRepo) ListItemsByUserID(userID string, limit, offset int, items *[]model.ChatListItem) error {
+	rows := []chatListRow{}
+	err := r.db.Raw(chatListQuery, messageSnippetLen, userID, limit, offset).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	result := make([]model.ChatListItem, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		result[i] = model.ChatListItem{
+			Chat:        row.Chat,
+			MemberCount: row.MemberCount,
+			UnreadCount: row.UnreadCount,
+			Muted:       row.Muted,
+		}
+
+		if row.LastMessageID != nil {
+			preview := &model.MessagePreview{
+				ID:        *row.LastMessageID,
+				CreatedAt: row.LastMessageCreatedAt,
+			}
+			if row.LastMessageSnippet != nil {
+				preview.Snippet = *row.LastMessageSnippet
+			}
+			if row.LastMessageUserID != nil {
+				preview.Author.ID = *row.LastMessageUserID
+			}
+			if row.LastMessageUsername != nil {
+				preview.Author.Username = *row.LastMessageUsername
+			}
+			if row.LastMessageFullName != nil {
+				preview.Author.FullName = *row.LastMessageFullName
+			}
+
+			result[i].LastMessage = preview
+		}
+
+		if row.PeerID != nil {
+			peer := &model.PublicUser{
+				ID:        *row.PeerID,
+				CreatedAt: row.PeerCreatedAt,
+				UpdatedAt: row.PeerUpdatedAt,
+			}
+			if row.PeerUsername != nil {
+				peer.Username = *row.PeerUsername
+			}
+			if row.PeerFullName != nil {
+				peer.FullName = *row.PeerFullName
+			}
+
+			result[i].DirectUser = peer
+		}
+	}
+
+	*items = result
+
+	return nil
+}
+
 func (r *ChatRepo) Create(chat *model.Chat) error {
 
 	now := time.Now()
 	chat.CreatedAt = &now
 	chat.UpdatedAt = &now
+	if chat.Visibility == "" {
+		chat.Visibility = model.ChatVisibilityPrivate
+	}
+	if chat.DirectUserID != "" {
+		key := directChatKey(chat.CreatorID, chat.DirectUserID)
+		chat.DirectKey = &key
+	}
 
 	var err error
 	chat.ID, err = r.GetValidID(r)
@@ -45,6 +172,9 @@ func (r *ChatRepo) Update(chat *model.Chat) error {
 	now := time.Now()
 	oldChat.UpdatedAt = &now
 	oldChat.Title = chat.Title
+	if chat.Visibility != "" {
+		oldChat.Visibility = chat.Visibility
+	}
 
 	*chat = oldChat
 	err = r.db.Save(chat).Error
@@ -55,6 +185,19 @@ func (r *ChatRepo) Update(chat *model.Chat) error {
 	return nil
 }
 
+// UpdateRetention stores the retention settings of the chat without changing the time of its last activity
+func (r *ChatRepo) UpdateRetention(chat *model.Chat) error {
+	return r.db.Model(&model.Chat{}).Where("id = ?", chat.ID).Updates(map[string]interface{}{
+		"message_retention": chat.MessageRetention,
+		"message_ttl":       chat.MessageTTL,
+	}).Error
+}
+
+// ListWithRetention lists the chats which have their own message retention
+func (r *ChatRepo) ListWithRetention(chats *[]model.Chat) error {
+	return r.db.Where("message_retention > 0").Find(chats).Error
+}
+
 func (r *ChatRepo) UpdateUpdatedAt(chatID string, date *time.Time) error {
 
 	if date == nil {
@@ -71,21 +214,133 @@ func (r *ChatRepo) UpdateUpdatedAt(chatID string, date *time.Time) error {
 	return nil
 }
 
+// ListByCreatorOrDirectUserID lists the chats created by the user and the direct chats of the user
+func (r *ChatRepo) ListByCreatorOrDirectUserID(userID string, chats *[]model.Chat) error {
+	return r.db.Where("creator_id = ? OR direct_user_id = ?", userID, userID).Find(chats).Error
+}
+
+// UpdateCreatorID hands the chat over to another member
+func (r *ChatRepo) UpdateCreatorID(chatID, creatorID string) error {
+	return r.db.Model(&model.Chat{}).Where("id = ?", chatID).UpdateColumn("creator_id", creatorID).Error
+}
+
 func (r *ChatRepo) Delete(id string) error {
 	return r.db.Where("id = ?", id).Delete(model.Chat{}).Error
 }
 
-func (r *ChatRepo) DirectChatExists(firstUserID, secondUserID string) (bool, error) {
-	var count int64
+// GetDirectChat finds the direct chat of the users, created by any of them
+func (r *ChatRepo) GetDirectChat(firstUserID, secondUserID string, chat *model.Chat) error {
+	return r.db.Where("direct_key = ?", directChatKey(firstUserID, secondUserID)).First(chat).Error
+}
+
+// GetOrCreateDirectChat loads the direct chat of the creator and the direct user into chat, the chat is created
+// together with its members if the users don't have one yet. The unique direct key makes concurrent creations
+// of the same chat fail, so the chat created first is returned to everyone. It reports whether the chat was created.
+func (r *ChatRepo) GetOrCreateDirectChat(chat *model.Chat) (bool, error) {
+	existing := model.Chat{}
+	err := r.GetDirectChat(chat.CreatorID, chat.DirectUserID, &existing)
+	if err == nil {
+		*chat = existing
+		return false, nil
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return false, err
+	}
 
-	err := r.db.Model(&model.Chat{}).Where("(creator_id = ? AND direct_user_id = ?) OR (creator_id = ? AND direct_user_id = ?)", firstUserID, secondUserID, secondUserID, firstUserID).Count(&count).Error
+	chat.ID, err = r.GetValidID(r)
 	if err != nil {
-		return true, err
+		return false, err
 	}
 
-	exists := count > 0
+	now := time.Now()
+	key := directChatKey(chat.CreatorID, chat.DirectUserID)
+	chat.DirectKey = &key
+	chat.Visibility = model.ChatVisibilityPrivate
+	chat.CreatedAt = &now
+	chat.UpdatedAt = &now
 
-	return exists, nil
+	// Notes to self have a single member
+	userIDs := []string{chat.CreatorID}
+	if chat.DirectUserID != chat.CreatorID {
+		userIDs = append(userIDs, chat.DirectUserID)
+	}
+
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+
+	err = tx.Create(chat).Error
+	for i := 0; err == nil && i < len(userIDs); i++ {
+		err = tx.Create(&model.ChatUser{
+			ChatID:    chat.ID,
+			UserID:    userIDs[i],
+			CreatedAt: &now,
+			UpdatedAt: &now,
+		}).Error
+	}
+
+	if err != nil {
+		tx.Rollback()
+
+		// Another request may have created the chat in the meantime
+		existing = model.Chat{}
+		if r.GetDirectChat(chat.CreatorID, chat.DirectUserID, &existing) == nil {
+			*chat = existing
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, tx.Commit().Error
+}
+
+// SetDirectKeys sets the direct keys of the direct chats created before the chats had them. Only the oldest
+// direct chat of two users gets the key, the newer duplicates stay without it. It runs once, when the
+// direct_key column is added.
+func (r *ChatRepo) SetDirectKeys() error {
+	chats := []model.Chat{}
+	err := r.db.Where("direct_key IS NULL AND direct_user_id IS NOT NULL AND direct_user_id <> ''").
+		Order("created_at, id").Find(&chats).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range chats {
+		key := directChatKey(chats[i].CreatorID, chats[i].DirectUserID)
+
+		var count int64
+		err = r.db.Model(&model.Chat{}).Where("direct_key = ?", key).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		err = r.db.Model(&model.Chat{}).Where("id = ?", chats[i].ID).UpdateColumn("direct_key", key).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// directChatKey normalizes the pair of the users, the key is the same whichever of them created the chat
+func directChatKey(firstUserID, secondUserID string) string {
+	if firstUserID > secondUserID {
+		firstUserID, secondUserID = secondUserID, firstUserID
+	}
+
+	return firstUserID + ":" + secondUserID
+}
+
+func (r *ChatRepo) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Chat{}).Count(&count).Error
+
+	return count, err
 }
 
 func (r *ChatRepo) Exists(id string) (bool, error) {
@@ -33,6 +33,26 @@ func (r *ChatUserRepo) Create(chatUser *model.ChatUser) error {
 	return r.db.Create(chatUser).Error
 }
 
+func (r *ChatUserRepo) UpdateLastReadAt(chatID, userID string, date *time.Time) error {
+
+	if date == nil {
+		now := time.Now()
+		date = &now
+	}
+
+	return r.db.Model(&model.ChatUser{}).Where("chat_id = ? AND user_id = ?", chatID, userID).Updates(map[string]interface{}{
+		"last_read_at": date,
+		"updated_at":   time.Now(),
+	}).Error
+}
+
+func (r *ChatUserRepo) UpdateMuted(chatID, userID string, muted bool) error {
+	return r.db.Model(&model.ChatUser{}).Where("chat_id = ? AND user_id = ?", chatID, userID).Updates(map[string]interface{}{
+		"muted":      muted,
+		"updated_at": time.Now(),
+	}).Error
+}
+
 func (r *ChatUserRepo) Delete(chatID, userID string) error {
 	return r.db.Where("chat_id = ? AND user_id = ?", chatID, userID).Delete(model.ChatUser{}).Error
 }
@@ -41,6 +61,11 @@ func (r *ChatUserRepo) DeleteByChatID(chatID string) error {
 	return r.db.Where("chat_id = ?", chatID).Delete(model.ChatUser{}).Error
 }
 
+// GetOldestMember finds the member who joined the chat first, except the given user
+func (r *ChatUserRepo) GetOldestMember(chatID, exceptUserID string, chatUser *model.ChatUser) error {
+	return r.db.Where("chat_id = ? AND user_id <> ?", chatID, exceptUserID).Order("created_at, user_id").First(chatUser).Error
+}
+
 func (r *ChatUserRepo) DeleteByUserID(userID string) error {
 	return r.db.Where("user_id = ?", userID).Delete(model.ChatUser{}).Error
 }
@@ -2,7 +2,9 @@ package dbcontroller
 
 import (
 	// used by gorm
+	"database/sql"
 	"fmt"
+	"log"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -21,6 +23,20 @@ type Store struct {
 	TokenRepo    *TokenRepo
 	MessageRepo  *MessageRepo
 	ChatUserRepo *ChatUserRepo
+	EventRepo    *EventRepo
+	WSTicketRepo *WSTicketRepo
+
+	PushSubscriptionRepo *PushSubscriptionRepo
+	WebhookRepo          *WebhookRepo
+	WebhookDeliveryRepo  *WebhookDeliveryRepo
+	IncomingWebhookRepo  *IncomingWebhookRepo
+	APITokenRepo         *APITokenRepo
+	BotCommandRepo       *BotCommandRepo
+	MessageMentionRepo   *MessageMentionRepo
+	LinkPreviewRepo      *LinkPreviewRepo
+	ScheduledMessageRepo *ScheduledMessageRepo
+	ImportRecordRepo     *ImportRecordRepo
+	ChatInviteRepo       *ChatInviteRepo
 }
 
 const MYSQL_TIMEOUT_SECONDS = 60
@@ -44,22 +60,41 @@ func NewStore() (*Store, error) {
 		return nil, fmt.Errorf("Failed to connect to MySQL(timeout %d seconds), error: %+v\n", MYSQL_TIMEOUT_SECONDS, err)
 	}
 
+	return openStore(db), nil
+}
+
+// NewStoreWithDB creates the store on an open MySQL connection pool
+func NewStoreWithDB(conn *sql.DB) (*Store, error) {
+	db, err := gorm.Open("mysql", conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return openStore(db), nil
+}
+
+// openStore sets the options of the connection and creates the store on it
+func openStore(db *gorm.DB) *Store {
 	db.LogMode(true)
 	db.SingularTable(true)
 	db.DB().SetMaxOpenConns(10)
 	db.Callback().Create().Remove("gorm:update_time_stamp")
 	db.Callback().Update().Remove("gorm:update_time_stamp")
 
-	idGenerator := NewIDGenerator(-1)
-	hasher := NewHasher(-1)
+	return newStore(db, NewIDGenerator(-1), NewHasher(-1))
+}
 
+// newStore creates the repos on top of the connection, which may be a transaction
+func newStore(db *gorm.DB, idGenerator *IDGenerator, hasher *Hasher) *Store {
 	baseRepo := BaseEntityRepo{
 		db:          db,
 		idGenerator: idGenerator,
 	}
 
 	return &Store{
-		db: db,
+		db:          db,
+		idGenerator: idGenerator,
+		hasher:      hasher,
 		UserRepo: &UserRepo{
 			BaseEntityRepo: baseRepo,
 			hasher:         hasher,
@@ -78,7 +113,76 @@ func NewStore() (*Store, error) {
 			db:          db,
 			idGenerator: idGenerator,
 		},
-	}, nil
+		EventRepo: &EventRepo{
+			db: db,
+		},
+		WSTicketRepo: &WSTicketRepo{
+			db: db,
+		},
+		PushSubscriptionRepo: &PushSubscriptionRepo{
+			BaseEntityRepo: baseRepo,
+		},
+		WebhookRepo: &WebhookRepo{
+			BaseEntityRepo: baseRepo,
+		},
+		WebhookDeliveryRepo: &WebhookDeliveryRepo{
+			BaseEntityRepo: baseRepo,
+		},
+		IncomingWebhookRepo: &IncomingWebhookRepo{
+			BaseEntityRepo: baseRepo,
+		},
+		APITokenRepo: &APITokenRepo{
+			BaseEntityRepo: baseRepo,
+		},
+		BotCommandRepo: &BotCommandRepo{
+			BaseEntityRepo: baseRepo,
+		},
+		MessageMentionRepo: &MessageMentionRepo{
+			db: db,
+		},
+		LinkPreviewRepo: &LinkPreviewRepo{
+			db: db,
+		},
+		ScheduledMessageRepo: &ScheduledMessageRepo{
+			BaseEntityRepo: baseRepo,
+		},
+		ImportRecordRepo: &ImportRecordRepo{
+			db:          db,
+			idGenerator: idGenerator,
+		},
+		ChatInviteRepo: &ChatInviteRepo{
+			BaseEntityRepo: baseRepo,
+		},
+	}
+}
+
+// Transaction runs fn with a store whose repos share a single transaction. The transaction is committed
+// when fn succeeds and rolled back when it fails.
+func (store *Store) Transaction(fn func(tx *Store) error) error {
+	return transaction(store.db, func(tx *gorm.DB) error {
+		return fn(newStore(tx, store.idGenerator, store.hasher))
+	})
+}
+
+// transaction runs fn in a transaction of db. When db is already a transaction, fn joins it and the owner
+// of the transaction commits or rolls it back, since gorm can't begin a transaction inside another one.
+func transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return fn(db)
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	err := fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
 func (store *Store) AutoMigrate() {
@@ -89,9 +193,33 @@ func (store *Store) AutoMigrate() {
 		&model.User{},
 		&model.AccessToken{},
 		&model.UserAvatar{},
+		&model.Event{},
+		&model.EventRecipient{},
+		&model.WSTicket{},
+		&model.PushSubscription{},
+		&model.Webhook{},
+		&model.WebhookDelivery{},
+		&model.IncomingWebhook{},
+		&model.APIToken{},
+		&model.BotCommand{},
+		&model.MessageMention{},
+		&model.CachedLinkPreview{},
+		&model.ScheduledMessage{},
+		&model.ImportRecord{},
+		&model.ChatInvite{},
 	}
 
+	// The direct keys of the existing direct chats are set once, when the column is added
+	setDirectKeys := store.db.HasTable(&model.Chat{}) && !store.db.Dialect().HasColumn(model.Chat{}.TableName(), "direct_key")
+
 	store.db.AutoMigrate(models...)
+
+	if setDirectKeys {
+		err := store.ChatRepo.SetDirectKeys()
+		if err != nil {
+			log.Printf("Failed to set the direct keys of the chats: %+v\n", err)
+		}
+	}
 }
 
 func (store *Store) Close() {
@@ -0,0 +1,81 @@
+package dbcontroller
+
+import (
+	"strings"
+	"time"
+
+	"../model"
+	"github.com/jinzhu/gorm"
+)
+
+type EventRepo struct {
+	db *gorm.DB
+}
+
+// Events of a user are the events broadcast to all users and the events addressed to the user
+const eventListQuery = "SELECT event.* FROM event" +
+	" WHERE event.seq > ? AND (event.broadcast_to_all = 1 OR EXISTS (SELECT 1 FROM event_recipient AS er" +
+	" WHERE er.user_id = ? AND er.event_seq = event.seq))" +
+	" ORDER BY event.seq ASC LIMIT ?"
+
+// Create stores the event and assigns its sequence number.
+// userIDs are ignored if the event is broadcast to all users.
+func (r *EventRepo) Create(event *model.Event, userIDs []string) error {
+	now := time.Now()
+	event.CreatedAt = &now
+
+	return transaction(r.db, func(tx *gorm.DB) error {
+		err := tx.Create(event).Error
+		if err != nil || event.BroadcastToAll || len(userIDs) == 0 {
+			return err
+		}
+
+		placeholders := make([]string, len(userIDs))
+		values := make([]interface{}, 0, len(userIDs)*2)
+		for i := range userIDs {
+			placeholders[i] = "(?, ?)"
+			values = append(values, userIDs[i], event.Seq)
+		}
+
+		return tx.Exec("INSERT IGNORE INTO event_recipient (user_id, event_seq) VALUES "+strings.Join(placeholders, ", "), values...).Error
+	})
+}
+
+// ListByUserID lists the events of the user with sequence number greater than since
+func (r *EventRepo) ListByUserID(userID string, since int64, limit int, events *[]model.Event) error {
+	return r.db.Raw(eventListQuery, since, userID, limit).Scan(events).Error
+}
+
+// FirstSeq returns the sequence number of the oldest stored event or 0 if there are no events
+func (r *EventRepo) FirstSeq() (int64, error) {
+	return r.scanSeq("SELECT COALESCE(MIN(seq), 0) FROM event")
+}
+
+// LastSeq returns the sequence number of the newest stored event or 0 if there are no events
+func (r *EventRepo) LastSeq() (int64, error) {
+	return r.scanSeq("SELECT COALESCE(MAX(seq), 0) FROM event")
+}
+
+// DeleteCreatedBefore removes the events older than date and returns the number of removed events
+func (r *EventRepo) DeleteCreatedBefore(date time.Time) (int64, error) {
+	maxSeq, err := r.scanSeq("SELECT COALESCE(MAX(seq), 0) FROM event WHERE created_at < ?", date)
+	if err != nil || maxSeq == 0 {
+		return 0, err
+	}
+
+	err = r.db.Where("event_seq <= ?", maxSeq).Delete(model.EventRecipient{}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	result := r.db.Where("seq <= ?", maxSeq).Delete(model.Event{})
+
+	return result.RowsAffected, result.Error
+}
+
+func (r *EventRepo) scanSeq(query string, values ...interface{}) (int64, error) {
+	var seq int64
+	err := r.db.Raw(query, values...).Row().Scan(&seq)
+
+	return seq, err
+}
@@ -0,0 +1,82 @@
+package dbcontroller
+
+import (
+	"strings"
+	"time"
+
+	"../model"
+	"github.com/jinzhu/gorm"
+)
+
+type ImportRecordRepo struct {
+	db          *gorm.DB
+	idGenerator *IDGenerator
+}
+
+// ListEntityIDs returns the ids of the imported entities by their ids in the source
+func (r *ImportRecordRepo) ListEntityIDs(source, kind string, externalIDs []string) (map[string]string, error) {
+	entityIDs := make(map[string]string)
+	if len(externalIDs) == 0 {
+		return entityIDs, nil
+	}
+
+	records := []model.ImportRecord{}
+	err := r.db.Where("source = ? AND kind = ? AND external_id IN (?)", source, kind, externalIDs).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		entityIDs[record.ExternalID] = record.EntityID
+	}
+
+	return entityIDs, nil
+}
+
+// Save stores the record of the imported entity, replacing the previous record of the external id
+func (r *ImportRecordRepo) Save(record *model.ImportRecord) error {
+	now := time.Now()
+	record.CreatedAt = &now
+
+	return r.db.Save(record).Error
+}
+
+// CreateMessages inserts the imported messages and their records in a single transaction, so a message
+// is never imported twice. The messages keep their timestamps, the ids are generated.
+func (r *ImportRecordRepo) CreateMessages(source string, messages []model.Message, externalIDs []string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	messageRows := make([]string, len(messages))
+	messageArgs := make([]interface{}, 0, len(messages)*8)
+	recordRows := make([]string, len(messages))
+	recordArgs := make([]interface{}, 0, len(messages)*5)
+
+	for i := range messages {
+		msg := &messages[i]
+		msg.ID = r.idGenerator.generate()
+		if msg.Type == "" {
+			msg.Type = model.MessageTypeText
+		}
+
+		messageRows[i] = "(?, ?, ?, ?, ?, ?, ?, ?)"
+		messageArgs = append(messageArgs, msg.ID, msg.UserID, msg.ChatID, msg.Message, msg.Type, msg.CreatedAt, msg.UpdatedAt, msg.HTML)
+
+		recordRows[i] = "(?, ?, ?, ?, ?)"
+		recordArgs = append(recordArgs, source, model.ImportKindMessage, externalIDs[i], msg.ID, &now)
+	}
+
+	return transaction(r.db, func(tx *gorm.DB) error {
+		err := tx.Exec("INSERT INTO message (id, user_id, chat_id, message, type, created_at, updated_at, html) VALUES "+
+			strings.Join(messageRows, ", "), messageArgs...).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec("INSERT INTO import_record (source, kind, external_id, entity_id, created_at) VALUES "+
+			strings.Join(recordRows, ", "), recordArgs...).Error
+	})
+}
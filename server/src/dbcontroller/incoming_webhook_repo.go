@@ -0,0 +1,54 @@
+package dbcontroller
+
+import (
+	"time"
+
+	"../model"
+)
+
+type IncomingWebhookRepo struct {
+	BaseEntityRepo
+}
+
+func (r *IncomingWebhookRepo) ListByChatID(chatID string, webhooks *[]model.IncomingWebhook) error {
+	return r.db.Where("chat_id = ?", chatID).Order("created_at").Find(webhooks).Error
+}
+
+func (r *IncomingWebhookRepo) Create(webhook *model.IncomingWebhook) error {
+	var err error
+	webhook.ID, err = r.GetValidID(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	webhook.CreatedAt = &now
+	webhook.UpdatedAt = &now
+
+	return r.db.Create(webhook).Error
+}
+
+func (r *IncomingWebhookRepo) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(model.IncomingWebhook{}).Error
+}
+
+func (r *IncomingWebhookRepo) DeleteByChatID(chatID string) error {
+	return r.db.Where("chat_id = ?", chatID).Delete(model.IncomingWebhook{}).Error
+}
+
+func (r *IncomingWebhookRepo) DeleteByBotUserID(botUserID string) error {
+	return r.db.Where("bot_user_id = ?", botUserID).Delete(model.IncomingWebhook{}).Error
+}
+
+func (r *IncomingWebhookRepo) Exists(id string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&model.IncomingWebhook{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return true, err
+	}
+
+	exists := count > 0
+
+	return exists, nil
+}
@@ -0,0 +1,28 @@
+package dbcontroller
+
+import (
+	"time"
+
+	"../model"
+	"github.com/jinzhu/gorm"
+)
+
+type LinkPreviewRepo struct {
+	db *gorm.DB
+}
+
+func (r *LinkPreviewRepo) Get(urlHash string, preview *model.CachedLinkPreview) error {
+	return r.db.Where("url_hash = ?", urlHash).First(preview).Error
+}
+
+// Save stores the fetched preview, replacing the previous result of the URL
+func (r *LinkPreviewRepo) Save(preview *model.CachedLinkPreview) error {
+	return r.db.Save(preview).Error
+}
+
+// DeleteFetchedBefore removes the previews which were fetched before date
+func (r *LinkPreviewRepo) DeleteFetchedBefore(date time.Time) (int64, error) {
+	result := r.db.Where("fetched_at < ?", date).Delete(model.CachedLinkPreview{})
+
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,98 @@
+package dbcontroller
+
+import (
+	"../model"
+	"github.com/jinzhu/gorm"
+)
+
+type MessageMentionRepo struct {
+	db *gorm.DB
+}
+
+func (r *MessageMentionRepo) ListByMessageID(messageID string, mentions *[]model.MessageMention) error {
+	return r.db.Where("message_id = ?", messageID).Find(mentions).Error
+}
+
+// ListItemsByUserID lists the mentions of the user in the chats which the user is a member of, newest first
+func (r *MessageMentionRepo) ListItemsByUserID(userID string, limit, offset int, items *[]model.MentionItem) error {
+	mentions := []model.MessageMention{}
+	err := r.db.
+		Select("message_mention.*").
+		Joins("INNER JOIN chat_user ON chat_user.chat_id = message_mention.chat_id AND chat_user.user_id = message_mention.user_id").
+		Where("message_mention.user_id = ?", userID).
+		Order("message_mention.created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&mentions).Error
+	if err != nil {
+		return err
+	}
+
+	result := make([]model.MentionItem, len(mentions))
+	if len(mentions) == 0 {
+		*items = result
+		return nil
+	}
+
+	messageIDs := make([]string, len(mentions))
+	for i := range mentions {
+		messageIDs[i] = mentions[i].MessageID
+	}
+
+	messages := []model.Message{}
+	err = r.db.Where("id IN (?)", messageIDs).Find(&messages).Error
+	if err != nil {
+		return err
+	}
+
+	messagesByID := make(map[string]*model.Message)
+	for i := range messages {
+		messagesByID[messages[i].ID] = &messages[i]
+	}
+
+	for i := range mentions {
+		result[i] = model.MentionItem{
+			MessageMention: mentions[i],
+			Message:        messagesByID[mentions[i].MessageID],
+		}
+	}
+
+	*items = result
+
+	return nil
+}
+
+// Replace stores the mentions of the message instead of its current mentions
+func (r *MessageMentionRepo) Replace(messageID string, mentions []model.MessageMention) error {
+	return transaction(r.db, func(tx *gorm.DB) error {
+		err := tx.Where("message_id = ?", messageID).Delete(model.MessageMention{}).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range mentions {
+			err = tx.Create(&mentions[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *MessageMentionRepo) DeleteByMessageID(messageID string) error {
+	return r.db.Where("message_id = ?", messageID).Delete(model.MessageMention{}).Error
+}
+
+func (r *MessageMentionRepo) DeleteByMessageIDs(messageIDs []string) error {
+	return r.db.Where("message_id IN (?)", messageIDs).Delete(model.MessageMention{}).Error
+}
+
+func (r *MessageMentionRepo) DeleteByChatID(chatID string) error {
+	return r.db.Where("chat_id = ?", chatID).Delete(model.MessageMention{}).Error
+}
+
+func (r *MessageMentionRepo) DeleteByUserID(userID string) error {
+	return r.db.Where("user_id = ?", userID).Delete(model.MessageMention{}).Error
+}
@@ -14,12 +14,76 @@ func (r *MessageRepo) ListByChatID(chatID string, messages *[]model.Message) err
 	return r.db.Where("chat_id = ?", chatID).Find(&messages).Error
 }
 
+// ListPageByChatID lists the messages of the chat created after the given message, oldest first.
+// Without the message it lists the first page, so the whole history can be read in pages of a stable order.
+func (r *MessageRepo) ListPageByChatID(chatID string, after *model.Message, limit int, messages *[]model.Message) error {
+	query := r.db.Where("chat_id = ?", chatID)
+	if after != nil {
+		query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
+	return query.Order("created_at, id").Limit(limit).Find(messages).Error
+}
+
+// Unread messages of the user in the chats which are not muted, oldest first within every chat
+const unreadMessagesQuery = "SELECT message.*, chat.title AS chat_title," +
+	" author.username AS author_username, author.full_name AS author_full_name" +
+	" FROM message" +
+	" INNER JOIN chat_user AS cu ON cu.chat_id = message.chat_id AND cu.user_id = ?" +
+	" INNER JOIN chat ON chat.id = message.chat_id" +
+	" LEFT JOIN `user` AS author ON author.id = message.user_id" +
+	" WHERE message.user_id <> cu.user_id AND cu.muted = 0" +
+	" AND (cu.last_read_at IS NULL OR message.created_at > cu.last_read_at)" +
+	" AND message.created_at > ?" +
+	" ORDER BY chat.updated_at DESC, message.chat_id, message.created_at" +
+	" LIMIT ?"
+
+type unreadMessageRow struct {
+	model.Message
+	ChatTitle      string
+	AuthorUsername *string
+	AuthorFullName *string
+}
+
+// ListUnreadByUserID lists the messages created after since which the user didn't read
+func (r *MessageRepo) ListUnreadByUserID(userID string, since time.Time, limit int, messages *[]model.UnreadMessage) error {
+	rows := []unreadMessageRow{}
+	err := r.db.Raw(unreadMessagesQuery, userID, since, limit).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	result := make([]model.UnreadMessage, len(rows))
+	for i := range rows {
+		result[i] = model.UnreadMessage{
+			Message:   rows[i].Message,
+			ChatTitle: rows[i].ChatTitle,
+		}
+
+		result[i].Author.ID = rows[i].UserID
+		if rows[i].AuthorUsername != nil {
+			result[i].Author.Username = *rows[i].AuthorUsername
+		}
+		if rows[i].AuthorFullName != nil {
+			result[i].Author.FullName = *rows[i].AuthorFullName
+		}
+	}
+
+	*messages = result
+
+	return nil
+}
+
 func (r *MessageRepo) Create(message *model.Message) error {
 
 	now := time.Now()
 	message.CreatedAt = &now
 	message.UpdatedAt = &now
 
+	if message.Type == "" {
+		message.Type = model.MessageTypeText
+	}
+
 	var err error
 	message.ID, err = r.GetValidID(r)
 	if err != nil {
@@ -45,6 +109,7 @@ func (r *MessageRepo) Update(message *model.Message) error {
 	now := time.Now()
 	oldMsg.UpdatedAt = &now
 	oldMsg.Message = message.Message
+	oldMsg.HTML = message.HTML
 
 	*message = oldMsg
 	err = r.db.Save(message).Error
@@ -55,14 +120,69 @@ func (r *MessageRepo) Update(message *model.Message) error {
 	return nil
 }
 
+// ListWithoutHTML lists the messages which were created before the markup was rendered
+func (r *MessageRepo) ListWithoutHTML(limit int, messages *[]model.Message) error {
+	return r.db.Where("html IS NULL OR html = ''").Where("message <> ''").Limit(limit).Find(messages).Error
+}
+
+func (r *MessageRepo) UpdateHTML(id, html string) error {
+	return r.db.Model(&model.Message{}).Where("id = ?", id).UpdateColumn("html", html).Error
+}
+
+// UpdatePreviews sets the link previews without changing the time of the last edit
+func (r *MessageRepo) UpdatePreviews(id string, previews model.LinkPreviews) error {
+	return r.db.Model(&model.Message{}).Where("id = ?", id).UpdateColumn("previews", previews).Error
+}
+
+// ListExpired lists the messages whose TTL ended before now, the earliest first
+func (r *MessageRepo) ListExpired(now time.Time, limit int, messages *[]model.Message) error {
+	return r.db.Where("expires_at <= ?", now).Order("expires_at").Limit(limit).Find(messages).Error
+}
+
+// ListCreatedBefore lists the messages of the chat created before date, oldest first. An empty chat id lists the messages of all chats.
+func (r *MessageRepo) ListCreatedBefore(chatID string, date time.Time, limit int, messages *[]model.Message) error {
+	query := r.db.Where("created_at < ?", date)
+	if chatID != "" {
+		query = query.Where("chat_id = ?", chatID)
+	}
+
+	return query.Order("created_at").Limit(limit).Find(messages).Error
+}
+
 func (r *MessageRepo) Delete(id string) error {
 	return r.db.Where("id = ?", id).Delete(model.Message{}).Error
 }
 
+// DeleteByIDs removes the messages and returns how many of them were removed
+func (r *MessageRepo) DeleteByIDs(ids []string) (int64, error) {
+	result := r.db.Where("id IN (?)", ids).Delete(model.Message{})
+
+	return result.RowsAffected, result.Error
+}
+
+// ReassignUserID changes the author of the messages of the user, the messages keep their timestamps
+func (r *MessageRepo) ReassignUserID(fromUserID, toUserID string) error {
+	return r.db.Model(&model.Message{}).Where("user_id = ?", fromUserID).UpdateColumn("user_id", toUserID).Error
+}
+
 func (r *MessageRepo) DeleteByChatID(chatID string) error {
 	return r.db.Where("chat_id = ?", chatID).Delete(model.Message{}).Error
 }
 
+func (r *MessageRepo) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Message{}).Count(&count).Error
+
+	return count, err
+}
+
+func (r *MessageRepo) CountByChatID(chatID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Message{}).Where("chat_id = ?", chatID).Count(&count).Error
+
+	return count, err
+}
+
 func (r *MessageRepo) Exists(id string) (bool, error) {
 	var count int64
 
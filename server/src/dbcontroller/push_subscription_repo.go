@@ -0,0 +1,64 @@
+package dbcontroller
+
+import (
+	"time"
+
+	"../model"
+	"github.com/jinzhu/gorm"
+)
+
+type PushSubscriptionRepo struct {
+	BaseEntityRepo
+}
+
+func (r *PushSubscriptionRepo) ListByUserID(userID string, subscriptions *[]model.PushSubscription) error {
+	return r.db.Where("user_id = ?", userID).Order("created_at").Find(subscriptions).Error
+}
+
+// Save creates the subscription or updates the keys of the user's subscription with the same endpoint
+func (r *PushSubscriptionRepo) Save(subscription *model.PushSubscription) error {
+	now := time.Now()
+
+	existing := model.PushSubscription{}
+	err := r.db.Where("user_id = ? AND endpoint = ?", subscription.UserID, subscription.Endpoint).First(&existing).Error
+	if err == nil {
+		existing.P256dh = subscription.P256dh
+		existing.Auth = subscription.Auth
+		existing.UpdatedAt = &now
+		*subscription = existing
+
+		return r.db.Save(subscription).Error
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	subscription.ID, err = r.GetValidID(r)
+	if err != nil {
+		return err
+	}
+	subscription.CreatedAt = &now
+	subscription.UpdatedAt = &now
+
+	return r.db.Create(subscription).Error
+}
+
+func (r *PushSubscriptionRepo) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(model.PushSubscription{}).Error
+}
+
+func (r *PushSubscriptionRepo) DeleteByUserID(userID string) error {
+	return r.db.Where("user_id = ?", userID).Delete(model.PushSubscription{}).Error
+}
+
+func (r *PushSubscriptionRepo) Exists(id string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&model.PushSubscription{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return true, err
+	}
+
+	exists := count > 0
+
+	return exists, nil
+}
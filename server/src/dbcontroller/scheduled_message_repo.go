@@ -0,0 +1,73 @@
+package dbcontroller
+
+import (
+	"time"
+
+	"../model"
+)
+
+type ScheduledMessageRepo struct {
+	BaseEntityRepo
+}
+
+func (r *ScheduledMessageRepo) Create(scheduled *model.ScheduledMessage) error {
+	var err error
+	scheduled.ID, err = r.GetValidID(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	scheduled.ClaimedUntil = nil
+	scheduled.CreatedAt = &now
+	scheduled.UpdatedAt = &now
+
+	return r.db.Create(scheduled).Error
+}
+
+// ListByCreatorID lists the messages and reminders scheduled by the user, the next one first
+func (r *ScheduledMessageRepo) ListByCreatorID(creatorID string, scheduled *[]model.ScheduledMessage) error {
+	return r.db.Where("creator_id = ?", creatorID).Order("send_at").Find(scheduled).Error
+}
+
+// ListDue lists the messages which should be sent and which are not claimed by any server node
+func (r *ScheduledMessageRepo) ListDue(now time.Time, limit int, scheduled *[]model.ScheduledMessage) error {
+	return r.db.Where("send_at <= ? AND (claimed_until IS NULL OR claimed_until < ?)", now, now).
+		Order("send_at").Limit(limit).Find(scheduled).Error
+}
+
+// Claim reserves the message for this server node until leaseUntil, unless another node already claimed it.
+// A message claimed by a node which failed to publish it can be claimed again after the lease.
+func (r *ScheduledMessageRepo) Claim(scheduled *model.ScheduledMessage, now, leaseUntil time.Time) (bool, error) {
+	result := r.db.Model(&model.ScheduledMessage{}).
+		Where("id = ? AND (claimed_until IS NULL OR claimed_until < ?)", scheduled.ID, now).
+		UpdateColumn("claimed_until", leaseUntil)
+
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *ScheduledMessageRepo) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(model.ScheduledMessage{}).Error
+}
+
+func (r *ScheduledMessageRepo) DeleteByChatID(chatID string) error {
+	return r.db.Where("chat_id = ?", chatID).Delete(model.ScheduledMessage{}).Error
+}
+
+// DeleteByUserID removes the messages which the user scheduled or which would be sent as the user
+func (r *ScheduledMessageRepo) DeleteByUserID(userID string) error {
+	return r.db.Where("user_id = ? OR creator_id = ?", userID, userID).Delete(model.ScheduledMessage{}).Error
+}
+
+func (r *ScheduledMessageRepo) Exists(id string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&model.ScheduledMessage{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return true, err
+	}
+
+	exists := count > 0
+
+	return exists, nil
+}
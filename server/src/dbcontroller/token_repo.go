@@ -64,3 +64,7 @@ func (r *TokenRepo) Exists(userID string) (bool, error) {
 func (r *TokenRepo) Delete(t *model.AccessToken) error {
 	return r.db.Delete(t).Error
 }
+
+func (r *TokenRepo) DeleteByUserID(userID string) error {
+	return r.db.Where("user_id = ?", userID).Delete(model.AccessToken{}).Error
+}
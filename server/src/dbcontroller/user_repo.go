@@ -15,11 +15,25 @@ func (r *UserRepo) List(users *[]model.User) error {
 	return r.db.Find(users).Error
 }
 
+func (r *UserRepo) ListByIDs(ids []string, users *[]model.User) error {
+	return r.db.Where("id IN (?)", ids).Find(users).Error
+}
+
 func (r *UserRepo) Create(user *model.User) error {
 
 	now := time.Now()
 	user.CreatedAt = &now
 	user.FullName = ""
+	user.Bot = false
+	user.OwnerID = ""
+	user.Role = model.UserRoleUser
+	user.SuspendedAt = nil
+	user.DigestSettings = model.DigestSettings{
+		DigestFrequency: model.DigestFrequencyOff,
+		DigestHour:      8,
+		DigestWeekday:   int(time.Monday),
+	}
+	user.DigestSentAt = nil
 
 	var err error
 	user.ID, err = r.GetValidID(r)
@@ -42,6 +56,40 @@ func (r *UserRepo) Create(user *model.User) error {
 	return nil
 }
 
+// CreateBot creates a user which acts on behalf of an integration and is managed by user.OwnerID.
+// It has no password, so nobody can log in as the bot, it authenticates with API tokens.
+func (r *UserRepo) CreateBot(user *model.User) error {
+	now := time.Now()
+	user.CreatedAt = &now
+	user.UpdatedAt = &now
+	user.Bot = true
+	user.Role = model.UserRoleUser
+	user.SuspendedAt = nil
+	user.DigestSettings = model.DigestSettings{
+		DigestFrequency: model.DigestFrequencyOff,
+		DigestHour:      8,
+		DigestWeekday:   int(time.Monday),
+	}
+	user.Password = ""
+	user.PasswordHash = ""
+
+	var err error
+	user.ID, err = r.GetValidID(r)
+	if err != nil {
+		return err
+	}
+
+	if user.Username == "" {
+		user.Username = "bot_" + user.ID
+	}
+
+	return r.db.Create(user).Error
+}
+
+func (r *UserRepo) ListBotsByOwnerID(ownerID string, users *[]model.User) error {
+	return r.db.Where("bot = 1 AND owner_id = ?", ownerID).Order("created_at").Find(users).Error
+}
+
 func (r *UserRepo) UpdateUpdatedAt(userID string, date *time.Time) error {
 
 	if date == nil {
@@ -77,10 +125,55 @@ func (r *UserRepo) Update(user *model.User) error {
 	return nil
 }
 
+func (r *UserRepo) UpdateRole(userID, role string) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).Update("role", role).Error
+}
+
+func (r *UserRepo) UpdateSuspendedAt(userID string, date *time.Time) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).Update("suspended_at", date).Error
+}
+
+func (r *UserRepo) UpdateDigestSettings(userID string, settings *model.DigestSettings) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"email":            settings.Email,
+		"digest_frequency": settings.DigestFrequency,
+		"digest_hour":      settings.DigestHour,
+		"digest_weekday":   settings.DigestWeekday,
+		"updated_at":       time.Now(),
+	}).Error
+}
+
+// ListDigestRecipients lists the users which opted in to the email digest
+func (r *UserRepo) ListDigestRecipients(users *[]model.User) error {
+	return r.db.Where("digest_frequency <> ? AND email <> '' AND suspended_at IS NULL", model.DigestFrequencyOff).Find(users).Error
+}
+
+// ClaimDigest marks the digest of the user as sent at date, unless another
+// server node already did it since prevSentAt. It reports whether the claim succeeded.
+func (r *UserRepo) ClaimDigest(userID string, prevSentAt *time.Time, date time.Time) (bool, error) {
+	query := r.db.Model(&model.User{}).Where("id = ?", userID)
+	if prevSentAt == nil {
+		query = query.Where("digest_sent_at IS NULL")
+	} else {
+		query = query.Where("digest_sent_at = ?", prevSentAt)
+	}
+
+	result := query.Update("digest_sent_at", date)
+
+	return result.RowsAffected == 1, result.Error
+}
+
 func (r *UserRepo) Delete(id string) error {
 	return r.db.Where("id = ?", id).Delete(model.User{}).Error
 }
 
+func (r *UserRepo) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&model.User{}).Count(&count).Error
+
+	return count, err
+}
+
 func (r *UserRepo) GetByUsername(username string) (*model.User, error) {
 	user := model.User{}
 	err := r.db.Where("username = ?", username).First(&user).Error
@@ -155,3 +248,7 @@ func (r *UserRepo) CreateAvatar(avatar *model.UserAvatar) error {
 func (r *UserRepo) UpdateAvatar(avatar *model.UserAvatar) error {
 	return r.db.Save(avatar).Error
 }
+
+func (r *UserRepo) DeleteAvatar(userID string) error {
+	return r.db.Where("user_id = ?", userID).Delete(model.UserAvatar{}).Error
+}
@@ -0,0 +1,239 @@
+package dbcontroller
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"../model"
+)
+
+type WebhookRepo struct {
+	BaseEntityRepo
+}
+
+func (r *WebhookRepo) Get(id string, webhook *model.Webhook) error {
+	err := r.BaseEntityRepo.Get(id, webhook)
+	if err != nil {
+		return err
+	}
+
+	decodeWebhook(webhook)
+
+	return nil
+}
+
+func (r *WebhookRepo) ListByChatID(chatID string, webhooks *[]model.Webhook) error {
+	err := r.db.Where("chat_id = ?", chatID).Order("created_at").Find(webhooks).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range *webhooks {
+		decodeWebhook(&(*webhooks)[i])
+	}
+
+	return nil
+}
+
+// ListSubscribed lists the active webhooks of the chat which are subscribed to the event type
+func (r *WebhookRepo) ListSubscribed(chatID, eventType string, webhooks *[]model.Webhook) error {
+	all := []model.Webhook{}
+	err := r.db.Where("chat_id = ? AND active = 1", chatID).Find(&all).Error
+	if err != nil {
+		return err
+	}
+
+	result := []model.Webhook{}
+	for i := range all {
+		decodeWebhook(&all[i])
+		for _, event := range all[i].Events {
+			if event == eventType {
+				result = append(result, all[i])
+				break
+			}
+		}
+	}
+
+	*webhooks = result
+
+	return nil
+}
+
+func (r *WebhookRepo) Create(webhook *model.Webhook) error {
+	var err error
+	webhook.ID, err = r.GetValidID(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	webhook.CreatedAt = &now
+	webhook.UpdatedAt = &now
+	webhook.EventTypes = strings.Join(webhook.Events, ",")
+
+	return r.db.Create(webhook).Error
+}
+
+// Update saves the URL, the events and the active flag of the webhook. The secret is changed only when it is set.
+func (r *WebhookRepo) Update(webhook *model.Webhook) error {
+	now := time.Now()
+	webhook.UpdatedAt = &now
+	webhook.EventTypes = strings.Join(webhook.Events, ",")
+
+	fields := map[string]interface{}{
+		"url":         webhook.URL,
+		"event_types": webhook.EventTypes,
+		"active":      webhook.Active,
+		"updated_at":  webhook.UpdatedAt,
+	}
+	if webhook.Secret != "" {
+		fields["secret"] = webhook.Secret
+	}
+
+	return r.db.Model(&model.Webhook{}).Where("id = ?", webhook.ID).Updates(fields).Error
+}
+
+// Delete removes the webhook with its delivery history
+func (r *WebhookRepo) Delete(id string) error {
+	return transaction(r.db, func(tx *gorm.DB) error {
+		err := tx.Where("webhook_id = ?", id).Delete(model.WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", id).Delete(model.Webhook{}).Error
+	})
+}
+
+func (r *WebhookRepo) DeleteByChatID(chatID string) error {
+	webhooks := []model.Webhook{}
+	err := r.db.Where("chat_id = ?", chatID).Find(&webhooks).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range webhooks {
+		err = r.Delete(webhooks[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *WebhookRepo) Exists(id string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&model.Webhook{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return true, err
+	}
+
+	exists := count > 0
+
+	return exists, nil
+}
+
+func decodeWebhook(webhook *model.Webhook) {
+	webhook.Events = []string{}
+	if webhook.EventTypes != "" {
+		webhook.Events = strings.Split(webhook.EventTypes, ",")
+	}
+}
+
+type WebhookDeliveryRepo struct {
+	BaseEntityRepo
+}
+
+func (r *WebhookDeliveryRepo) Create(delivery *model.WebhookDelivery) error {
+	var err error
+	delivery.ID, err = r.GetValidID(r)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	delivery.Status = model.WebhookDeliveryPending
+	delivery.NextAttemptAt = &now
+	delivery.CreatedAt = &now
+	delivery.UpdatedAt = &now
+
+	return r.db.Create(delivery).Error
+}
+
+// ListByWebhookID lists the deliveries of the webhook, newest first. An empty status lists all deliveries.
+func (r *WebhookDeliveryRepo) ListByWebhookID(webhookID, status string, limit, offset int, deliveries *[]model.WebhookDelivery) error {
+	query := r.db.Where("webhook_id = ?", webhookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	return query.Order("created_at DESC").Limit(limit).Offset(offset).Find(deliveries).Error
+}
+
+// ListDue lists the pending deliveries whose next attempt is not after now
+func (r *WebhookDeliveryRepo) ListDue(now time.Time, limit int, deliveries *[]model.WebhookDelivery) error {
+	return r.db.Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, now).
+		Order("next_attempt_at").Limit(limit).Find(deliveries).Error
+}
+
+// Claim postpones the next attempt of the delivery to leaseUntil, unless another server node already
+// claimed it. It reports whether the claim succeeded, so every attempt is made by a single node.
+func (r *WebhookDeliveryRepo) Claim(delivery *model.WebhookDelivery, leaseUntil time.Time) (bool, error) {
+	result := r.db.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, model.WebhookDeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", leaseUntil)
+
+	return result.RowsAffected == 1, result.Error
+}
+
+// Retry schedules a new attempt of the delivery now, also when it is dead
+func (r *WebhookDeliveryRepo) Retry(id string) error {
+	now := time.Now()
+
+	return r.db.Model(&model.WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          model.WebhookDeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	}).Error
+}
+
+// SaveAttempt stores the result of the delivery attempt
+func (r *WebhookDeliveryRepo) SaveAttempt(delivery *model.WebhookDelivery) error {
+	now := time.Now()
+	delivery.UpdatedAt = &now
+
+	return r.db.Model(&model.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"response_status": delivery.ResponseStatus,
+		"error":           delivery.Error,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"delivered_at":    delivery.DeliveredAt,
+		"updated_at":      delivery.UpdatedAt,
+	}).Error
+}
+
+// DeleteDeliveredBefore removes the delivery history older than date. Dead deliveries are kept.
+func (r *WebhookDeliveryRepo) DeleteDeliveredBefore(date time.Time) (int64, error) {
+	result := r.db.Where("status = ? AND created_at < ?", model.WebhookDeliveryDelivered, date).Delete(model.WebhookDelivery{})
+
+	return result.RowsAffected, result.Error
+}
+
+func (r *WebhookDeliveryRepo) Exists(id string) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&model.WebhookDelivery{}).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return true, err
+	}
+
+	exists := count > 0
+
+	return exists, nil
+}
@@ -0,0 +1,61 @@
+package dbcontroller
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"../model"
+	"github.com/jinzhu/gorm"
+)
+
+const wsTicketTTL = 30 * time.Second
+
+type WSTicketRepo struct {
+	db *gorm.DB
+}
+
+func (r *WSTicketRepo) Create(ticket *model.WSTicket) error {
+	now := time.Now()
+
+	// Tickets which were never used are removed when new ones are issued
+	err := r.db.Where("expires_at < ?", now).Delete(model.WSTicket{}).Error
+	if err != nil {
+		return err
+	}
+
+	// Tickets authenticate the connections like the access tokens, so they are generated
+	// with crypto/rand instead of the id generator, whose values can be predicted
+	value := make([]byte, 48)
+	_, err = rand.Read(value)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := now.Add(wsTicketTTL)
+	ticket.Ticket = base64.RawURLEncoding.EncodeToString(value)
+	ticket.ExpiresAt = &expiresAt
+
+	return r.db.Create(ticket).Error
+}
+
+// Consume returns the ticket and removes it, so it can't be used again
+func (r *WSTicketRepo) Consume(value string, ticket *model.WSTicket) error {
+	err := r.db.Where("ticket = ?", value).First(ticket).Error
+	if err != nil {
+		return err
+	}
+
+	// Only one of the concurrent requests with the same ticket removes it
+	result := r.db.Where("ticket = ?", value).Delete(model.WSTicket{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 || !ticket.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("WebSocket ticket is invalid or expired")
+	}
+
+	return nil
+}
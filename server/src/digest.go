@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"./dbcontroller"
+	"./mailer"
+	"./model"
+)
+
+const (
+	// Interval of checking which users are due to receive their digest
+	digestCheckInterval = 5 * time.Minute
+
+	// Limits of the unread messages included into a single digest
+	digestMaxMessages        = 500
+	digestMaxMessagesPerChat = 10
+	digestSnippetLen         = 300
+)
+
+type digestChat struct {
+	Title    string
+	Messages []digestMessage
+	More     int
+}
+
+type digestMessage struct {
+	Author    string
+	Text      string
+	CreatedAt string
+}
+
+type digestContent struct {
+	Name           string
+	Count          int
+	Chats          []*digestChat
+	AppURL         string
+	UnsubscribeURL string
+}
+
+var digestTextTemplate = template.Must(template.New("digest").Parse(`Hi {{.Name}},
+
+You have {{.Count}} unread messages in ChatApp.
+{{range .Chats}}
+{{.Title}}
+{{range .Messages}}  [{{.CreatedAt}}] {{.Author}}: {{.Text}}
+{{end}}{{if .More}}  ... and {{.More}} more
+{{end}}{{end}}
+Open ChatApp: {{.AppURL}}
+
+To stop receiving these emails, unsubscribe: {{.UnsubscribeURL}}
+`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>Hi {{.Name}},</p>
+<p>You have {{.Count}} unread messages in <a href="{{.AppURL}}">ChatApp</a>.</p>
+{{range .Chats}}
+<h3>{{.Title}}</h3>
+<ul>
+{{range .Messages}}<li><small>{{.CreatedAt}}</small> <b>{{.Author}}</b>: {{.Text}}</li>
+{{end}}{{if .More}}<li>... and {{.More}} more</li>
+{{end}}</ul>
+{{end}}
+<p><small>To stop receiving these emails, <a href="{{.UnsubscribeURL}}">unsubscribe</a>.</small></p>
+</body>
+</html>
+`))
+
+// DigestSender sends the opt-in email digests of unread messages according to the schedule of every user
+type DigestSender struct {
+	store     *dbcontroller.Store
+	mailer    mailer.Mailer
+	from      string
+	publicURL string
+	secret    []byte
+}
+
+func newDigestSender(store *dbcontroller.Store, m mailer.Mailer, from, publicURL string, secret []byte) *DigestSender {
+	return &DigestSender{
+		store:     store,
+		mailer:    m,
+		from:      from,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		secret:    secret,
+	}
+}
+
+func (d *DigestSender) run() {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		d.sendDue(time.Now().UTC())
+		<-ticker.C
+	}
+}
+
+// sendDue sends the digests whose scheduled time passed since they were sent last time
+func (d *DigestSender) sendDue(now time.Time) {
+	users := []model.User{}
+	err := d.store.UserRepo.ListDigestRecipients(&users)
+	if err != nil {
+		log.Printf("Failed to list digest recipients: %+v\n", err)
+		return
+	}
+
+	for i := range users {
+		user := &users[i]
+
+		slot, period := lastDigestSlot(&user.DigestSettings, now)
+		if user.DigestSentAt != nil && !user.DigestSentAt.Before(slot) {
+			continue
+		}
+
+		since := slot.Add(-period)
+		if user.DigestSentAt != nil && user.DigestSentAt.After(since) {
+			since = *user.DigestSentAt
+		}
+
+		// Other server nodes run the same schedule, only the one which claims the user sends the digest
+		claimed, err := d.store.UserRepo.ClaimDigest(user.ID, user.DigestSentAt, now)
+		if err != nil {
+			log.Printf("Failed to claim digest of %s: %+v\n", user.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = d.send(user, since)
+		if err != nil {
+			log.Printf("Failed to send digest to %s: %+v\n", user.ID, err)
+		}
+	}
+}
+
+func (d *DigestSender) send(user *model.User, since time.Time) error {
+	messages := []model.UnreadMessage{}
+	err := d.store.MessageRepo.ListUnreadByUserID(user.ID, since, digestMaxMessages, &messages)
+	if err != nil {
+		return err
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	content := &digestContent{
+		Name:           displayName(&user.PublicUser),
+		Count:          len(messages),
+		Chats:          groupDigestMessages(messages),
+		AppURL:         d.publicURL,
+		UnsubscribeURL: d.unsubscribeURL(user.ID),
+	}
+
+	text := bytes.Buffer{}
+	err = digestTextTemplate.Execute(&text, content)
+	if err != nil {
+		return err
+	}
+
+	html := bytes.Buffer{}
+	err = digestHTMLTemplate.Execute(&html, content)
+	if err != nil {
+		return err
+	}
+
+	return d.mailer.Send(&mailer.Message{
+		From:    d.from,
+		To:      user.Email,
+		Subject: fmt.Sprintf("You have %d unread messages in ChatApp", len(messages)),
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			// One-click unsubscribe (RFC 8058)
+			"List-Unsubscribe":      "<" + content.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// unsubscribeURL is the link which turns off the digest of the user without logging in
+func (d *DigestSender) unsubscribeURL(userID string) string {
+	query := url.Values{}
+	query.Set("user", userID)
+	query.Set("token", d.unsubscribeToken(userID))
+
+	return d.publicURL + apiV1Prefix + "/digest/unsubscribe?" + query.Encode()
+}
+
+func (d *DigestSender) unsubscribeToken(userID string) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte("digest-unsubscribe:" + userID))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (d *DigestSender) verifyUnsubscribeToken(userID, token string) bool {
+	return hmac.Equal([]byte(token), []byte(d.unsubscribeToken(userID)))
+}
+
+// lastDigestSlot returns the latest scheduled time of the digest which is not after now and the digest period
+func lastDigestSlot(settings *model.DigestSettings, now time.Time) (time.Time, time.Duration) {
+	day := 24 * time.Hour
+
+	slot := time.Date(now.Year(), now.Month(), now.Day(), settings.DigestHour, 0, 0, 0, time.UTC)
+	if slot.After(now) {
+		slot = slot.Add(-day)
+	}
+
+	if settings.DigestFrequency != model.DigestFrequencyWeekly {
+		return slot, day
+	}
+
+	for int(slot.Weekday()) != settings.DigestWeekday {
+		slot = slot.Add(-day)
+	}
+
+	return slot, 7 * day
+}
+
+// groupDigestMessages groups the messages by chat, keeping the order of the chats
+func groupDigestMessages(messages []model.UnreadMessage) []*digestChat {
+	chats := []*digestChat{}
+	byID := make(map[string]*digestChat)
+
+	for i := range messages {
+		msg := &messages[i]
+		author := displayName(&msg.Author)
+
+		chat, ok := byID[msg.ChatID]
+		if !ok {
+			title := msg.ChatTitle
+			if title == "" {
+				title = "Conversation with " + author
+			}
+
+			chat = &digestChat{Title: title}
+			byID[msg.ChatID] = chat
+			chats = append(chats, chat)
+		}
+
+		if len(chat.Messages) == digestMaxMessagesPerChat {
+			chat.More++
+			continue
+		}
+
+		createdAt := ""
+		if msg.CreatedAt != nil {
+			createdAt = msg.CreatedAt.UTC().Format("Jan 2 15:04")
+		}
+
+		chat.Messages = append(chat.Messages, digestMessage{
+			Author:    author,
+			Text:      truncate(msg.Message.Message, digestSnippetLen),
+			CreatedAt: createdAt,
+		})
+	}
+
+	return chats
+}
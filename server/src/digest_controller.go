@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/mail"
+
+	"./model"
+)
+
+func (c *apiController) getDigestSettings(w http.ResponseWriter, r *http.Request) {
+	user := model.User{}
+	err := c.store.UserRepo.Get(contextUserID(r), &user)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, user.DigestSettings)
+}
+
+func (c *apiController) updateDigestSettings(w http.ResponseWriter, r *http.Request) {
+	settings := model.DigestSettings{}
+	err := c.readData(r.Body, &settings)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Validate digest settings
+	{
+		errs := validationErrors{}
+
+		if settings.Email != "" {
+			address, err := mail.ParseAddress(settings.Email)
+			if len(settings.Email) > 256 {
+				errs.add("email", FieldErrTooLong, "Email must be at most 256 characters long")
+			} else if err != nil || address.Address != settings.Email {
+				errs.add("email", FieldErrInvalid, "Email is not valid")
+			}
+		}
+
+		switch settings.DigestFrequency {
+		case model.DigestFrequencyOff:
+		case model.DigestFrequencyDaily, model.DigestFrequencyWeekly:
+			if settings.Email == "" {
+				errs.add("email", FieldErrRequired, "Email is required to receive digests")
+			}
+		default:
+			errs.add("digestFrequency", FieldErrInvalid, "Digest frequency must be one of off, daily, weekly")
+		}
+
+		if settings.DigestHour < 0 || settings.DigestHour > 23 {
+			errs.add("digestHour", FieldErrInvalid, "Digest hour must be between 0 and 23")
+		}
+		if settings.DigestWeekday < 0 || settings.DigestWeekday > 6 {
+			errs.add("digestWeekday", FieldErrInvalid, "Digest weekday must be between 0 (Sunday) and 6")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
+	err = c.store.UserRepo.UpdateDigestSettings(contextUserID(r), &settings)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, settings)
+}
+
+// unsubscribeDigest turns off the digest from the link in the email. GET requests come from
+// the user opening the link, POST requests from one-click unsubscribe of the email client.
+func (c *apiController) unsubscribeDigest(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user")
+	if userID == "" || !c.digestSender.verifyUnsubscribeToken(userID, r.URL.Query().Get("token")) {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Unsubscribe link is not valid")
+		return
+	}
+
+	user := model.User{}
+	err := c.store.UserRepo.Get(userID, &user)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	settings := user.DigestSettings
+	settings.DigestFrequency = model.DigestFrequencyOff
+	err = c.store.UserRepo.UpdateDigestSettings(user.ID, &settings)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		c.writeResponse(w, http.StatusNoContent, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("<!DOCTYPE html><html><body><p>You have been unsubscribed from ChatApp email digests.</p></body></html>"))
+}
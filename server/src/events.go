@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"./dbcontroller"
+	"./model"
+)
+
+const (
+	// Events older than the retention are removed from the event log
+	defaultEventRetention = 24 * time.Hour
+	eventSweepInterval    = 10 * time.Minute
+
+	// Maximum number of events replayed on WebSocket resume or returned by a single request
+	maxReplayEvents = 1000
+)
+
+// Event payload modes. In the full mode events embed the changed entities.
+const (
+	payloadModeIDs  = "ids"
+	payloadModeFull = "full"
+)
+
+type EventList struct {
+	Events []json.RawMessage `json:"events"`
+
+	// Sequence number to continue from with the next request
+	LastSeq int64 `json:"lastSeq"`
+	HasMore bool  `json:"hasMore"`
+
+	// Sequence numbers of the events
+	seqs []int64
+}
+
+type WSResyncData struct {
+	Type string `json:"type"`
+	Seq  int64  `json:"seq"`
+}
+
+// errEventsExpired is returned when some of the requested events were already removed from the event log
+var errEventsExpired = fmt.Errorf("Events since the given sequence number are no longer available")
+
+func (c *apiController) listEvents(w http.ResponseWriter, r *http.Request) {
+	errs := validationErrors{}
+	query := r.URL.Query()
+
+	limit := defaultPageLimit
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxReplayEvents {
+			errs.add("limit", FieldErrInvalid, fmt.Sprintf("Limit must be a number between 1 and %d", maxReplayEvents))
+		}
+	}
+
+	since := int64(-1)
+	if value := query.Get("since"); value != "" {
+		var err error
+		since, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || since < 0 {
+			errs.add("since", FieldErrInvalid, "Since must be a non-negative sequence number")
+		}
+	}
+
+	fullPayload := parsePayloadMode(r, &errs)
+
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
+		return
+	}
+
+	// Without since the client only learns where to start tracking the events from
+	if since < 0 {
+		lastSeq, err := c.store.EventRepo.LastSeq()
+		if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+			return
+		}
+
+		c.writeResponse(w, http.StatusOK, &EventList{
+			Events:  []json.RawMessage{},
+			LastSeq: lastSeq,
+		})
+		return
+	}
+
+	list, err := listEventsSince(c.store.EventRepo, contextUserID(r), since, limit, fullPayload)
+	if err == errEventsExpired {
+		c.writeErrorResponse(w, r, http.StatusGone, ErrCodeEventsExpired, err.Error())
+		return
+	} else if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, list)
+}
+
+// listEventsSince lists the events of the user with sequence number greater than since.
+// The events are returned in the same form in which they are sent over WebSocket.
+func listEventsSince(repo *dbcontroller.EventRepo, userID string, since int64, limit int, fullPayload bool) (*EventList, error) {
+	firstSeq, err := repo.FirstSeq()
+	if err != nil {
+		return nil, err
+	}
+
+	if firstSeq > 0 && since+1 < firstSeq {
+		return nil, errEventsExpired
+	}
+
+	events := []model.Event{}
+	err = repo.ListByUserID(userID, since, limit+1, &events)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &EventList{
+		Events:  []json.RawMessage{},
+		LastSeq: since,
+	}
+
+	if len(events) > limit {
+		events = events[:limit]
+		list.HasMore = true
+	}
+
+	for i := range events {
+		payload := events[i].Data
+		if fullPayload && events[i].FullData != "" {
+			payload = events[i].FullData
+		}
+
+		frame, err := eventFrame(events[i].Seq, []byte(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		list.Events = append(list.Events, frame)
+		list.seqs = append(list.seqs, events[i].Seq)
+		list.LastSeq = events[i].Seq
+	}
+
+	return list, nil
+}
+
+// parsePayloadMode reads the payload query parameter and reports whether the full payload mode is requested
+func parsePayloadMode(r *http.Request, errs *validationErrors) bool {
+	switch r.URL.Query().Get("payload") {
+	case "", payloadModeIDs:
+		return false
+	case payloadModeFull:
+		return true
+	}
+
+	errs.add("payload", FieldErrInvalid, fmt.Sprintf("Payload must be %s or %s", payloadModeIDs, payloadModeFull))
+
+	return false
+}
+
+// eventFrame adds the sequence number to the marshaled event
+func eventFrame(seq int64, payload []byte) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(payload, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	fields["seq"] = json.RawMessage(strconv.FormatInt(seq, 10))
+
+	return json.Marshal(fields)
+}
+
+// eventType reads the type of the marshaled event
+func eventType(payload []byte) string {
+	data := struct {
+		Type string `json:"type"`
+	}{}
+	json.Unmarshal(payload, &data)
+
+	return data.Type
+}
+
+// runEventSweeper periodically removes the events older than the retention from the event log
+func runEventSweeper(repo *dbcontroller.EventRepo, retention time.Duration) {
+	ticker := time.NewTicker(eventSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		count, err := repo.DeleteCreatedBefore(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Failed to remove expired events: %+v\n", err)
+			continue
+		}
+
+		if count > 0 {
+			log.Printf("Removed %d expired events\n", count)
+		}
+	}
+}
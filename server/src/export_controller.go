@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strings"
+	"time"
+
+	"./markup"
+	"./model"
+	"github.com/gorilla/mux"
+)
+
+const (
+	exportBatchSize  = 500
+	exportBufferSize = 32 * 1024
+
+	// The export isn't limited by the write timeout of the server, but every write must finish within the timeout
+	exportWriteTimeout = 30 * time.Second
+
+	exportTimeFormat = "2006-01-02 15:04:05 MST"
+)
+
+// ExportAuthor is the author of an exported message. Deleted users have only the id.
+type ExportAuthor struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	FullName string `json:"fullName"`
+	Bot      bool   `json:"bot"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// ExportedMessage is a message in the chat exports. Links are the http and https URLs which the message references.
+type ExportedMessage struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	Author    ExportAuthor `json:"author"`
+	Message   string       `json:"message"`
+	HTML      string       `json:"html"`
+	Links     []string     `json:"links"`
+	CreatedAt *time.Time   `json:"createdAt"`
+	UpdatedAt *time.Time   `json:"updatedAt"`
+}
+
+// chatExporter writes the chat history in one of the export formats, one message at a time
+type chatExporter interface {
+	writeHeader(chat *model.Chat, exportedAt time.Time) error
+	writeMessage(msg *ExportedMessage) error
+	writeFooter() error
+}
+
+type chatExportFormat struct {
+	contentType string
+	newExporter func(w io.Writer) chatExporter
+}
+
+var chatExportFormats = map[string]*chatExportFormat{
+	"json": {contentType: "application/json", newExporter: newJSONChatExporter},
+	"csv":  {contentType: "text/csv; charset=utf-8", newExporter: newCSVChatExporter},
+	"html": {contentType: "text/html; charset=utf-8", newExporter: newHTMLChatExporter},
+	"txt":  {contentType: "text/plain; charset=utf-8", newExporter: newTextChatExporter},
+}
+
+// exportChat streams the whole history of the chat, the messages are read in batches
+func (c *apiController) exportChat(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	exportFormat, ok := chatExportFormats[format]
+	if !ok {
+		formats := []string{}
+		for name := range chatExportFormats {
+			formats = append(formats, name)
+		}
+		sort.Strings(formats)
+
+		c.writeValidationErrorResponse(w, r, validationErrors{
+			{Field: "format", Code: FieldErrInvalid, Message: "Format must be one of " + strings.Join(formats, ", ")},
+		})
+		return
+	}
+
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(mux.Vars(r)["chatID"], &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	exportedAt := time.Now().UTC()
+	filename := fmt.Sprintf("chat-%s-%s.%s", chat.ID, exportedAt.Format("20060102-150405"), format)
+
+	w.Header().Set("Content-Type", exportFormat.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	stream, err := startExportStream(w, r)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to start the export")
+		return
+	}
+
+	err = c.writeChatExport(exportFormat.newExporter(stream), &chat, exportedAt)
+	if err != nil {
+		log.Printf("Failed to export chat %s: %+v\n", chat.ID, err)
+	}
+
+	// An incomplete export is not terminated, so the client can't mistake it for the whole history
+	err = stream.close(err == nil)
+	if err != nil {
+		log.Printf("Failed to finish the export of chat %s: %+v\n", chat.ID, err)
+	}
+}
+
+func (c *apiController) writeChatExport(exporter chatExporter, chat *model.Chat, exportedAt time.Time) error {
+	err := exporter.writeHeader(chat, exportedAt)
+	if err != nil {
+		return err
+	}
+
+	authors := make(map[string]*ExportAuthor)
+
+	var last *model.Message
+	for {
+		messages := []model.Message{}
+		err = c.store.MessageRepo.ListPageByChatID(chat.ID, last, exportBatchSize, &messages)
+		if err != nil {
+			return err
+		}
+
+		err = c.loadExportAuthors(messages, authors)
+		if err != nil {
+			return err
+		}
+
+		for i := range messages {
+			msg := &messages[i]
+
+			err = exporter.writeMessage(&ExportedMessage{
+				ID:        msg.ID,
+				Type:      msg.Type,
+				Author:    *authors[msg.UserID],
+				Message:   msg.Message,
+				HTML:      msg.HTML,
+				Links:     markup.LinkURLs(markup.Parse(msg.Message)),
+				CreatedAt: msg.CreatedAt,
+				UpdatedAt: msg.UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(messages) < exportBatchSize {
+			break
+		}
+		last = &messages[len(messages)-1]
+	}
+
+	return exporter.writeFooter()
+}
+
+// loadExportAuthors adds the authors of the messages which are not loaded yet
+func (c *apiController) loadExportAuthors(messages []model.Message, authors map[string]*ExportAuthor) error {
+	userIDs := []string{}
+	for i := range messages {
+		if _, ok := authors[messages[i].UserID]; !ok {
+			authors[messages[i].UserID] = &ExportAuthor{ID: messages[i].UserID, Deleted: true}
+			userIDs = append(userIDs, messages[i].UserID)
+		}
+	}
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	users := []model.User{}
+	err := c.store.UserRepo.ListByIDs(userIDs, &users)
+	if err != nil {
+		return err
+	}
+
+	for i := range users {
+		authors[users[i].ID] = &ExportAuthor{
+			ID:       users[i].ID,
+			Username: users[i].Username,
+			FullName: users[i].FullName,
+			Bot:      users[i].Bot,
+		}
+	}
+
+	return nil
+}
+
+// exportStream is the buffered body of an export response
+type exportStream struct {
+	*bufio.Writer
+
+	// close finishes the response, an incomplete response is aborted
+	close func(complete bool) error
+}
+
+// startExportStream sends the headers of the response. HTTP/1 connections are taken over, so long exports
+// are not cut by the write timeout of the server, the body is sent with chunked encoding.
+func startExportStream(w http.ResponseWriter, r *http.Request) (*exportStream, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok || r.ProtoMajor != 1 {
+		w.WriteHeader(http.StatusOK)
+
+		stream := &exportStream{Writer: bufio.NewWriterSize(w, exportBufferSize)}
+		stream.close = func(complete bool) error {
+			return stream.Flush()
+		}
+
+		return stream, nil
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	chunked := r.ProtoAtLeast(1, 1)
+
+	header := w.Header()
+	header.Set("Connection", "close")
+	header.Del("Content-Length")
+	if chunked {
+		header.Set("Transfer-Encoding", "chunked")
+	}
+
+	body := &deadlineWriter{conn: conn, w: rw}
+
+	fmt.Fprintf(body, "HTTP/%d.%d %d %s\r\n", r.ProtoMajor, r.ProtoMinor, http.StatusOK, http.StatusText(http.StatusOK))
+	header.Write(body)
+	io.WriteString(body, "\r\n")
+
+	var out io.Writer = body
+	var chunkedWriter io.WriteCloser
+	if chunked {
+		chunkedWriter = httputil.NewChunkedWriter(body)
+		out = chunkedWriter
+	}
+
+	stream := &exportStream{Writer: bufio.NewWriterSize(out, exportBufferSize)}
+	stream.close = func(complete bool) error {
+		defer conn.Close()
+
+		if !complete {
+			return nil
+		}
+
+		err := stream.Flush()
+		if err == nil && chunkedWriter != nil {
+			err = chunkedWriter.Close()
+			if err == nil {
+				_, err = io.WriteString(body, "\r\n")
+			}
+		}
+		if err == nil {
+			conn.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+			err = rw.Flush()
+		}
+
+		return err
+	}
+
+	return stream, nil
+}
+
+// deadlineWriter extends the write deadline of the connection before every write
+type deadlineWriter struct {
+	conn net.Conn
+	w    io.Writer
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.conn.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	return d.w.Write(p)
+}
+
+func exportChatTitle(chat *model.Chat) string {
+	if chat.Title != "" {
+		return chat.Title
+	}
+
+	if chat.DirectUserID != "" {
+		return "Direct chat"
+	}
+
+	return "Chat " + chat.ID
+}
+
+func exportAuthorName(author *ExportAuthor) string {
+	if author.Deleted {
+		return "Deleted user " + author.ID
+	}
+
+	if author.FullName != "" {
+		return author.FullName + " (@" + author.Username + ")"
+	}
+
+	return "@" + author.Username
+}
+
+func formatExportTime(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+
+	return date.UTC().Format(exportTimeFormat)
+}
+
+// jsonChatExporter writes {"chat": ..., "exportedAt": ..., "messages": [...]}
+type jsonChatExporter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONChatExporter(w io.Writer) chatExporter {
+	return &jsonChatExporter{w: w}
+}
+
+func (e *jsonChatExporter) writeHeader(chat *model.Chat, exportedAt time.Time) error {
+	chatData, err := json.Marshal(chat)
+	if err != nil {
+		return err
+	}
+
+	dateData, err := json.Marshal(exportedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(e.w, `{"chat":%s,"exportedAt":%s,"messages":[`, chatData, dateData)
+
+	return err
+}
+
+func (e *jsonChatExporter) writeMessage(msg *ExportedMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if e.count > 0 {
+		_, err = io.WriteString(e.w, ",")
+		if err != nil {
+			return err
+		}
+	}
+	e.count++
+
+	_, err = e.w.Write(data)
+
+	return err
+}
+
+func (e *jsonChatExporter) writeFooter() error {
+	_, err := io.WriteString(e.w, "]}\n")
+
+	return err
+}
+
+// csvChatExporter writes a row for every message, the links are separated by spaces
+type csvChatExporter struct {
+	w *csv.Writer
+}
+
+func newCSVChatExporter(w io.Writer) chatExporter {
+	return &csvChatExporter{w: csv.NewWriter(w)}
+}
+
+func (e *csvChatExporter) writeHeader(chat *model.Chat, exportedAt time.Time) error {
+	return e.w.Write([]string{"id", "created_at", "updated_at", "author_id", "author_username", "author_full_name", "type", "message", "links"})
+}
+
+func (e *csvChatExporter) writeMessage(msg *ExportedMessage) error {
+	createdAt, updatedAt := "", ""
+	if msg.CreatedAt != nil {
+		createdAt = msg.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if msg.UpdatedAt != nil {
+		updatedAt = msg.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	return e.w.Write([]string{
+		msg.ID,
+		createdAt,
+		updatedAt,
+		msg.Author.ID,
+		msg.Author.Username,
+		msg.Author.FullName,
+		msg.Type,
+		msg.Message,
+		strings.Join(msg.Links, " "),
+	})
+}
+
+func (e *csvChatExporter) writeFooter() error {
+	e.w.Flush()
+
+	return e.w.Error()
+}
+
+// htmlChatExporter writes a standalone page. The message HTML is rendered and sanitized by the server.
+type htmlChatExporter struct {
+	w io.Writer
+}
+
+func newHTMLChatExporter(w io.Writer) chatExporter {
+	return &htmlChatExporter{w: w}
+}
+
+const htmlExportStyle = `body{font-family:sans-serif;max-width:800px;margin:0 auto;padding:20px;color:#222}` +
+	`.message{padding:8px 0;border-bottom:1px solid #eee}.meta{font-size:13px;color:#666}` +
+	`.action .text{font-style:italic}.links{margin:4px 0;font-size:13px}pre{white-space:pre-wrap}`
+
+func (e *htmlChatExporter) writeHeader(chat *model.Chat, exportedAt time.Time) error {
+	title := html.EscapeString(exportChatTitle(chat))
+
+	_, err := fmt.Fprintf(e.w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n<h1>%s</h1>\n<p>Exported at %s</p>\n",
+		title, htmlExportStyle, title, html.EscapeString(exportedAt.Format(exportTimeFormat)))
+
+	return err
+}
+
+func (e *htmlChatExporter) writeMessage(msg *ExportedMessage) error {
+	var b strings.Builder
+
+	b.WriteString(`<div class="message ` + html.EscapeString(msg.Type) + `" id="message-` + html.EscapeString(msg.ID) + `">`)
+	b.WriteString(`<div class="meta"><strong>` + html.EscapeString(exportAuthorName(&msg.Author)) + `</strong> `)
+	if msg.CreatedAt != nil {
+		b.WriteString(`<time datetime="` + msg.CreatedAt.UTC().Format(time.RFC3339) + `">` + html.EscapeString(formatExportTime(msg.CreatedAt)) + `</time>`)
+	}
+	b.WriteString(`</div><div class="text">`)
+	if msg.HTML != "" {
+		b.WriteString(msg.HTML)
+	} else {
+		b.WriteString("<pre>" + html.EscapeString(msg.Message) + "</pre>")
+	}
+	b.WriteString(`</div>`)
+
+	if len(msg.Links) > 0 {
+		b.WriteString(`<ul class="links">`)
+		for _, link := range msg.Links {
+			escaped := html.EscapeString(link)
+			b.WriteString(`<li><a href="` + escaped + `" rel="noopener noreferrer nofollow">` + escaped + `</a></li>`)
+		}
+		b.WriteString(`</ul>`)
+	}
+	b.WriteString("</div>\n")
+
+	_, err := io.WriteString(e.w, b.String())
+
+	return err
+}
+
+func (e *htmlChatExporter) writeFooter() error {
+	_, err := io.WriteString(e.w, "</body>\n</html>\n")
+
+	return err
+}
+
+// textChatExporter writes a line for every message, the following lines of the messages are indented
+type textChatExporter struct {
+	w io.Writer
+}
+
+func newTextChatExporter(w io.Writer) chatExporter {
+	return &textChatExporter{w: w}
+}
+
+func (e *textChatExporter) writeHeader(chat *model.Chat, exportedAt time.Time) error {
+	_, err := fmt.Fprintf(e.w, "%s\nExported at %s\n\n", exportChatTitle(chat), exportedAt.Format(exportTimeFormat))
+
+	return err
+}
+
+func (e *textChatExporter) writeMessage(msg *ExportedMessage) error {
+	text := strings.Replace(msg.Message, "\r\n", "\n", -1)
+	text = strings.Replace(text, "\n", "\n    ", -1)
+
+	separator := ": "
+	if msg.Type == model.MessageTypeAction {
+		separator = " "
+	}
+
+	_, err := fmt.Fprintf(e.w, "[%s] %s%s%s\n", formatExportTime(msg.CreatedAt), exportAuthorName(&msg.Author), separator, text)
+
+	return err
+}
+
+func (e *textChatExporter) writeFooter() error {
+	return nil
+}
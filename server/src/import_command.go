@@ -0,0 +1,586 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"./dbcontroller"
+	"./importer"
+	"./markup"
+	"./model"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// Generated passwords of the imported users satisfy the password rules of the registration
+	importPasswordChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	importPasswordLength = 16
+
+	maxImportedUsernameLength = 64
+)
+
+var invalidUsernameCharsRe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// importReport counts the entities of an import, the existing entities are not counted
+type importReport struct {
+	users       int
+	linkedUsers int
+	chats       int
+	members     int
+	messages    int
+	duplicates  int
+	skipped     int
+}
+
+// runImportCommand imports the history exported from another chat service:
+//
+//	server import [-format slack|discord|mattermost] [-credentials file] <export>
+func runImportCommand(store *dbcontroller.Store, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "slack", "format of the export: "+strings.Join(importer.Formats, ", "))
+	credentialsPath := flags.String("credentials", "import-credentials.csv", "CSV file to which the usernames and passwords of the created users are appended")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: server import [options] <export>")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("the path of the export is required")
+	}
+
+	archive, err := importer.Open(*format, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	credentialsFile, err := os.OpenFile(*credentialsPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer credentialsFile.Close()
+
+	credentials := csv.NewWriter(credentialsFile)
+
+	i := newHistoryImporter(store, archive, credentials)
+	err = i.run()
+
+	credentials.Flush()
+	if err == nil {
+		err = credentials.Error()
+	}
+
+	r := i.report
+	log.Printf("Imported %d users (%d existing users matched by username), %d chats, %d memberships and %d messages from %s\n",
+		r.users, r.linkedUsers, r.chats, r.members, r.messages, archive.Source())
+	log.Printf("Skipped %d messages which were already imported and %d messages without an author or a chat\n", r.duplicates, r.skipped)
+	if r.users > 0 {
+		log.Printf("Passwords of the created users are in %s\n", *credentialsPath)
+	}
+
+	return err
+}
+
+// historyImporter imports an archive through the store. Every imported entity gets an import record
+// with its id in the archive, so the entities which were imported before are reused.
+type historyImporter struct {
+	store       *dbcontroller.Store
+	archive     importer.Archive
+	source      string
+	credentials *csv.Writer
+
+	// Imported entities by their ids in the archive
+	userIDs   map[string]string
+	usernames map[string]string
+	chatIDs   map[string]string
+	channels  map[string]*importer.Channel
+
+	// Known members of the imported chats
+	members map[string]map[string]bool
+
+	// Time of the last imported message of the chats created by the import, zero until a message is imported
+	lastMessageAt map[string]time.Time
+
+	report importReport
+}
+
+func newHistoryImporter(store *dbcontroller.Store, archive importer.Archive, credentials *csv.Writer) *historyImporter {
+	return &historyImporter{
+		store:         store,
+		archive:       archive,
+		source:        archive.Source(),
+		credentials:   credentials,
+		userIDs:       make(map[string]string),
+		usernames:     make(map[string]string),
+		chatIDs:       make(map[string]string),
+		channels:      make(map[string]*importer.Channel),
+		members:       make(map[string]map[string]bool),
+		lastMessageAt: make(map[string]time.Time),
+	}
+}
+
+func (i *historyImporter) run() error {
+	users := i.archive.Users()
+	for j := range users {
+		_, err := i.importUser(&users[j])
+		if err != nil {
+			return err
+		}
+	}
+
+	channels := i.archive.Channels()
+	for j := range channels {
+		i.channels[channels[j].ID] = &channels[j]
+
+		err := i.importChannel(&channels[j])
+		if err != nil {
+			return err
+		}
+	}
+
+	err := i.archive.Messages(i.usernames, i.importMessages)
+	if err != nil {
+		return err
+	}
+
+	// The new chats are ordered by their last message, not by the time of the import
+	for chatID, date := range i.lastMessageAt {
+		if date.IsZero() {
+			continue
+		}
+
+		err = i.store.ChatRepo.UpdateUpdatedAt(chatID, &date)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importUser returns the id of the imported user. Users are matched with the existing users by username,
+// the other users are created with a generated password. Deleted users are created suspended.
+func (i *historyImporter) importUser(u *importer.User) (string, error) {
+	if userID, ok := i.userIDs[u.ID]; ok {
+		return userID, nil
+	}
+
+	records, err := i.store.ImportRecordRepo.ListEntityIDs(i.source, model.ImportKindUser, []string{u.ID})
+	if err != nil {
+		return "", err
+	}
+
+	if userID, ok := records[u.ID]; ok {
+		users := []model.User{}
+		err = i.store.UserRepo.ListByIDs([]string{userID}, &users)
+		if err != nil {
+			return "", err
+		}
+
+		// Users deleted after the previous import are created again
+		if len(users) == 1 {
+			i.userIDs[u.ID] = users[0].ID
+			i.usernames[u.ID] = users[0].Username
+			return users[0].ID, nil
+		}
+	}
+
+	user, err := i.createUser(u)
+	if err != nil {
+		return "", err
+	}
+
+	err = i.store.ImportRecordRepo.Save(&model.ImportRecord{
+		Source:     i.source,
+		Kind:       model.ImportKindUser,
+		ExternalID: u.ID,
+		EntityID:   user.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	i.userIDs[u.ID] = user.ID
+	i.usernames[u.ID] = user.Username
+
+	return user.ID, nil
+}
+
+func (i *historyImporter) createUser(u *importer.User) (*model.User, error) {
+	username := importedUsername(u)
+
+	// Bots are never matched, a bot of the export must not act as a bot of the server
+	existing, err := i.store.UserRepo.GetByUsername(username)
+	if err == nil && !u.Bot && !existing.Bot {
+		i.report.linkedUsers++
+		return existing, nil
+	} else if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	if existing != nil {
+		username, err = i.uniqueUsername(username)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	user := &model.User{}
+	user.Username = username
+
+	if u.Bot {
+		err = i.store.UserRepo.CreateBot(user)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		user.Password, err = generateImportPassword()
+		if err != nil {
+			return nil, err
+		}
+
+		err = i.store.UserRepo.Create(user)
+		if err != nil {
+			return nil, err
+		}
+
+		if !u.Deleted {
+			err = i.credentials.Write([]string{user.Username, user.Password})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if u.FullName != "" {
+		user.FullName = truncate(u.FullName, 256)
+		err = i.store.UserRepo.Update(user)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if u.Email != "" && !u.Bot {
+		err = i.store.UserRepo.UpdateDigestSettings(user.ID, &model.DigestSettings{
+			Email:           truncate(u.Email, 256),
+			DigestFrequency: model.DigestFrequencyOff,
+			DigestHour:      8,
+			DigestWeekday:   int(time.Monday),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if u.Deleted {
+		now := time.Now()
+		err = i.store.UserRepo.UpdateSuspendedAt(user.ID, &now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	i.report.users++
+
+	return user, nil
+}
+
+func (i *historyImporter) uniqueUsername(username string) (string, error) {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d", username, n)
+
+		exists, err := i.store.UserRepo.ExistsUsername(candidate)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			return candidate, nil
+		}
+	}
+}
+
+// importedUsername changes the username to satisfy the username rules of the registration
+func importedUsername(u *importer.User) string {
+	username := u.Username
+	if username == "" {
+		username = u.FullName
+	}
+
+	username = strings.Trim(invalidUsernameCharsRe.ReplaceAllString(username, "_"), "_")
+	if len(username) > maxImportedUsernameLength {
+		username = username[:maxImportedUsernameLength]
+	}
+
+	if username == "" {
+		return "user"
+	} else if len(username) < 4 {
+		return username + "-user"
+	}
+
+	return username
+}
+
+func generateImportPassword() (string, error) {
+	password := make([]byte, importPasswordLength)
+	for j := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(importPasswordChars))))
+		if err != nil {
+			return "", err
+		}
+
+		password[j] = importPasswordChars[n.Int64()]
+	}
+
+	return string(password), nil
+}
+
+// importChannel creates the chat of the channel with its members. A channel without a known creator
+// or members is created when its first message is imported, by the author of the message.
+func (i *historyImporter) importChannel(c *importer.Channel) error {
+	records, err := i.store.ImportRecordRepo.ListEntityIDs(i.source, model.ImportKindChat, []string{c.ID})
+	if err != nil {
+		return err
+	}
+
+	if chatID, ok := records[c.ID]; ok {
+		exists, err := i.store.ChatRepo.Exists(chatID)
+		if err != nil {
+			return err
+		}
+
+		// Chats deleted after the previous import are created again
+		if exists {
+			i.chatIDs[c.ID] = chatID
+			return i.addMembers(chatID, c)
+		}
+	}
+
+	creatorID := i.userIDs[c.CreatorID]
+	if creatorID == "" {
+		for _, member := range c.Members {
+			if creatorID = i.userIDs[member]; creatorID != "" {
+				break
+			}
+		}
+	}
+
+	if creatorID == "" {
+		return nil
+	}
+
+	_, err = i.createChat(c, creatorID)
+
+	return err
+}
+
+// createChat creates the chat of the channel. Direct channels of two users use their existing direct chat.
+func (i *historyImporter) createChat(c *importer.Channel, creatorID string) (string, error) {
+	chat := model.Chat{}
+
+	directUserIDs := i.directUserIDs(c)
+	if directUserIDs != nil {
+		chat.CreatorID = directUserIDs[0]
+		chat.DirectUserID = directUserIDs[1]
+
+		created, err := i.store.ChatRepo.GetOrCreateDirectChat(&chat)
+		if err != nil {
+			return "", err
+		}
+		if created {
+			i.lastMessageAt[chat.ID] = time.Time{}
+			i.report.chats++
+			i.report.members += len(directUserIDs)
+		}
+	} else {
+		chat.CreatorID = creatorID
+		chat.Title = truncate(c.Name, 256)
+
+		err := i.store.ChatRepo.Create(&chat)
+		if err != nil {
+			return "", err
+		}
+		i.lastMessageAt[chat.ID] = time.Time{}
+		i.report.chats++
+	}
+
+	err := i.store.ImportRecordRepo.Save(&model.ImportRecord{
+		Source:     i.source,
+		Kind:       model.ImportKindChat,
+		ExternalID: c.ID,
+		EntityID:   chat.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	i.chatIDs[c.ID] = chat.ID
+
+	err = i.addMember(chat.ID, creatorID)
+	if err != nil {
+		return "", err
+	}
+
+	return chat.ID, i.addMembers(chat.ID, c)
+}
+
+// directUserIDs returns the two imported users of a direct channel, nil when the channel is not a direct chat of two users
+func (i *historyImporter) directUserIDs(c *importer.Channel) []string {
+	if !c.Direct || len(c.Members) != 2 {
+		return nil
+	}
+
+	first, second := i.userIDs[c.Members[0]], i.userIDs[c.Members[1]]
+	if first == "" || second == "" || first == second {
+		return nil
+	}
+
+	return []string{first, second}
+}
+
+func (i *historyImporter) addMembers(chatID string, c *importer.Channel) error {
+	for _, member := range c.Members {
+		userID, ok := i.userIDs[member]
+		if !ok {
+			continue
+		}
+
+		err := i.addMember(chatID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (i *historyImporter) addMember(chatID, userID string) error {
+	if i.members[chatID] == nil {
+		i.members[chatID] = make(map[string]bool)
+	}
+
+	if i.members[chatID][userID] {
+		return nil
+	}
+
+	exists, err := i.store.ChatUserRepo.Exists(chatID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		err = i.store.ChatUserRepo.Create(&model.ChatUser{
+			ChatID: chatID,
+			UserID: userID,
+		})
+		if err != nil {
+			return err
+		}
+		i.report.members++
+	}
+
+	i.members[chatID][userID] = true
+
+	return nil
+}
+
+// importMessages inserts the batch of messages which were not imported yet. The authors become members
+// of the chats. The messages are history, so they don't send events, mentions or notifications.
+func (i *historyImporter) importMessages(batch []importer.Message) error {
+	ids := make([]string, len(batch))
+	for j := range batch {
+		ids[j] = batch[j].ID
+	}
+
+	imported, err := i.store.ImportRecordRepo.ListEntityIDs(i.source, model.ImportKindMessage, ids)
+	if err != nil {
+		return err
+	}
+
+	messages := []model.Message{}
+	externalIDs := []string{}
+	for j := range batch {
+		m := &batch[j]
+
+		if _, ok := imported[m.ID]; ok {
+			i.report.duplicates++
+			continue
+		}
+		imported[m.ID] = ""
+
+		userID, ok := i.userIDs[m.UserID]
+		if !ok && m.Author != nil {
+			userID, err = i.importUser(m.Author)
+			if err != nil {
+				return err
+			}
+		}
+
+		chatID := i.chatIDs[m.ChannelID]
+		if chatID == "" && userID != "" && i.channels[m.ChannelID] != nil {
+			chatID, err = i.createChat(i.channels[m.ChannelID], userID)
+			if err != nil {
+				return err
+			}
+		}
+
+		text := strings.TrimSpace(strings.Join(append([]string{m.Text}, m.Files...), "\n"))
+		if userID == "" || chatID == "" || text == "" {
+			i.report.skipped++
+			continue
+		}
+
+		err = i.addMember(chatID, userID)
+		if err != nil {
+			return err
+		}
+
+		createdAt, updatedAt := m.CreatedAt, m.CreatedAt
+		if m.EditedAt != nil && m.EditedAt.After(createdAt) {
+			updatedAt = *m.EditedAt
+		}
+
+		msgType := model.MessageTypeText
+		if m.Action {
+			msgType = model.MessageTypeAction
+		}
+
+		messages = append(messages, model.Message{
+			UserID:    userID,
+			ChatID:    chatID,
+			Message:   text,
+			Type:      msgType,
+			CreatedAt: &createdAt,
+			UpdatedAt: &updatedAt,
+			HTML:      markup.ToHTML(text),
+		})
+		externalIDs = append(externalIDs, m.ID)
+
+		if last, ok := i.lastMessageAt[chatID]; ok && createdAt.After(last) {
+			i.lastMessageAt[chatID] = createdAt
+		}
+	}
+
+	err = i.store.ImportRecordRepo.CreateMessages(i.source, messages, externalIDs)
+	if err != nil {
+		return err
+	}
+	i.report.messages += len(messages)
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"time"
+)
+
+const discordBatchSize = 500
+
+// Message types which are imported, the others are joins, pins and similar events
+var discordMessageTypes = map[string]bool{
+	"Default": true,
+	"Reply":   true,
+}
+
+// Mentions of users in the content, e.g. <@123> or <@!123>
+var discordMentionRe = regexp.MustCompile(`<@!?(\d+)>`)
+
+type discordHeader struct {
+	Guild struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"guild"`
+	Channel struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"channel"`
+}
+
+type discordAuthor struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Nickname string `json:"nickname"`
+	IsBot    bool   `json:"isBot"`
+}
+
+type discordMessage struct {
+	ID              string        `json:"id"`
+	Type            string        `json:"type"`
+	Timestamp       time.Time     `json:"timestamp"`
+	TimestampEdited *time.Time    `json:"timestampEdited"`
+	Content         string        `json:"content"`
+	Author          discordAuthor `json:"author"`
+	Attachments     []struct {
+		URL string `json:"url"`
+	} `json:"attachments"`
+}
+
+// discordArchive reads the JSON exports of DiscordChatExporter, every file is a channel.
+// The users are known only from the messages, so the authors are the members of the channels.
+type discordArchive struct {
+	files  fileSet
+	source string
+
+	channels []Channel
+
+	// Files of the channels by channel id
+	paths map[string]string
+}
+
+func openDiscord(files fileSet) (*discordArchive, error) {
+	a := &discordArchive{
+		files: files,
+		paths: make(map[string]string),
+	}
+
+	for _, name := range files.names() {
+		if path.Ext(name) != ".json" {
+			continue
+		}
+
+		header := discordHeader{}
+		err := a.readFile(name, &header, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Channel.ID == "" {
+			continue
+		}
+
+		if a.source == "" {
+			a.source = "discord:" + header.Guild.ID
+		}
+
+		if _, ok := a.paths[header.Channel.ID]; ok {
+			continue
+		}
+		a.paths[header.Channel.ID] = name
+
+		a.channels = append(a.channels, Channel{
+			ID:     header.Channel.ID,
+			Name:   header.Channel.Name,
+			Direct: header.Channel.Type == "DirectTextChat",
+		})
+	}
+
+	if len(a.channels) == 0 {
+		return nil, fmt.Errorf("no channels are found, it is not a DiscordChatExporter JSON export")
+	}
+
+	return a, nil
+}
+
+// readFile decodes the header of the export and calls message for every message while the file is read,
+// without the callback the reading stops at the messages
+func (a *discordArchive) readFile(name string, header *discordHeader, message func(msg *discordMessage) error) error {
+	file, err := a.files.open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = decodeDiscordExport(json.NewDecoder(file), header, message)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func decodeDiscordExport(dec *json.Decoder, header *discordHeader, message func(msg *discordMessage) error) error {
+	err := expectDelim(dec, '{')
+	if err != nil {
+		return err
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case "guild":
+			err = dec.Decode(&header.Guild)
+		case "channel":
+			err = dec.Decode(&header.Channel)
+		case "messages":
+			if message == nil {
+				return nil
+			}
+
+			err = expectDelim(dec, '[')
+			for err == nil && dec.More() {
+				msg := discordMessage{}
+				err = dec.Decode(&msg)
+				if err == nil {
+					err = message(&msg)
+				}
+			}
+			if err == nil {
+				err = expectDelim(dec, ']')
+			}
+		default:
+			var value json.RawMessage
+			err = dec.Decode(&value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %s", delim)
+	}
+
+	return nil
+}
+
+func (a *discordArchive) Source() string {
+	return a.source
+}
+
+func (a *discordArchive) Users() []User {
+	return nil
+}
+
+func (a *discordArchive) Channels() []Channel {
+	return a.channels
+}
+
+func (a *discordArchive) Messages(usernames map[string]string, fn func(messages []Message) error) error {
+	for _, channel := range a.channels {
+		messages := []Message{}
+
+		header := discordHeader{}
+		err := a.readFile(a.paths[channel.ID], &header, func(m *discordMessage) error {
+			if !discordMessageTypes[m.Type] || m.Author.ID == "" {
+				return nil
+			}
+
+			fullName := m.Author.Nickname
+			if fullName == "" {
+				fullName = m.Author.Name
+			}
+
+			msg := Message{
+				ID:        m.ID,
+				ChannelID: channel.ID,
+				UserID:    m.Author.ID,
+				Author: &User{
+					ID:       m.Author.ID,
+					Username: m.Author.Name,
+					FullName: fullName,
+					Bot:      m.Author.IsBot,
+				},
+				Text:      convertDiscordText(m.Content, usernames),
+				CreatedAt: m.Timestamp,
+				EditedAt:  m.TimestampEdited,
+			}
+
+			for _, attachment := range m.Attachments {
+				if attachment.URL != "" {
+					msg.Files = append(msg.Files, attachment.URL)
+				}
+			}
+
+			messages = append(messages, msg)
+			if len(messages) < discordBatchSize {
+				return nil
+			}
+
+			err := fn(messages)
+			messages = []Message{}
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(messages) > 0 {
+			err = fn(messages)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *discordArchive) Close() error {
+	return a.files.Close()
+}
+
+func convertDiscordText(text string, usernames map[string]string) string {
+	return discordMentionRe.ReplaceAllStringFunc(text, func(mention string) string {
+		id := discordMentionRe.FindStringSubmatch(mention)[1]
+		if username, ok := usernames[id]; ok {
+			return "@" + username
+		}
+
+		return mention
+	})
+}
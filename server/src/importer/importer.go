@@ -0,0 +1,254 @@
+// Package importer reads the history exported from other chat services.
+//
+// The supported formats are:
+//
+//	slack       - workspace export of Slack, the zip archive or its extracted directory
+//	discord     - JSON exports of DiscordChatExporter, a file, a directory or a zip archive of them
+//	mattermost  - bulk export of Mattermost (JSONL), the file or a zip archive containing it
+//
+// Archives are read lazily, the users and the channels are loaded when the archive is opened,
+// the messages are read in batches, so the history doesn't need to fit in memory.
+package importer
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats are the names of the supported export formats
+var Formats = []string{"slack", "discord", "mattermost"}
+
+// User is a user of the archive
+type User struct {
+	ID       string
+	Username string
+	FullName string
+	Email    string
+	Bot      bool
+	Deleted  bool
+}
+
+// Channel is a channel or a direct conversation of the archive. Members are user ids.
+type Channel struct {
+	ID        string
+	Name      string
+	Direct    bool
+	CreatorID string
+	Members   []string
+}
+
+// Message is a message of the archive. Files are the URLs or paths of the attached files.
+type Message struct {
+	ID        string
+	ChannelID string
+	UserID    string
+
+	// Author is set when the author is not one of the users of the archive, e.g. an integration
+	Author *User
+
+	Text      string
+	Action    bool
+	Files     []string
+	CreatedAt time.Time
+	EditedAt  *time.Time
+}
+
+// Archive is an opened export
+type Archive interface {
+	// Source identifies the exported workspace, ids of the archive are unique within the source
+	Source() string
+
+	Users() []User
+	Channels() []Channel
+
+	// Messages calls fn with the messages in batches.
+	// Usernames are the names of the imported users by user id, used for the mentions in the text.
+	Messages(usernames map[string]string, fn func(messages []Message) error) error
+
+	Close() error
+}
+
+// Open opens the archive at path in the format
+func Open(format, path string) (Archive, error) {
+	files, err := openFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var archive Archive
+	switch format {
+	case "slack":
+		archive, err = openSlack(files)
+	case "discord":
+		archive, err = openDiscord(files)
+	case "mattermost":
+		archive, err = openMattermost(files)
+	default:
+		err = fmt.Errorf("unknown format %s, supported formats: %s", format, strings.Join(Formats, ", "))
+	}
+
+	if err != nil {
+		files.Close()
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// fileSet gives access to the files of an archive, which is a zip file, a directory or a single file.
+// Names are slash separated paths relative to the root of the archive.
+type fileSet interface {
+	names() []string
+	open(name string) (io.ReadCloser, error)
+	Close() error
+}
+
+func openFiles(p string) (fileSet, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return openDirFiles(p)
+	}
+
+	if strings.EqualFold(filepath.Ext(p), ".zip") {
+		return openZipFiles(p)
+	}
+
+	return &dirFiles{root: filepath.Dir(p), files: []string{filepath.Base(p)}}, nil
+}
+
+type dirFiles struct {
+	root  string
+	files []string
+}
+
+func openDirFiles(root string) (*dirFiles, error) {
+	files := &dirFiles{root: root}
+
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			name, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			files.files = append(files.files, filepath.ToSlash(name))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files.files)
+
+	return files, nil
+}
+
+func (f *dirFiles) names() []string {
+	return f.files
+}
+
+func (f *dirFiles) open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(f.root, filepath.FromSlash(name)))
+}
+
+func (f *dirFiles) Close() error {
+	return nil
+}
+
+type zipFiles struct {
+	reader *zip.ReadCloser
+	files  map[string]*zip.File
+	sorted []string
+}
+
+func openZipFiles(p string) (*zipFiles, error) {
+	reader, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+
+	files := &zipFiles{
+		reader: reader,
+		files:  make(map[string]*zip.File),
+	}
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(file.Name, "/"))
+		files.files[name] = file
+		files.sorted = append(files.sorted, name)
+	}
+
+	sort.Strings(files.sorted)
+
+	return files, nil
+}
+
+func (f *zipFiles) names() []string {
+	return f.sorted
+}
+
+func (f *zipFiles) open(name string) (io.ReadCloser, error) {
+	file, ok := f.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return file.Open()
+}
+
+func (f *zipFiles) Close() error {
+	return f.reader.Close()
+}
+
+// findRoot returns the topmost directory of the archive which contains the file, exports are often zipped in a directory
+func findRoot(files fileSet, name string) (string, bool) {
+	root, depth := "", -1
+	for _, p := range files.names() {
+		if path.Base(p) != name {
+			continue
+		}
+
+		dir := path.Dir(p)
+		if dir == "." {
+			dir = ""
+		}
+
+		d := 0
+		if dir != "" {
+			d = strings.Count(dir, "/") + 1
+		}
+		if depth < 0 || d < depth {
+			root, depth = dir, d
+		}
+	}
+
+	return root, depth >= 0
+}
+
+func joinPath(root, name string) string {
+	if root == "" {
+		return name
+	}
+
+	return root + "/" + name
+}
@@ -0,0 +1,300 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const mattermostBatchSize = 500
+
+// Mentions in the messages, Mattermost usernames may contain dots
+var mattermostMentionRe = regexp.MustCompile(`@([a-zA-Z0-9._-]+)`)
+
+// mattermostLine is a line of the bulk export, the field named after the type is set
+type mattermostLine struct {
+	Type string `json:"type"`
+	Team *struct {
+		Name string `json:"name"`
+	} `json:"team"`
+	User *struct {
+		Username  string `json:"username"`
+		Email     string `json:"email"`
+		Nickname  string `json:"nickname"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		DeleteAt  int64  `json:"delete_at"`
+		Teams     []struct {
+			Name     string `json:"name"`
+			Channels []struct {
+				Name string `json:"name"`
+			} `json:"channels"`
+		} `json:"teams"`
+	} `json:"user"`
+	Channel *struct {
+		Team        string `json:"team"`
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+	} `json:"channel"`
+	DirectChannel *struct {
+		Members []string `json:"members"`
+	} `json:"direct_channel"`
+	Post       *mattermostPost `json:"post"`
+	DirectPost *mattermostPost `json:"direct_post"`
+}
+
+// mattermostPost is a post of a channel or of a direct channel with its replies
+type mattermostPost struct {
+	mattermostReply
+
+	Team           string            `json:"team"`
+	Channel        string            `json:"channel"`
+	ChannelMembers []string          `json:"channel_members"`
+	Replies        []mattermostReply `json:"replies"`
+}
+
+type mattermostReply struct {
+	User        string `json:"user"`
+	Type        string `json:"type"`
+	Message     string `json:"message"`
+	CreateAt    int64  `json:"create_at"`
+	EditAt      int64  `json:"edit_at"`
+	Attachments []struct {
+		Path string `json:"path"`
+	} `json:"attachments"`
+}
+
+// mattermostArchive reads the bulk export, the users and the channels are read when it is opened
+// and the posts are read in a second pass. Users are identified by their usernames, channels by
+// the team and their name, direct channels by their members.
+type mattermostArchive struct {
+	files  fileSet
+	name   string
+	source string
+
+	users    []User
+	channels []Channel
+}
+
+func openMattermost(files fileSet) (*mattermostArchive, error) {
+	a := &mattermostArchive{
+		files:  files,
+		source: "mattermost",
+	}
+
+	names := files.names()
+	for _, name := range names {
+		if path.Ext(name) == ".jsonl" {
+			a.name = name
+			break
+		}
+	}
+	if a.name == "" && len(names) == 1 {
+		a.name = names[0]
+	}
+	if a.name == "" {
+		return nil, fmt.Errorf("no .jsonl file is found, it is not a Mattermost bulk export")
+	}
+
+	channels := make(map[string]*Channel)
+	channelIDs := []string{}
+	addChannel := func(channel Channel) *Channel {
+		if c, ok := channels[channel.ID]; ok {
+			return c
+		}
+
+		channels[channel.ID] = &channel
+		channelIDs = append(channelIDs, channel.ID)
+
+		return &channel
+	}
+
+	err := a.readLines(func(line *mattermostLine) error {
+		switch {
+		case line.Team != nil:
+			if a.source == "mattermost" {
+				a.source = "mattermost:" + line.Team.Name
+			}
+
+		case line.User != nil:
+			u := line.User
+			fullName := strings.TrimSpace(u.FirstName + " " + u.LastName)
+			if fullName == "" {
+				fullName = u.Nickname
+			}
+
+			a.users = append(a.users, User{
+				ID:       u.Username,
+				Username: u.Username,
+				FullName: fullName,
+				Email:    u.Email,
+				Deleted:  u.DeleteAt > 0,
+			})
+
+			for _, team := range u.Teams {
+				for _, c := range team.Channels {
+					channel := addChannel(Channel{ID: team.Name + "/" + c.Name, Name: c.Name})
+					channel.Members = append(channel.Members, u.Username)
+				}
+			}
+
+		case line.Channel != nil:
+			name := line.Channel.DisplayName
+			if name == "" {
+				name = line.Channel.Name
+			}
+
+			channel := addChannel(Channel{ID: line.Channel.Team + "/" + line.Channel.Name})
+			channel.Name = name
+
+		case line.DirectChannel != nil:
+			addChannel(newMattermostDirectChannel(line.DirectChannel.Members))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range channelIDs {
+		a.channels = append(a.channels, *channels[id])
+	}
+
+	return a, nil
+}
+
+func newMattermostDirectChannel(members []string) Channel {
+	sorted := append([]string{}, members...)
+	sort.Strings(sorted)
+
+	return Channel{
+		ID:      "direct:" + strings.Join(sorted, ","),
+		Name:    strings.Join(sorted, ", "),
+		Direct:  len(sorted) == 2,
+		Members: sorted,
+	}
+}
+
+func (a *mattermostArchive) readLines(fn func(line *mattermostLine) error) error {
+	file, err := a.files.open(a.name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	for {
+		line := mattermostLine{}
+		err = dec.Decode(&line)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid %s: %v", a.name, err)
+		}
+
+		err = fn(&line)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (a *mattermostArchive) Source() string {
+	return a.source
+}
+
+func (a *mattermostArchive) Users() []User {
+	return a.users
+}
+
+func (a *mattermostArchive) Channels() []Channel {
+	return a.channels
+}
+
+func (a *mattermostArchive) Messages(usernames map[string]string, fn func(messages []Message) error) error {
+	messages := []Message{}
+
+	err := a.readLines(func(line *mattermostLine) error {
+		post := line.Post
+		channelID := ""
+		if post != nil {
+			channelID = post.Team + "/" + post.Channel
+		} else if line.DirectPost != nil {
+			post = line.DirectPost
+			channelID = newMattermostDirectChannel(post.ChannelMembers).ID
+		} else {
+			return nil
+		}
+
+		for _, reply := range append([]mattermostReply{post.mattermostReply}, post.Replies...) {
+			if reply.User == "" || reply.CreateAt == 0 || strings.HasPrefix(reply.Type, "system_") {
+				continue
+			}
+
+			msg := Message{
+				ID:        fmt.Sprintf("%s/%s/%d", channelID, reply.User, reply.CreateAt),
+				ChannelID: channelID,
+				UserID:    reply.User,
+				Text:      convertMattermostText(reply.Message, usernames),
+				Action:    reply.Type == "me",
+				CreatedAt: time.Unix(0, reply.CreateAt*int64(time.Millisecond)),
+			}
+
+			if reply.EditAt > 0 {
+				editedAt := time.Unix(0, reply.EditAt*int64(time.Millisecond))
+				msg.EditedAt = &editedAt
+			}
+
+			for _, attachment := range reply.Attachments {
+				if attachment.Path != "" {
+					msg.Files = append(msg.Files, attachment.Path)
+				}
+			}
+
+			messages = append(messages, msg)
+		}
+
+		if len(messages) < mattermostBatchSize {
+			return nil
+		}
+
+		err := fn(messages)
+		messages = []Message{}
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(messages) > 0 {
+		return fn(messages)
+	}
+
+	return nil
+}
+
+func (a *mattermostArchive) Close() error {
+	return a.files.Close()
+}
+
+// convertMattermostText changes the mentions of the users whose usernames were changed by the import
+func convertMattermostText(text string, usernames map[string]string) string {
+	return mattermostMentionRe.ReplaceAllStringFunc(text, func(mention string) string {
+		name := mention[1:]
+
+		// A sentence may end after the mention
+		trimmed := strings.TrimRight(name, ".")
+		if username, ok := usernames[trimmed]; ok {
+			return "@" + username + name[len(trimmed):]
+		}
+
+		return mention
+	})
+}
@@ -0,0 +1,369 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message subtypes which are imported, the others are joins, topic changes and similar events
+var slackMessageSubtypes = map[string]bool{
+	"":                 true,
+	"me_message":       true,
+	"bot_message":      true,
+	"file_share":       true,
+	"thread_broadcast": true,
+}
+
+// Slack escapes <, > and & in the text, mentions, channels and links are in angle brackets
+var slackEntityRe = regexp.MustCompile(`<([^<>]+)>`)
+
+type slackUser struct {
+	ID       string `json:"id"`
+	TeamID   string `json:"team_id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Deleted  bool   `json:"deleted"`
+	IsBot    bool   `json:"is_bot"`
+	Profile  struct {
+		RealName string `json:"real_name"`
+		Email    string `json:"email"`
+	} `json:"profile"`
+}
+
+type slackChannel struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Creator string   `json:"creator"`
+	Members []string `json:"members"`
+}
+
+type slackMessage struct {
+	Type       string `json:"type"`
+	Subtype    string `json:"subtype"`
+	TS         string `json:"ts"`
+	User       string `json:"user"`
+	BotID      string `json:"bot_id"`
+	Username   string `json:"username"`
+	Text       string `json:"text"`
+	BotProfile *struct {
+		Name string `json:"name"`
+	} `json:"bot_profile"`
+	Files []struct {
+		Name       string `json:"name"`
+		URLPrivate string `json:"url_private"`
+		Permalink  string `json:"permalink"`
+	} `json:"files"`
+	Edited *struct {
+		TS string `json:"ts"`
+	} `json:"edited"`
+}
+
+type slackArchive struct {
+	files  fileSet
+	root   string
+	source string
+
+	users    []User
+	channels []Channel
+
+	// Directories of the messages by channel id
+	dirs map[string]string
+}
+
+func openSlack(files fileSet) (*slackArchive, error) {
+	root, ok := findRoot(files, "users.json")
+	if !ok {
+		return nil, fmt.Errorf("users.json is not found, it is not a Slack export")
+	}
+
+	a := &slackArchive{
+		files:  files,
+		root:   root,
+		source: "slack",
+		dirs:   make(map[string]string),
+	}
+
+	users := []slackUser{}
+	err := a.readJSON("users.json", &users)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		if u.TeamID != "" && a.source == "slack" {
+			a.source = "slack:" + u.TeamID
+		}
+
+		fullName := u.Profile.RealName
+		if fullName == "" {
+			fullName = u.RealName
+		}
+
+		a.users = append(a.users, User{
+			ID:       u.ID,
+			Username: u.Name,
+			FullName: fullName,
+			Email:    u.Profile.Email,
+			Bot:      u.IsBot,
+			Deleted:  u.Deleted,
+		})
+	}
+
+	// Public and private channels have directories named after them, direct messages after their ids
+	lists := []struct {
+		name   string
+		direct bool
+		byID   bool
+	}{
+		{"channels.json", false, false},
+		{"groups.json", false, false},
+		{"mpims.json", false, false},
+		{"dms.json", true, true},
+	}
+
+	for _, list := range lists {
+		channels := []slackChannel{}
+		err = a.readJSON(list.name, &channels)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, c := range channels {
+			dir := c.Name
+			if list.byID || dir == "" {
+				dir = c.ID
+			}
+			a.dirs[c.ID] = joinPath(root, dir)
+
+			a.channels = append(a.channels, Channel{
+				ID:        c.ID,
+				Name:      c.Name,
+				Direct:    list.direct,
+				CreatorID: c.Creator,
+				Members:   c.Members,
+			})
+		}
+	}
+
+	return a, nil
+}
+
+func (a *slackArchive) readJSON(name string, result interface{}) error {
+	file, err := a.files.open(joinPath(a.root, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(result)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return nil
+}
+
+func (a *slackArchive) Source() string {
+	return a.source
+}
+
+func (a *slackArchive) Users() []User {
+	return a.users
+}
+
+func (a *slackArchive) Channels() []Channel {
+	return a.channels
+}
+
+// Messages reads the messages of every channel from its daily files, a batch is the messages of a day
+func (a *slackArchive) Messages(usernames map[string]string, fn func(messages []Message) error) error {
+	days := make(map[string][]string)
+	for _, name := range a.files.names() {
+		if path.Ext(name) == ".json" {
+			days[path.Dir(name)] = append(days[path.Dir(name)], name)
+		}
+	}
+
+	for _, channel := range a.channels {
+		dir := a.dirs[channel.ID]
+		if dir == "" {
+			dir = "."
+		}
+		sort.Strings(days[dir])
+
+		for _, day := range days[dir] {
+			messages, err := a.readDay(&channel, day, usernames)
+			if err != nil {
+				return err
+			}
+
+			if len(messages) > 0 {
+				err = fn(messages)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *slackArchive) Close() error {
+	return a.files.Close()
+}
+
+func (a *slackArchive) readDay(channel *Channel, name string, usernames map[string]string) ([]Message, error) {
+	file, err := a.files.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	slackMessages := []slackMessage{}
+	err = json.NewDecoder(file).Decode(&slackMessages)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	messages := []Message{}
+	for _, m := range slackMessages {
+		if m.Type != "message" || !slackMessageSubtypes[m.Subtype] {
+			continue
+		}
+
+		createdAt, ok := parseSlackTS(m.TS)
+		if !ok {
+			continue
+		}
+
+		msg := Message{
+			ID:        channel.ID + "/" + m.TS,
+			ChannelID: channel.ID,
+			UserID:    m.User,
+			Text:      convertSlackText(m.Text, usernames),
+			Action:    m.Subtype == "me_message",
+			CreatedAt: createdAt,
+		}
+
+		// Messages of integrations have no user, the bot is the author
+		if msg.UserID == "" {
+			if m.BotID == "" {
+				continue
+			}
+
+			name := m.Username
+			if name == "" && m.BotProfile != nil {
+				name = m.BotProfile.Name
+			}
+			if name == "" {
+				name = m.BotID
+			}
+
+			msg.UserID = "bot:" + m.BotID
+			msg.Author = &User{ID: msg.UserID, Username: name, FullName: name, Bot: true}
+		}
+
+		if m.Edited != nil {
+			if editedAt, ok := parseSlackTS(m.Edited.TS); ok {
+				msg.EditedAt = &editedAt
+			}
+		}
+
+		for _, f := range m.Files {
+			link := f.Permalink
+			if link == "" {
+				link = f.URLPrivate
+			}
+			if link != "" {
+				msg.Files = append(msg.Files, link)
+			}
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// parseSlackTS reads the timestamps of the messages, which are unix seconds with microseconds, e.g. 1500000000.000100
+func parseSlackTS(ts string) (time.Time, bool) {
+	parts := strings.SplitN(ts, ".", 2)
+
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var usec int64
+	if len(parts) == 2 {
+		frac := (parts[1] + "000000")[:6]
+		usec, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	return time.Unix(sec, usec*int64(time.Microsecond)), true
+}
+
+// convertSlackText replaces the Slack entities with the markup of the messages
+func convertSlackText(text string, usernames map[string]string) string {
+	text = slackEntityRe.ReplaceAllStringFunc(text, func(entity string) string {
+		value := entity[1 : len(entity)-1]
+
+		label := ""
+		if i := strings.Index(value, "|"); i >= 0 {
+			value, label = value[:i], value[i+1:]
+		}
+
+		switch {
+		case strings.HasPrefix(value, "@"):
+			if username, ok := usernames[value[1:]]; ok {
+				return "@" + username
+			}
+			if label != "" {
+				return "@" + strings.TrimPrefix(label, "@")
+			}
+			return value
+
+		case strings.HasPrefix(value, "#"):
+			if label != "" {
+				return "#" + label
+			}
+			return value
+
+		case value == "!here" || value == "!channel" || value == "!everyone":
+			return "@all"
+
+		case strings.HasPrefix(value, "!"):
+			if label != "" {
+				return label
+			}
+			return ""
+
+		case strings.HasPrefix(value, "mailto:"):
+			if label != "" {
+				return label
+			}
+			return strings.TrimPrefix(value, "mailto:")
+		}
+
+		if label != "" && label != value {
+			return "[" + label + "](" + value + ")"
+		}
+
+		return value
+	})
+
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"unicode/utf8"
+
+	"./model"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// Maximum length of the text posted through an incoming webhook
+const incomingWebhookMaxTextLen = 64 * 1024
+
+type IncomingWebhookData struct {
+	Name string `json:"name"`
+}
+
+// IncomingWebhookWithURL is returned only when the webhook is created, the secret can't be read later
+type IncomingWebhookWithURL struct {
+	model.IncomingWebhook
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// IncomingWebhookMessage is the request body of posting through an incoming webhook
+type IncomingWebhookMessage struct {
+	Text string `json:"text"`
+}
+
+func (c *apiController) listIncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks := []model.IncomingWebhook{}
+	err := c.store.IncomingWebhookRepo.ListByChatID(mux.Vars(r)["chatID"], &webhooks)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, webhooks)
+}
+
+// createIncomingWebhook creates the webhook together with the bot user which authors its messages
+func (c *apiController) createIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	data := IncomingWebhookData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Validate webhook data
+	{
+		errs := validationErrors{}
+
+		if data.Name == "" {
+			errs.add("name", FieldErrRequired, "Name is required")
+		} else if len(data.Name) >= 256 {
+			errs.add("name", FieldErrTooLong, "Name must be less than 256 characters long")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
+	secretBytes := make([]byte, 24)
+	_, err = rand.Read(secretBytes)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate webhook secret")
+		return
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	bot := model.User{}
+	bot.FullName = data.Name
+	bot.OwnerID = contextUserID(r)
+	err = c.store.UserRepo.CreateBot(&bot)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	webhook := model.IncomingWebhook{
+		ChatID:     mux.Vars(r)["chatID"],
+		CreatorID:  contextUserID(r),
+		BotUserID:  bot.ID,
+		Name:       data.Name,
+		SecretHash: hashIncomingWebhookSecret(secret),
+	}
+	err = c.store.IncomingWebhookRepo.Create(&webhook)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	// Clients resolve message authors from the user list
+	c.broadcastUserChange(bot.ID, WSTypeUserCreate)
+
+	c.writeResponse(w, http.StatusCreated, &IncomingWebhookWithURL{
+		IncomingWebhook: webhook,
+		URL:             c.publicURL + apiV1Prefix + "/hooks/" + webhook.ID + "/" + secret,
+		Secret:          secret,
+	})
+}
+
+// deleteIncomingWebhook removes the webhook. Its bot user is kept as the author of the posted messages.
+func (c *apiController) deleteIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	webhook := model.IncomingWebhook{}
+	err := c.store.IncomingWebhookRepo.Get(vars["webhookID"], &webhook)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	if webhook.ChatID != vars["chatID"] {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeNotFound, "Incoming webhook is not found")
+		return
+	}
+
+	err = c.store.IncomingWebhookRepo.Delete(webhook.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// postIncomingWebhook creates a message in the chat of the webhook. The secret in the URL is the
+// only authentication, so an invalid secret is reported the same way as an unknown webhook.
+func (c *apiController) postIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	webhook := model.IncomingWebhook{}
+	err := c.store.IncomingWebhookRepo.Get(vars["hookID"], &webhook)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	if err != nil || !hmac.Equal([]byte(webhook.SecretHash), []byte(hashIncomingWebhookSecret(vars["secret"]))) {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeNotFound, "Incoming webhook is not found")
+		return
+	}
+
+	data := IncomingWebhookMessage{}
+	err = c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Validate message data
+	{
+		errs := validationErrors{}
+
+		if data.Text == "" {
+			errs.add("text", FieldErrRequired, "Text is required")
+		} else if utf8.RuneCountInString(data.Text) > incomingWebhookMaxTextLen {
+			errs.add("text", FieldErrTooLong, "Text must be at most 65536 characters long")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
+	msg := model.Message{
+		UserID:  webhook.BotUserID,
+		ChatID:  webhook.ChatID,
+		Message: data.Text,
+	}
+	err = c.postMessage(&msg)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusCreated, msg)
+}
+
+// Only the hash of the secret is stored, so the database doesn't contain usable webhook URLs
+func hashIncomingWebhookSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"./model"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxChatInviteUses     = 10000
+	maxChatInviteLifetime = 365 * 24 * time.Hour
+)
+
+// ChatInviteData is the request body of creating invites, zero maxUses and no expiresAt mean no limit
+type ChatInviteData struct {
+	MaxUses   int        `json:"maxUses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (c *apiController) listChatInvites(w http.ResponseWriter, r *http.Request) {
+	invites := []model.ChatInvite{}
+	err := c.store.ChatInviteRepo.ListByChatID(mux.Vars(r)["chatID"], &invites)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeInviteNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, invites)
+}
+
+func (c *apiController) createChatInvite(w http.ResponseWriter, r *http.Request) {
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(mux.Vars(r)["chatID"], &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	if chat.DirectUserID != "" {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, errDirectChatMembers.Error())
+		return
+	}
+
+	data := ChatInviteData{}
+	err = c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Validate invite data
+	{
+		errs := validationErrors{}
+
+		if data.MaxUses < 0 || data.MaxUses > maxChatInviteUses {
+			errs.add("maxUses", FieldErrInvalid, "Max uses must be between 0 and 10000")
+		}
+
+		now := time.Now()
+		if data.ExpiresAt != nil && !data.ExpiresAt.After(now) {
+			errs.add("expiresAt", FieldErrInvalid, "Expiration must be in the future")
+		} else if data.ExpiresAt != nil && data.ExpiresAt.After(now.Add(maxChatInviteLifetime)) {
+			errs.add("expiresAt", FieldErrInvalid, "Expiration must be within a year")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
+	invite := model.ChatInvite{
+		ChatID:    chat.ID,
+		CreatorID: contextUserID(r),
+		MaxUses:   data.MaxUses,
+		ExpiresAt: data.ExpiresAt,
+	}
+	err = c.store.ChatInviteRepo.Create(&invite)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeInviteNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusCreated, invite)
+}
+
+// deleteChatInvite revokes the invite, only its creator and the chat creator can revoke it
+func (c *apiController) deleteChatInvite(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	currentUserID := contextUserID(r)
+
+	invite := model.ChatInvite{}
+	err := c.store.ChatInviteRepo.Get(vars["inviteID"], &invite)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeInviteNotFound)
+		return
+	}
+
+	if invite.ChatID != vars["chatID"] {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeInviteNotFound, "Invite is not found")
+		return
+	}
+
+	if invite.CreatorID != currentUserID {
+		chat := model.Chat{}
+		err = c.store.ChatRepo.Get(invite.ChatID, &chat)
+		if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+			return
+		}
+
+		if chat.CreatorID != currentUserID {
+			c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the invite creator or the chat creator can revoke the invite")
+			return
+		}
+	}
+
+	err = c.store.ChatInviteRepo.Delete(invite.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeInviteNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// getChatInvite previews the chat of the invite before it is redeemed
+func (c *apiController) getChatInvite(w http.ResponseWriter, r *http.Request) {
+	_, chat, ok := c.getUsableChatInvite(w, r)
+	if !ok {
+		return
+	}
+
+	userIDs, err := c.listChatUserIDs(chat.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	currentUserID := contextUserID(r)
+	preview := model.DiscoverableChat{
+		Chat:        *chat,
+		MemberCount: int64(len(userIDs)),
+	}
+	for _, userID := range userIDs {
+		if userID == currentUserID {
+			preview.Member = true
+			break
+		}
+	}
+
+	c.writeResponse(w, http.StatusOK, preview)
+}
+
+// redeemChatInvite adds the current user to the chat of the invite. Members redeeming the invite
+// get the chat without using the invite up.
+func (c *apiController) redeemChatInvite(w http.ResponseWriter, r *http.Request) {
+	invite, chat, ok := c.getUsableChatInvite(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := contextUser(r)
+	isMember, err := c.store.ChatUserRepo.Exists(chat.ID, currentUser.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	if !isMember {
+		if currentUser.IsSuspended() {
+			c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, errAddSuspendedUser.Error())
+			return
+		}
+
+		redeemed, err := c.store.ChatInviteRepo.Redeem(invite.ID, time.Now())
+		if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeInviteNotFound)
+			return
+		}
+
+		if !redeemed {
+			c.writeErrorResponse(w, r, http.StatusGone, ErrCodeInviteExpired, "Invite has expired")
+			return
+		}
+
+		err = c.addChatMember(chat, currentUser)
+		if err == errDirectChatMembers {
+			c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, err.Error())
+			return
+		} else if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+			return
+		}
+	}
+
+	c.writeResponse(w, http.StatusOK, chat)
+}
+
+// getUsableChatInvite loads the invite of the request and its chat, the expired and used up invites
+// are reported as gone
+func (c *apiController) getUsableChatInvite(w http.ResponseWriter, r *http.Request) (*model.ChatInvite, *model.Chat, bool) {
+	invite := model.ChatInvite{}
+	err := c.store.ChatInviteRepo.GetByCode(mux.Vars(r)["code"], &invite)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeInviteNotFound)
+		return nil, nil, false
+	}
+
+	if !invite.IsUsable(time.Now()) {
+		c.writeErrorResponse(w, r, http.StatusGone, ErrCodeInviteExpired, "Invite has expired")
+		return nil, nil, false
+	}
+
+	chat := model.Chat{}
+	err = c.store.ChatRepo.Get(invite.ChatID, &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return nil, nil, false
+	}
+
+	return &invite, &chat, true
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"./dbcontroller"
+	"./markup"
+	"./model"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	linkPreviewTimeout = 5 * time.Second
+
+	// Only the beginning of the pages is read, the metadata is in the head
+	linkPreviewMaxBodySize  = 512 * 1024
+	linkPreviewMaxRedirects = 3
+
+	// Previews of at most that many links are fetched for a single message
+	linkPreviewMaxLinks = 3
+
+	// Fetched previews are reused within the TTL, failures are retried sooner
+	linkPreviewTTL        = 24 * time.Hour
+	linkPreviewFailureTTL = time.Hour
+
+	linkPreviewRetention     = 7 * 24 * time.Hour
+	linkPreviewSweepInterval = time.Hour
+
+	linkPreviewQueueSize = 1000
+	linkPreviewWorkers   = 4
+
+	linkPreviewMaxTitleLen       = 300
+	linkPreviewMaxDescriptionLen = 1000
+	linkPreviewMaxSiteNameLen    = 100
+	linkPreviewMaxURLLen         = 2048
+
+	linkPreviewUserAgent = "ChatApp-LinkPreview/1.0"
+)
+
+var errLinkPreviewForbiddenAddress = errors.New("Address is not allowed")
+
+// Networks which can't be fetched, so the users can't make the server request internal services
+var linkPreviewBlockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+var (
+	htmlHeadEndRe   = regexp.MustCompile(`(?i)</head\s*>`)
+	htmlMetaTagRe   = regexp.MustCompile(`(?is)<meta\s([^>]*)>`)
+	htmlLinkTagRe   = regexp.MustCompile(`(?is)<link\s([^>]*)>`)
+	htmlTitleRe     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title\s*>`)
+	htmlAttrRe      = regexp.MustCompile(`(?s)([a-zA-Z_:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	htmlCommentRe   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlScriptTagRe = regexp.MustCompile(`(?is)<script[^>]*>.*?</script\s*>`)
+)
+
+// oEmbedResponse contains the fields of oEmbed responses used in the previews
+type oEmbedResponse struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	URL          string `json:"url"`
+	Type         string `json:"type"`
+}
+
+// LinkPreviewer fetches the previews of the links in the messages in the background.
+// The messages are updated and the message_update event is sent when the previews are ready.
+type LinkPreviewer struct {
+	store  *dbcontroller.Store
+	client *http.Client
+
+	messages chan *model.Message
+}
+
+// newLinkPreviewer creates the previewer. Private networks can be allowed for development,
+// otherwise only public addresses are fetched.
+func newLinkPreviewer(store *dbcontroller.Store, allowPrivateNetworks bool) *LinkPreviewer {
+	return &LinkPreviewer{
+		store:    store,
+		client:   newLinkPreviewClient(allowPrivateNetworks),
+		messages: make(chan *model.Message, linkPreviewQueueSize),
+	}
+}
+
+// newPublicDialer checks the addresses when the connections are dialed, after the host names
+// are resolved, so also redirects and DNS records pointing to internal addresses are rejected.
+// It is used by the clients which request the URLs given by the users.
+func newPublicDialer(timeout time.Duration, allowPrivateNetworks bool) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, conn syscall.RawConn) error {
+			if allowPrivateNetworks {
+				return nil
+			}
+
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || isBlockedIP(ip) {
+				return errLinkPreviewForbiddenAddress
+			}
+
+			return nil
+		},
+	}
+}
+
+func newLinkPreviewClient(allowPrivateNetworks bool) *http.Client {
+	dialer := newPublicDialer(linkPreviewTimeout, allowPrivateNetworks)
+
+	return &http.Client{
+		Timeout: linkPreviewTimeout,
+		Transport: &http.Transport{
+			// Proxies from the environment would dial the addresses instead of the dialer
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   linkPreviewTimeout,
+			ResponseHeaderTimeout: linkPreviewTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > linkPreviewMaxRedirects {
+				return errors.New("Too many redirects")
+			}
+
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("Redirect to unsupported scheme")
+			}
+
+			return nil
+		},
+	}
+}
+
+// notifyMessage queues fetching the previews of the created or edited message without blocking the caller
+func (p *LinkPreviewer) notifyMessage(msg *model.Message) {
+	msgCopy := *msg
+
+	select {
+	case p.messages <- &msgCopy:
+	default:
+		log.Printf("Link preview queue is full, dropping previews of message %s\n", msg.ID)
+	}
+}
+
+// run fetches the previews of the queued messages, updated is called with the messages which got new previews
+func (p *LinkPreviewer) run(updated func(msg *model.Message)) {
+	go p.runSweeper()
+
+	for i := 0; i < linkPreviewWorkers; i++ {
+		go func() {
+			for msg := range p.messages {
+				err := p.update(msg, updated)
+				if err != nil {
+					log.Printf("Failed to update link previews of message %s: %+v\n", msg.ID, err)
+				}
+			}
+		}()
+	}
+}
+
+func (p *LinkPreviewer) update(msg *model.Message, updated func(msg *model.Message)) error {
+	urls := markup.LinkURLs(markup.Parse(msg.Message))
+	if len(urls) == 0 && len(msg.Previews) == 0 {
+		return nil
+	}
+
+	if len(urls) > linkPreviewMaxLinks {
+		urls = urls[:linkPreviewMaxLinks]
+	}
+
+	previews := model.LinkPreviews{}
+	for _, pageURL := range urls {
+		preview, err := p.preview(pageURL)
+		if err != nil {
+			return err
+		}
+
+		if preview != nil {
+			previews = append(previews, *preview)
+		}
+	}
+
+	current := model.Message{}
+	err := p.store.MessageRepo.Get(msg.ID, &current)
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// The message was edited in the meantime, the edit queued its own previews
+	if current.Message != msg.Message {
+		return nil
+	}
+
+	if len(previews) == 0 && len(current.Previews) == 0 || reflect.DeepEqual(previews, current.Previews) {
+		return nil
+	}
+
+	err = p.store.MessageRepo.UpdatePreviews(current.ID, previews)
+	if err != nil {
+		return err
+	}
+
+	current.Previews = previews
+	updated(&current)
+
+	return nil
+}
+
+// preview returns the cached preview of the URL, or fetches it. It returns nil when the URL has no preview.
+func (p *LinkPreviewer) preview(pageURL string) (*model.LinkPreview, error) {
+	hash := sha256.Sum256([]byte(pageURL))
+	urlHash := hex.EncodeToString(hash[:])
+
+	cached := model.CachedLinkPreview{}
+	err := p.store.LinkPreviewRepo.Get(urlHash, &cached)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	if err == nil && cached.FetchedAt != nil {
+		ttl := linkPreviewTTL
+		if cached.Failed {
+			ttl = linkPreviewFailureTTL
+		}
+
+		if time.Since(*cached.FetchedAt) < ttl {
+			if cached.Failed {
+				return nil, nil
+			}
+			return &cached.LinkPreview, nil
+		}
+	}
+
+	now := time.Now()
+	cached = model.CachedLinkPreview{
+		URLHash:   urlHash,
+		FetchedAt: &now,
+	}
+
+	preview, err := p.fetch(pageURL)
+	if err != nil {
+		log.Printf("Failed to fetch link preview of %s: %+v\n", pageURL, err)
+
+		cached.URL = pageURL
+		cached.Failed = true
+		preview = nil
+	} else {
+		cached.LinkPreview = *preview
+	}
+
+	err = p.store.LinkPreviewRepo.Save(&cached)
+	if err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
+
+// fetch reads the OpenGraph and Twitter card metadata of the page. The oEmbed endpoint
+// advertised by the page completes the metadata which the page doesn't have.
+func (p *LinkPreviewer) fetch(pageURL string) (*model.LinkPreview, error) {
+	body, pageBase, err := p.get(pageURL, "text/html,application/xhtml+xml", "text/html", "application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+
+	meta, oEmbedURL := parseHTMLMetadata(body)
+
+	preview := &model.LinkPreview{
+		URL:         pageURL,
+		Title:       firstNonEmpty(meta["og:title"], meta["twitter:title"], meta["title"]),
+		Description: firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"]),
+		ImageURL:    resolvePreviewURL(pageBase, firstNonEmpty(meta["og:image:secure_url"], meta["og:image"], meta["og:image:url"], meta["twitter:image"], meta["twitter:image:src"])),
+		SiteName:    meta["og:site_name"],
+	}
+
+	if oEmbedURL != "" && (preview.Title == "" || preview.ImageURL == "") {
+		target := resolvePreviewURL(pageBase, oEmbedURL)
+		if target != "" {
+			oEmbed, err := p.fetchOEmbed(target)
+			if err != nil {
+				log.Printf("Failed to fetch oEmbed of %s: %+v\n", pageURL, err)
+			} else {
+				if preview.Title == "" {
+					preview.Title = firstNonEmpty(oEmbed.Title, oEmbed.AuthorName)
+				}
+				if preview.ImageURL == "" {
+					preview.ImageURL = resolvePreviewURL(pageBase, oEmbed.ThumbnailURL)
+				}
+				if preview.ImageURL == "" && oEmbed.Type == "photo" {
+					preview.ImageURL = resolvePreviewURL(pageBase, oEmbed.URL)
+				}
+				if preview.SiteName == "" {
+					preview.SiteName = oEmbed.ProviderName
+				}
+			}
+		}
+	}
+
+	preview.Title = cleanPreviewText(preview.Title, linkPreviewMaxTitleLen)
+	preview.Description = cleanPreviewText(preview.Description, linkPreviewMaxDescriptionLen)
+	preview.SiteName = cleanPreviewText(preview.SiteName, linkPreviewMaxSiteNameLen)
+
+	if preview.Title == "" {
+		return nil, errors.New("Page has no title")
+	}
+
+	return preview, nil
+}
+
+func (p *LinkPreviewer) fetchOEmbed(target string) (*oEmbedResponse, error) {
+	body, _, err := p.get(target, "application/json", "application/json", "text/javascript", "text/json")
+	if err != nil {
+		return nil, err
+	}
+
+	oEmbed := &oEmbedResponse{}
+	err = json.Unmarshal(body, oEmbed)
+	if err != nil {
+		return nil, err
+	}
+
+	return oEmbed, nil
+}
+
+// get reads up to linkPreviewMaxBodySize bytes of the response with one of the media types.
+// It returns the body and the URL of the response after redirects.
+func (p *LinkPreviewer) get(target, accept string, mediaTypes ...string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", linkPreviewUserAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("Response status %d", resp.StatusCode)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	supported := false
+	for _, t := range mediaTypes {
+		if mediaType == t {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, nil, fmt.Errorf("Unsupported content type: %s", mediaType)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, linkPreviewMaxBodySize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, resp.Request.URL, nil
+}
+
+func (p *LinkPreviewer) runSweeper() {
+	for {
+		removed, err := p.store.LinkPreviewRepo.DeleteFetchedBefore(time.Now().Add(-linkPreviewRetention))
+		if err != nil {
+			log.Printf("Failed to remove cached link previews: %+v\n", err)
+		} else if removed > 0 {
+			log.Printf("Removed %d cached link previews\n", removed)
+		}
+
+		time.Sleep(linkPreviewSweepInterval)
+	}
+}
+
+// parseHTMLMetadata reads the title and the meta tags in the head of the page, keyed by their lowercase
+// property or name, and the URL of the JSON oEmbed endpoint. The first value of a key is kept.
+func parseHTMLMetadata(body []byte) (map[string]string, string) {
+	page := string(body)
+	if loc := htmlHeadEndRe.FindStringIndex(page); loc != nil {
+		page = page[:loc[0]]
+	}
+	page = htmlCommentRe.ReplaceAllString(page, "")
+	page = htmlScriptTagRe.ReplaceAllString(page, "")
+
+	meta := make(map[string]string)
+	for _, match := range htmlMetaTagRe.FindAllStringSubmatch(page, -1) {
+		attrs := parseHTMLAttrs(match[1])
+
+		key := strings.ToLower(firstNonEmpty(attrs["property"], attrs["name"]))
+		if key == "" || key == "title" {
+			continue
+		}
+
+		if _, ok := meta[key]; !ok {
+			meta[key] = attrs["content"]
+		}
+	}
+
+	if match := htmlTitleRe.FindStringSubmatch(page); match != nil {
+		meta["title"] = html.UnescapeString(match[1])
+	}
+
+	oEmbedURL := ""
+	for _, match := range htmlLinkTagRe.FindAllStringSubmatch(page, -1) {
+		attrs := parseHTMLAttrs(match[1])
+
+		rels := strings.Fields(strings.ToLower(attrs["rel"]))
+		isAlternate := false
+		for _, rel := range rels {
+			if rel == "alternate" {
+				isAlternate = true
+			}
+		}
+
+		if isAlternate && strings.ToLower(attrs["type"]) == "application/json+oembed" && attrs["href"] != "" {
+			oEmbedURL = attrs["href"]
+			break
+		}
+	}
+
+	return meta, oEmbedURL
+}
+
+// parseHTMLAttrs returns the unescaped attribute values by their lowercase names
+func parseHTMLAttrs(text string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range htmlAttrRe.FindAllStringSubmatch(text, -1) {
+		name := strings.ToLower(match[1])
+		if _, ok := attrs[name]; !ok {
+			attrs[name] = html.UnescapeString(match[2] + match[3] + match[4])
+		}
+	}
+
+	return attrs
+}
+
+// resolvePreviewURL resolves the URL found in the page against the page URL.
+// It returns an empty string when the URL isn't a valid http or https URL.
+func resolvePreviewURL(base *url.URL, target string) string {
+	target = strings.TrimSpace(target)
+	if target == "" || len(target) > linkPreviewMaxURLLen {
+		return ""
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+
+	u = base.ResolveReference(u)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+
+	resolved := u.String()
+	if len(resolved) > linkPreviewMaxURLLen {
+		return ""
+	}
+
+	return resolved
+}
+
+// cleanPreviewText replaces invalid UTF-8, collapses whitespace and truncates the text to n characters
+func cleanPreviewText(text string, n int) string {
+	text = strings.Map(func(r rune) rune { return r }, text)
+	text = strings.Join(strings.Fields(text), " ")
+
+	return truncate(text, n)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// checkPublicHost rejects the hosts which are or resolve to blocked addresses. The dialer checks the
+// addresses again, since the DNS records can change after the check.
+func checkPublicHost(host string) error {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		ips, err = net.LookupIP(host)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ip := range ips {
+		if isBlockedIP(ip) {
+			return errLinkPreviewForbiddenAddress
+		}
+	}
+
+	return nil
+}
+
+func isBlockedIP(ip net.IP) bool {
+	for _, network := range linkPreviewBlockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+
+	return networks
+}
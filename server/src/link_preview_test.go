@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLinkPreviewFixtures serves the pages which the previews are fetched from
+func newLinkPreviewFixtures() *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+<title>Page title</title>
+<meta property="og:title" content="OpenGraph &amp; title">
+<meta property="og:description" content="  Description
+  of the page ">
+<meta property="og:image" content="/image.png">
+<meta name="twitter:image" content="/twitter.png">
+<meta property="og:site_name" content="Fixtures">
+</head><body><meta property="og:title" content="Body title"></body></html>`)
+	})
+
+	mux.HandleFunc("/oembed-page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head>
+<meta name="description" content="Described by the page">
+<link rel="alternate" type="application/json+oembed" href="/oembed.json?url=page">
+</head></html>`)
+	})
+
+	mux.HandleFunc("/oembed.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"title":"oEmbed title","provider_name":"Provider","thumbnail_url":"/thumbnail.jpg","type":"video"}`)
+	})
+
+	mux.HandleFunc("/late-title", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><!--"+strings.Repeat("x", linkPreviewMaxBodySize)+"--><title>Late title</title></head></html>")
+	})
+
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Large page</title></head><body>"+strings.Repeat("x", 4*linkPreviewMaxBodySize)+"</body></html>")
+	})
+
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "<title>Not a page</title>")
+	})
+
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		n := 0
+		fmt.Sscan(strings.TrimPrefix(r.URL.Path, "/redirect/"), &n)
+		if n == 0 {
+			http.Redirect(w, r, "/og", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestLinkPreviewOpenGraph(t *testing.T) {
+	server := newLinkPreviewFixtures()
+	defer server.Close()
+
+	p := &LinkPreviewer{client: newLinkPreviewClient(true)}
+
+	preview, err := p.fetch(server.URL + "/og")
+	if err != nil {
+		t.Fatalf("Failed to fetch the preview: %v", err)
+	}
+
+	if preview.Title != "OpenGraph & title" {
+		t.Errorf("Title is %q", preview.Title)
+	}
+	if preview.Description != "Description of the page" {
+		t.Errorf("Description is %q", preview.Description)
+	}
+	if preview.ImageURL != server.URL+"/image.png" {
+		t.Errorf("Image URL is %q", preview.ImageURL)
+	}
+	if preview.SiteName != "Fixtures" {
+		t.Errorf("Site name is %q", preview.SiteName)
+	}
+}
+
+func TestLinkPreviewOEmbed(t *testing.T) {
+	server := newLinkPreviewFixtures()
+	defer server.Close()
+
+	p := &LinkPreviewer{client: newLinkPreviewClient(true)}
+
+	preview, err := p.fetch(server.URL + "/oembed-page")
+	if err != nil {
+		t.Fatalf("Failed to fetch the preview: %v", err)
+	}
+
+	if preview.Title != "oEmbed title" {
+		t.Errorf("Title is %q", preview.Title)
+	}
+	if preview.Description != "Described by the page" {
+		t.Errorf("Description is %q", preview.Description)
+	}
+	if preview.ImageURL != server.URL+"/thumbnail.jpg" {
+		t.Errorf("Image URL is %q", preview.ImageURL)
+	}
+	if preview.SiteName != "Provider" {
+		t.Errorf("Site name is %q", preview.SiteName)
+	}
+}
+
+func TestLinkPreviewLimits(t *testing.T) {
+	server := newLinkPreviewFixtures()
+	defer server.Close()
+
+	p := &LinkPreviewer{client: newLinkPreviewClient(true)}
+
+	// Only the beginning of the page is read
+	_, err := p.fetch(server.URL + "/late-title")
+	if err == nil {
+		t.Error("Title after the size limit was read")
+	}
+
+	preview, err := p.fetch(server.URL + "/large")
+	if err != nil || preview.Title != "Large page" {
+		t.Errorf("Large page returned %+v, %v", preview, err)
+	}
+
+	_, err = p.fetch(server.URL + "/text")
+	if err == nil || !strings.Contains(err.Error(), "Unsupported content type") {
+		t.Errorf("Plain text page returned %v", err)
+	}
+
+	preview, err = p.fetch(server.URL + fmt.Sprintf("/redirect/%d", linkPreviewMaxRedirects-1))
+	if err != nil || preview.Title != "OpenGraph & title" {
+		t.Errorf("Page after %d redirects returned %+v, %v", linkPreviewMaxRedirects, preview, err)
+	}
+
+	_, err = p.fetch(server.URL + fmt.Sprintf("/redirect/%d", linkPreviewMaxRedirects))
+	if err == nil || !strings.Contains(err.Error(), "Too many redirects") {
+		t.Errorf("Page after %d redirects returned %v", linkPreviewMaxRedirects+1, err)
+	}
+
+	// The fixture doesn't respond, so the request is cut off at the timeout of the client
+	p.client.Timeout = 200 * time.Millisecond
+	start := time.Now()
+	_, err = p.fetch(server.URL + "/slow")
+	if err == nil {
+		t.Error("Slow page was fetched")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Slow page was fetched for %v", elapsed)
+	}
+}
+
+func TestLinkPreviewBlockedAddresses(t *testing.T) {
+	server := newLinkPreviewFixtures()
+	defer server.Close()
+
+	p := &LinkPreviewer{client: newLinkPreviewClient(false)}
+
+	for _, target := range []string{
+		server.URL + "/og",
+		strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/og",
+	} {
+		_, err := p.fetch(target)
+		if err == nil || !strings.Contains(err.Error(), errLinkPreviewForbiddenAddress.Error()) {
+			t.Errorf("Fetching %s returned %v, want %v", target, err, errLinkPreviewForbiddenAddress)
+		}
+	}
+
+	tests := map[string]bool{
+		"127.0.0.1":        true,
+		"10.1.2.3":         true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"100.64.0.1":       true,
+		"0.0.0.0":          true,
+		"::1":              true,
+		"fd00::1":          true,
+		"fe80::1":          true,
+		"::ffff:127.0.0.1": true,
+		"93.184.216.34":    false,
+		"8.8.8.8":          false,
+		"2606:4700::1111":  false,
+	}
+	for address, blocked := range tests {
+		if isBlockedIP(net.ParseIP(address)) != blocked {
+			t.Errorf("Address %s blocked: %v, want %v", address, !blocked, blocked)
+		}
+	}
+}
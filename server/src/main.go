@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
 
+	"./broker"
 	"./dbcontroller"
+	"./mailer"
+	"./model"
+	"./webpush"
 )
 
 const gracefullShutdownTimeout = time.Second * 5
@@ -36,8 +43,32 @@ func main() {
 	store.AutoMigrate()
 	log.Println("Auto migration completed")
 
+	// The import subcommand runs instead of the server, e.g. server import -format slack export.zip
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		err = runImportCommand(store, os.Args[2:])
+		store.Close()
+		if err != nil {
+			log.Printf("Import failed: %+v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	go renderMissingMessageHTML(store)
+
+	// Comma separated list of usernames which are granted the admin role on startup
+	if adminUsernames := os.Getenv("ADMIN_USERNAMES"); adminUsernames != "" {
+		promoteAdmins(store, strings.Split(adminUsernames, ","))
+	}
+
+	// Comma separated list of origins allowed to use the API from browsers, e.g. http://localhost:3001
 	origins := []string{"*"}
-	// origins := []string{"http://localhost:3001"}
+	if value := os.Getenv("CORS_ALLOWED_ORIGINS"); value != "" {
+		origins = strings.Split(value, ",")
+		for i := range origins {
+			origins[i] = strings.TrimSpace(origins[i])
+		}
+	}
 	methods := []string{
 		http.MethodGet,
 		http.MethodPost,
@@ -45,40 +76,129 @@ func main() {
 		http.MethodDelete,
 	}
 
-	wsHub := newWsHub()
+	eventBroker, err := newBroker()
+	if err != nil {
+		log.Printf("Failed to initialize event broker: %+v\n", err)
+		os.Exit(1)
+	}
+	log.Println("Event broker initialization completed")
+
+	// Retention of the event log used to replay missed events to reconnecting clients
+	eventRetention := defaultEventRetention
+	if value := os.Getenv("EVENT_RETENTION"); value != "" {
+		eventRetention, err = time.ParseDuration(value)
+		if err != nil || eventRetention <= 0 {
+			log.Printf("Invalid EVENT_RETENTION: %s\n", value)
+			os.Exit(1)
+		}
+	}
+	go runEventSweeper(store.EventRepo, eventRetention)
+
+	// Default retention of the messages of all chats, the messages are kept when it is not set
+	var messageRetention time.Duration
+	if value := os.Getenv("MESSAGE_RETENTION"); value != "" {
+		messageRetention, err = time.ParseDuration(value)
+		if err != nil || messageRetention < minMessageRetention {
+			log.Printf("Invalid MESSAGE_RETENTION: %s\n", value)
+			os.Exit(1)
+		}
+	}
+	retentionSweeper := newRetentionSweeper(store, messageRetention)
+
+	tokenCache := newTokenCache(tokenCacheTTL)
+	go tokenCache.run()
+
+	wsHub := newWsHub(eventBroker, store.EventRepo, tokenCache, origins)
 	go wsHub.run()
+	vapidKeys, err := loadVAPIDKeys()
+	if err != nil {
+		log.Printf("Invalid VAPID_PRIVATE_KEY: %+v\n", err)
+		os.Exit(1)
+	}
+
+	// Contact of the server operator sent to the push services
+	vapidSubject := os.Getenv("VAPID_SUBJECT")
+	if vapidSubject == "" {
+		vapidSubject = "mailto:admin@localhost"
+	}
+
+	pushDispatcher := newPushDispatcher(store, wsHub, webpush.NewSender(vapidKeys, vapidSubject, nil))
+	go pushDispatcher.run()
+
+	// Public URL of the server, used for links sent outside of the API
+	publicURL := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + PORT
+	}
+
+	digestSender, err := newDigestSenderFromEnv(store, publicURL)
+	if err != nil {
+		log.Printf("Invalid email digest configuration: %+v\n", err)
+		os.Exit(1)
+	}
+	go digestSender.run()
+
+	// Webhooks are delivered only to public addresses, unless private networks are allowed for development
+	webhookDispatcher := newWebhookDispatcher(store, os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true")
+	go webhookDispatcher.run()
+
+	// Bot command callbacks are called only on public addresses, unless private networks are allowed for development
+	allowPrivateCommandCallbacks := os.Getenv("BOT_COMMAND_ALLOW_PRIVATE_NETWORKS") == "true"
+
+	// Link previews are fetched only from public addresses, unless private networks are allowed for development
+	linkPreviewer := newLinkPreviewer(store, os.Getenv("LINK_PREVIEW_ALLOW_PRIVATE_NETWORKS") == "true")
+
+	reminderBot, err := ensureSystemBot(store, reminderBotUsername, reminderBotFullName)
+	if err != nil {
+		log.Printf("Reminders are not available: %+v\n", err)
+	}
+
+	deletedUser, err := ensureSystemBot(store, deletedUserUsername, deletedUserFullName)
+	if err != nil {
+		log.Printf("Deleting users is not available: %+v\n", err)
+	}
+
 	api := apiController{
-		store: store,
-		wsHub: wsHub,
-	}
-
-	r := mux.NewRouter()
-	r.HandleFunc("/ws", api.wsHandler).Methods(http.MethodGet)
-
-	r.HandleFunc("/login", api.login).Methods(http.MethodPost)
-	r.HandleFunc("/register", api.register).Methods(http.MethodPost)
-	r.HandleFunc("/logout", api.logout).Methods(http.MethodPost)
-	r.HandleFunc("/users", api.listUsers).Methods(http.MethodGet)
-	r.HandleFunc("/users/active", api.listActiveUserIDs).Methods(http.MethodGet)
-	r.HandleFunc("/user/{userID}/avatar", api.getAvatar).Methods(http.MethodGet)
-	r.HandleFunc("/user/{userID}/avatar", api.uploadAvatar).Methods(http.MethodPost)
-	r.HandleFunc("/user/{userID}", api.getUser).Methods(http.MethodGet)
-	r.HandleFunc("/user/{userID}", api.updateUser).Methods(http.MethodPut)
-
-	r.HandleFunc("/chat", api.createChat).Methods(http.MethodPost)
-	r.HandleFunc("/chats", api.listChats).Methods(http.MethodGet)
-	r.HandleFunc("/chat/{chatID}", api.getChat).Methods(http.MethodGet)
-	r.HandleFunc("/chat/{chatID}", api.updateChat).Methods(http.MethodPut)
-	r.HandleFunc("/chat/{chatID}", api.deleteChat).Methods(http.MethodDelete)
-
-	r.HandleFunc("/chat/{chatID}/message", api.createMessage).Methods(http.MethodPost)
-	r.HandleFunc("/chat/{chatID}/messages", api.listMessages).Methods(http.MethodGet)
-	r.HandleFunc("/chat/{chatID}/message/{messageID}", api.getMessage).Methods(http.MethodGet)
-	r.HandleFunc("/chat/{chatID}/message/{messageID}", api.updateMessage).Methods(http.MethodPut)
-	r.HandleFunc("/chat/{chatID}/message/{messageID}", api.deleteMessage).Methods(http.MethodDelete)
-
-	corsRouter := handlers.CORS(handlers.AllowedOrigins(origins), handlers.AllowedMethods(methods), handlers.AllowedHeaders([]string{"Authorization", "Content-Type"}),
-		handlers.ExposedHeaders([]string{"Authorization", "Content-Type"}))(r)
+		store:          store,
+		wsHub:          wsHub,
+		tokenCache:     tokenCache,
+		allowedOrigins: origins,
+
+		pushDispatcher:    pushDispatcher,
+		vapidKeys:         vapidKeys,
+		allowInsecurePush: os.Getenv("PUSH_ALLOW_INSECURE_ENDPOINTS") == "true",
+
+		publicURL:         publicURL,
+		digestSender:      digestSender,
+		webhookDispatcher: webhookDispatcher,
+		commandClient:     newCommandClient(allowPrivateCommandCallbacks),
+		linkPreviewer:     linkPreviewer,
+		reminderBot:       reminderBot,
+		deletedUser:       deletedUser,
+		retentionSweeper:  retentionSweeper,
+	}
+
+	linkPreviewer.run(func(msg *model.Message) {
+		api.broadcastMessageChange(msg, WSTypeMessageUpdate)
+	})
+
+	go newMessageScheduler(store).run(api.publishScheduledMessage)
+	go retentionSweeper.run(api.broadcastMessagesDeleted)
+
+	r := newRouter(&api)
+
+	corsOptions := []handlers.CORSOption{
+		handlers.AllowedOrigins(origins),
+		handlers.AllowedMethods(methods),
+		handlers.AllowedHeaders([]string{"Authorization", "Content-Type", requestIDHeader}),
+		handlers.ExposedHeaders([]string{"Authorization", "Content-Type", requestIDHeader}),
+	}
+	// Credentials can't be allowed for any origin
+	if !isWildcardOrigins(origins) {
+		corsOptions = append(corsOptions, handlers.AllowCredentials())
+	}
+
+	corsRouter := handlers.CORS(corsOptions...)(requestIDMiddleware(r))
 
 	loggedRouter := handlers.LoggingHandler(os.Stdout, corsRouter)
 	srv := &http.Server{
@@ -110,5 +230,86 @@ func main() {
 	srv.Shutdown(ctx)
 	log.Println("Bye")
 
+	eventBroker.Close()
 	os.Exit(0)
 }
+
+// loadVAPIDKeys reads the VAPID_PRIVATE_KEY. Without it a new key is generated, but the push
+// subscriptions are bound to the key, so they stop working after the server is restarted.
+func loadVAPIDKeys() (*webpush.VAPIDKeys, error) {
+	if privateKey := os.Getenv("VAPID_PRIVATE_KEY"); privateKey != "" {
+		return webpush.ParseVAPIDKeys(privateKey)
+	}
+
+	keys, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("VAPID_PRIVATE_KEY is not set, generated a temporary key: %s\n", keys.PrivateKey())
+
+	return keys, nil
+}
+
+// newDigestSenderFromEnv sends the digests through SMTP_HOST. Without it the emails are only logged.
+func newDigestSenderFromEnv(store *dbcontroller.Store, publicURL string) (*DigestSender, error) {
+	var m mailer.Mailer = &mailer.LogMailer{}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := 587
+		if value := os.Getenv("SMTP_PORT"); value != "" {
+			var err error
+			port, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP_PORT: %s", value)
+			}
+		}
+
+		m = mailer.NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "ChatApp <noreply@localhost>"
+	}
+
+	// Unsubscribe links are signed with the secret, a temporary one invalidates them on restart
+	secret := []byte(os.Getenv("DIGEST_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("DIGEST_SECRET is not set, unsubscribe links are valid until the server is restarted")
+	}
+
+	return newDigestSender(store, m, from, publicURL, secret), nil
+}
+
+func isWildcardOrigins(origins []string) bool {
+	for _, origin := range origins {
+		if origin == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newBroker connects to Redis when REDIS_ADDR is set, so events and presence are
+// shared by all server nodes. Otherwise the server runs as a single node.
+func newBroker() (broker.Broker, error) {
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		return broker.NewMemoryBroker(), nil
+	}
+
+	nodeID := os.Getenv("NODE_ID")
+	if nodeID == "" {
+		hostname, _ := os.Hostname()
+		nodeID = hostname + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	return broker.NewRedisBroker(redisAddr, nodeID)
+}
@@ -0,0 +1,481 @@
+// Package markup parses the message markup and renders it as sanitized HTML.
+//
+// The markup is a small subset of Markdown:
+//
+//	**bold**, *italics* or _italics_, `code`, [text](https://example.com),
+//	http(s) URLs which become links and fenced code blocks:
+//	```go
+//	fmt.Println("code")
+//	```
+//
+// Blank lines separate paragraphs, other line breaks are kept. A backslash escapes
+// the following markup character. Everything else is text, so the rendered HTML
+// contains only the elements and attributes produced by the renderer.
+package markup
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Node types
+const (
+	NodeParagraph = "paragraph"
+	NodeCodeBlock = "code_block"
+	NodeText      = "text"
+	NodeBold      = "bold"
+	NodeItalic    = "italic"
+	NodeCode      = "code"
+	NodeLink      = "link"
+	NodeLineBreak = "line_break"
+)
+
+// Inline markup can be nested up to this depth, deeper markup is text
+const maxDepth = 4
+
+// Longer URLs are text, so the URLs which are not links can't make parsing quadratic
+const maxURLLength = 2048
+
+var languageRe = regexp.MustCompile(`^[a-zA-Z0-9_+#.-]{1,32}$`)
+
+// Node is a node of the parsed markup
+type Node struct {
+	Type string `json:"type"`
+
+	// Content of text, code and code_block nodes
+	Text string `json:"text,omitempty"`
+
+	// Language of code_block nodes, empty when it is not given
+	Language string `json:"language,omitempty"`
+
+	// Target of link nodes
+	URL string `json:"url,omitempty"`
+
+	Children []*Node `json:"children,omitempty"`
+}
+
+// ToHTML renders the markup of the text as sanitized HTML
+func ToHTML(text string) string {
+	return RenderHTML(Parse(text))
+}
+
+// Parse splits the text into paragraphs and code blocks with parsed inline markup
+func Parse(text string) []*Node {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	lines := strings.Split(text, "\n")
+
+	nodes := []*Node{}
+	paragraph := []string{}
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			nodes = append(nodes, &Node{
+				Type:     NodeParagraph,
+				Children: parseInline(strings.Join(paragraph, "\n"), 0, false),
+			})
+			paragraph = paragraph[:0]
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if strings.HasPrefix(line, "```") {
+			flush()
+
+			language := strings.TrimSpace(line[3:])
+			if !languageRe.MatchString(language) {
+				language = ""
+			}
+
+			// An unclosed code block ends with the text
+			code := []string{}
+			for i++; i < len(lines) && strings.TrimRight(lines[i], " \t") != "```"; i++ {
+				code = append(code, lines[i])
+			}
+
+			nodes = append(nodes, &Node{
+				Type:     NodeCodeBlock,
+				Text:     strings.Join(code, "\n"),
+				Language: language,
+			})
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		paragraph = append(paragraph, line)
+	}
+	flush()
+
+	return nodes
+}
+
+// inlineParser keeps the last found closing delimiters, so unbalanced markup doesn't make parsing quadratic.
+// The text of links is parsed without links, since links can't be nested.
+type inlineParser struct {
+	text    string
+	depth   int
+	inLink  bool
+	closers map[string]closer
+
+	nodes []*Node
+	buf   strings.Builder
+}
+
+// closer is the position of the first closing delimiter at or after from, -1 if there is none
+type closer struct {
+	from int
+	pos  int
+}
+
+func parseInline(text string, depth int, inLink bool) []*Node {
+	if depth >= maxDepth {
+		return appendText(nil, text)
+	}
+
+	p := &inlineParser{
+		text:    text,
+		depth:   depth,
+		inLink:  inLink,
+		closers: make(map[string]closer),
+	}
+
+	return p.parse()
+}
+
+func (p *inlineParser) parse() []*Node {
+	text := p.text
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte("\\*_`[]()", text[i+1]) >= 0:
+			p.buf.WriteByte(text[i+1])
+			i += 2
+			continue
+		case c == '\n':
+			p.flushText()
+			p.nodes = append(p.nodes, &Node{Type: NodeLineBreak})
+			i++
+			continue
+		case c == '`':
+			if end := p.findCloser("`", i+1, nil); end > i+1 {
+				p.flushText()
+				p.nodes = append(p.nodes, &Node{Type: NodeCode, Text: text[i+1 : end]})
+				i = end + 1
+				continue
+			}
+		case strings.HasPrefix(text[i:], "**"):
+			if end := p.findCloser("**", i+2, nil); end > i+2 {
+				p.flushText()
+				p.nodes = append(p.nodes, &Node{Type: NodeBold, Children: parseInline(text[i+2:end], p.depth+1, p.inLink)})
+				i = end + 2
+				continue
+			}
+		case c == '*' && i+1 < len(text) && !isSpaceByte(text[i+1]):
+			if end := p.findCloser("*", i+1, p.isItalicCloser); end > i+1 {
+				p.flushText()
+				p.nodes = append(p.nodes, &Node{Type: NodeItalic, Children: parseInline(text[i+1:end], p.depth+1, p.inLink)})
+				i = end + 1
+				continue
+			}
+		case c == '_' && !p.isWordBefore(i) && i+1 < len(text) && !isSpaceByte(text[i+1]):
+			if end := p.findCloser("_", i+1, p.isUnderscoreCloser); end > i+1 {
+				p.flushText()
+				p.nodes = append(p.nodes, &Node{Type: NodeItalic, Children: parseInline(text[i+1:end], p.depth+1, p.inLink)})
+				i = end + 1
+				continue
+			}
+		case c == '[' && !p.inLink:
+			if node, end := p.parseLink(i); node != nil {
+				p.flushText()
+				p.nodes = append(p.nodes, node)
+				i = end
+				continue
+			}
+		case (c == 'h' || c == 'H') && !p.inLink && !p.isWordBefore(i):
+			if end := autolinkEnd(text, i); end > i {
+				p.flushText()
+				p.nodes = append(p.nodes, &Node{
+					Type:     NodeLink,
+					URL:      text[i:end],
+					Children: []*Node{{Type: NodeText, Text: text[i:end]}},
+				})
+				i = end
+				continue
+			}
+		}
+
+		p.buf.WriteByte(c)
+		i++
+	}
+	p.flushText()
+
+	return p.nodes
+}
+
+func (p *inlineParser) flushText() {
+	if p.buf.Len() > 0 {
+		p.nodes = appendText(p.nodes, p.buf.String())
+		p.buf.Reset()
+	}
+}
+
+// findCloser returns the position of the closing delimiter after from, or -1.
+// valid rejects closing delimiters at the given positions.
+func (p *inlineParser) findCloser(delim string, from int, valid func(int) bool) int {
+	// There is no closing delimiter between the last from and its closing delimiter
+	if c, ok := p.closers[delim]; ok && from >= c.from && (c.pos < 0 || from <= c.pos) {
+		return c.pos
+	}
+
+	end := -1
+	for pos := from; pos < len(p.text); {
+		idx := strings.Index(p.text[pos:], delim)
+		if idx < 0 {
+			break
+		}
+
+		if valid == nil || valid(pos+idx) {
+			end = pos + idx
+			break
+		}
+		pos += idx + len(delim)
+	}
+
+	p.closers[delim] = closer{from: from, pos: end}
+
+	return end
+}
+
+// Closing "*" must follow a non-space character and must not be a part of "**"
+func (p *inlineParser) isItalicCloser(pos int) bool {
+	prev := p.text[pos-1]
+
+	return !isSpaceByte(prev) && prev != '*' && !strings.HasPrefix(p.text[pos:], "**")
+}
+
+// Closing "_" must follow a non-space character and must not precede a word, so snake_case is text
+func (p *inlineParser) isUnderscoreCloser(pos int) bool {
+	if isSpaceByte(p.text[pos-1]) {
+		return false
+	}
+
+	if pos+1 < len(p.text) {
+		r, _ := utf8.DecodeRuneInString(p.text[pos+1:])
+		return !isWordRune(r)
+	}
+
+	return true
+}
+
+func (p *inlineParser) isWordBefore(pos int) bool {
+	if pos == 0 {
+		return false
+	}
+
+	r, _ := utf8.DecodeLastRuneInString(p.text[:pos])
+	return isWordRune(r)
+}
+
+// parseLink parses [text](url) at pos and returns the link with the position after it
+func (p *inlineParser) parseLink(pos int) (*Node, int) {
+	mid := p.findCloser("](", pos+1, nil)
+	if mid <= pos+1 {
+		return nil, 0
+	}
+
+	end := p.findCloser(")", mid+2, nil)
+	if end < 0 || end-mid-2 > maxURLLength {
+		return nil, 0
+	}
+
+	// Links can't be nested, so the text of the link can't contain another link
+	label := p.text[pos+1 : mid]
+	if strings.Contains(label, "[") {
+		return nil, 0
+	}
+
+	target := strings.TrimSpace(p.text[mid+2 : end])
+	if !isAllowedURL(target) {
+		return nil, 0
+	}
+
+	return &Node{
+		Type:     NodeLink,
+		URL:      target,
+		Children: parseInline(label, p.depth+1, true),
+	}, end + 1
+}
+
+// autolinkEnd returns the end of the http(s) URL at pos, or pos if there is no URL.
+// Trailing punctuation and unbalanced closing parentheses are not a part of the URL.
+func autolinkEnd(text string, pos int) int {
+	lower := strings.ToLower(text[pos:min(len(text), pos+8)])
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return pos
+	}
+
+	end := pos
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if unicode.IsSpace(r) || r == '<' || r == '>' || r == '"' || r == '`' {
+			break
+		}
+		end += size
+
+		if end-pos > maxURLLength {
+			return pos
+		}
+	}
+
+	opening := strings.Count(text[pos:end], "(")
+	closing := strings.Count(text[pos:end], ")")
+	for end > pos {
+		last := text[end-1]
+		if strings.IndexByte(".,:;!?'*_", last) >= 0 {
+			end--
+		} else if last == ')' && opening < closing {
+			end--
+			closing--
+		} else {
+			break
+		}
+	}
+
+	if !isAllowedURL(text[pos:end]) {
+		return pos
+	}
+
+	return end
+}
+
+// isAllowedURL accepts absolute http and https URLs with a host and mailto URLs
+func isAllowedURL(target string) bool {
+	if target == "" || strings.ContainsAny(target, " \t\n") {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+
+	return false
+}
+
+// LinkURLs returns the distinct http and https targets of the links in the nodes, in the order of appearance
+func LinkURLs(nodes []*Node) []string {
+	urls := []string{}
+	seen := make(map[string]bool)
+
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, node := range nodes {
+			if node.Type == NodeLink && !seen[node.URL] {
+				lower := strings.ToLower(node.URL)
+				if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+					seen[node.URL] = true
+					urls = append(urls, node.URL)
+				}
+			}
+			walk(node.Children)
+		}
+	}
+	walk(nodes)
+
+	return urls
+}
+
+// appendText appends the text to the last node when it is a text node
+func appendText(nodes []*Node, text string) []*Node {
+	if text == "" {
+		return nodes
+	}
+
+	if len(nodes) > 0 && nodes[len(nodes)-1].Type == NodeText {
+		nodes[len(nodes)-1].Text += text
+		return nodes
+	}
+
+	return append(nodes, &Node{Type: NodeText, Text: text})
+}
+
+// RenderHTML renders the nodes. Text is escaped and links get rel="noopener noreferrer nofollow".
+func RenderHTML(nodes []*Node) string {
+	var b strings.Builder
+	renderNodes(&b, nodes)
+
+	return b.String()
+}
+
+func renderNodes(b *strings.Builder, nodes []*Node) {
+	for _, node := range nodes {
+		switch node.Type {
+		case NodeParagraph:
+			b.WriteString("<p>")
+			renderNodes(b, node.Children)
+			b.WriteString("</p>")
+		case NodeCodeBlock:
+			if node.Language != "" {
+				b.WriteString(`<pre><code class="language-` + html.EscapeString(node.Language) + `">`)
+			} else {
+				b.WriteString("<pre><code>")
+			}
+			b.WriteString(html.EscapeString(node.Text))
+			b.WriteString("</code></pre>")
+		case NodeText:
+			b.WriteString(html.EscapeString(node.Text))
+		case NodeBold:
+			b.WriteString("<strong>")
+			renderNodes(b, node.Children)
+			b.WriteString("</strong>")
+		case NodeItalic:
+			b.WriteString("<em>")
+			renderNodes(b, node.Children)
+			b.WriteString("</em>")
+		case NodeCode:
+			b.WriteString("<code>")
+			b.WriteString(html.EscapeString(node.Text))
+			b.WriteString("</code>")
+		case NodeLink:
+			b.WriteString(`<a href="` + html.EscapeString(node.URL) + `" rel="noopener noreferrer nofollow" target="_blank">`)
+			renderNodes(b, node.Children)
+			b.WriteString("</a>")
+		case NodeLineBreak:
+			b.WriteString("<br>")
+		}
+	}
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
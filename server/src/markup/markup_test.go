@@ -0,0 +1,140 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const linkAttrs = `rel="noopener noreferrer nofollow" target="_blank"`
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"text", "Hello, world", "<p>Hello, world</p>"},
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one<br>two</p><p>three</p>"},
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"img onerror", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>"},
+		{"entities", "&lt;b&gt; &amp; &#39;", "<p>&amp;lt;b&amp;gt; &amp;amp; &amp;#39;</p>"},
+		{"code", "`<b>` and **`*x*`**", "<p><code>&lt;b&gt;</code> and <strong><code>*x*</code></strong></p>"},
+		{"code block", "```go\"><script>\n<b>\n```", "<pre><code>&lt;b&gt;</code></pre>"},
+		{"code block language", "```c++\nx\n```", `<pre><code class="language-c++">x</code></pre>`},
+		{"escapes", `\*not italic\* \[x\](http://example.com)`, `<p>*not italic* [x](<a href="http://example.com" ` + linkAttrs + `>http://example.com</a>)</p>`},
+		{"snake case", "snake_case_name", "<p>snake_case_name</p>"},
+
+		{"link", "[Example](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" ` + linkAttrs + `>Example</a></p>`},
+		{"mailto", "[mail](mailto:a@example.com)", `<p><a href="mailto:a@example.com" ` + linkAttrs + `>mail</a></p>`},
+		{"autolink", "see https://example.com/x.", `<p>see <a href="https://example.com/x" ` + linkAttrs + `>https://example.com/x</a>.</p>`},
+		{"autolink parentheses", "(https://example.com/a_(b))", `<p>(<a href="https://example.com/a_(b)" ` + linkAttrs + `>https://example.com/a_(b)</a>)</p>`},
+
+		{"javascript link", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>"},
+		{"javascript mixed case", "[x](JaVaScRiPt:alert(1))", "<p>[x](JaVaScRiPt:alert(1))</p>"},
+		{"javascript with spaces", "[x]( javascript:alert(1))", "<p>[x]( javascript:alert(1))</p>"},
+		{"javascript with tab", "[x](java\tscript:alert(1))", "<p>[x](java\tscript:alert(1))</p>"},
+		{"javascript entity scheme", "[x](&#106;avascript:alert(1))", "<p>[x](&amp;#106;avascript:alert(1))</p>"},
+		{"javascript entity colon", "[x](javascript&#58;alert(1))", "<p>[x](javascript&amp;#58;alert(1))</p>"},
+		{"javascript percent colon", "[x](javascript%3Aalert(1))", "<p>[x](javascript%3Aalert(1))</p>"},
+		{"javascript autolink", "javascript:alert(1)", "<p>javascript:alert(1)</p>"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>[x](data:text/html;base64,PHNjcmlwdD4=)</p>"},
+		{"data mixed case", "[x](DATA:text/html,<script>)", "<p>[x](DATA:text/html,&lt;script&gt;)</p>"},
+		{"vbscript link", "[x](vbscript:msgbox)", "<p>[x](vbscript:msgbox)</p>"},
+		{"vbscript mixed case", "[x](VBScript:msgbox)", "<p>[x](VBScript:msgbox)</p>"},
+		{"relative link", "[x](//example.com)", "<p>[x](//example.com)</p>"},
+
+		{"quotes in url", `[x](http://example.com/"onmouseover="alert(1))`, `<p><a href="http://example.com/&#34;onmouseover=&#34;alert(1" ` + linkAttrs + `>x</a>)</p>`},
+		{"single quotes in url", `[x](http://example.com/'x')`, `<p><a href="http://example.com/&#39;x&#39;" ` + linkAttrs + `>x</a></p>`},
+		{"quotes in link text", `[<b>"x"</b>](http://example.com)`, `<p><a href="http://example.com" ` + linkAttrs + `>&lt;b&gt;&#34;x&#34;&lt;/b&gt;</a></p>`},
+		{"quotes after autolink", `http://example.com/x"onclick="y`, `<p><a href="http://example.com/x" ` + linkAttrs + `>http://example.com/x</a>&#34;onclick=&#34;y</p>`},
+		{"tag after autolink", "http://example.com/<script>", `<p><a href="http://example.com/" ` + linkAttrs + `>http://example.com/</a>&lt;script&gt;</p>`},
+
+		{"nested emphasis", "**bold *italic _both_* bold**", "<p><strong>bold <em>italic <em>both</em></em> bold</strong></p>"},
+		{"emphasis in link", "[**bold** _x_](http://example.com)", `<p><a href="http://example.com" ` + linkAttrs + `><strong>bold</strong> <em>x</em></a></p>`},
+		{"link in emphasis", "**[x](http://example.com)**", `<p><strong><a href="http://example.com" ` + linkAttrs + `>x</a></strong></p>`},
+		{"autolink in link text", "[see http://a.example.com](http://b.example.com)", `<p><a href="http://b.example.com" ` + linkAttrs + `>see http://a.example.com</a></p>`},
+		{"autolink in emphasis in link text", "[*http://a.example.com*](http://b.example.com)", `<p><a href="http://b.example.com" ` + linkAttrs + `><em>http://a.example.com</em></a></p>`},
+		{"link in link text", "[**[x](http://a.example.com)**](http://b.example.com)", `<p>[<strong><a href="http://a.example.com" ` + linkAttrs + `>x</a></strong>](<a href="http://b.example.com" ` + linkAttrs + `>http://b.example.com</a>)</p>`},
+		{"deep nesting", "**1 _2 [3 *4 `5`*](http://example.com) 2_ 1**", `<p><strong>1 <em>2 <a href="http://example.com" ` + linkAttrs + `>3 <em>4 ` + "`5`" + `</em></a> 2</em> 1</strong></p>`},
+	}
+
+	for _, test := range tests {
+		if got := ToHTML(test.text); got != test.want {
+			t.Errorf("%s: ToHTML(%q)\n got %s\nwant %s", test.name, test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseLinksAreNotNested(t *testing.T) {
+	texts := []string{
+		"[see http://a.example.com](http://b.example.com)",
+		"[**[x](http://a.example.com)**](http://b.example.com)",
+		"[_**https://a.example.com**_](https://b.example.com)",
+		"[[x](http://a.example.com)](http://b.example.com)",
+		"[x [y](http://a.example.com) z](http://b.example.com)",
+	}
+
+	var walk func(nodes []*Node, inLink bool) bool
+	walk = func(nodes []*Node, inLink bool) bool {
+		for _, node := range nodes {
+			if node.Type == NodeLink && inLink {
+				return false
+			}
+			if !walk(node.Children, inLink || node.Type == NodeLink) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, text := range texts {
+		if !walk(Parse(text), false) {
+			t.Errorf("%q has a link inside a link: %s", text, ToHTML(text))
+		}
+	}
+}
+
+// renderDuration returns the shortest of a few renderings of the text, so other tests running at the same time
+// affect it less
+func renderDuration(text string) time.Duration {
+	shortest := time.Duration(-1)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		ToHTML(text)
+		if elapsed := time.Since(start); shortest < 0 || elapsed < shortest {
+			shortest = elapsed
+		}
+	}
+
+	return shortest
+}
+
+func TestToHTMLLinearTime(t *testing.T) {
+	tests := map[string]func(n int) string{
+		"unclosed links": func(n int) string { return strings.Repeat("[a]", n) + "(" },
+		"open brackets":  func(n int) string { return strings.Repeat("[", n) + "](http://example.com)" },
+		"long targets": func(n int) string {
+			return strings.Repeat("[a", n) + "](javascript:" + strings.Repeat("x", n) + ")"
+		},
+		"invalid autolinks": func(n int) string { return strings.Repeat("http://%-", n) },
+		"long autolink":     func(n int) string { return "http://example.com/" + strings.Repeat("a", n) },
+		"parentheses":       func(n int) string { return "http://example.com" + strings.Repeat(")", n) },
+		"unclosed bold":     func(n int) string { return strings.Repeat("**a", n) },
+		"unclosed italics":  func(n int) string { return strings.Repeat("*a", n) + strings.Repeat("_a", n) },
+		"unclosed code":     func(n int) string { return strings.Repeat("`", n) },
+		"nested markup": func(n int) string {
+			return strings.Repeat("[**_", n) + strings.Repeat("_**](http://example.com)", n)
+		},
+	}
+
+	for name, generate := range tests {
+		short := renderDuration(generate(5000))
+		long := renderDuration(generate(20000))
+
+		// Quadratic parsing takes 16 times as long for the 4 times longer text
+		if long > 8*short+10*time.Millisecond {
+			t.Errorf("%s: rendering 4 times longer text took %v instead of %v", name, long, short)
+		}
+	}
+}
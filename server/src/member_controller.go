@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"./model"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+// Errors of the chat membership changes, reported as 403 responses
+var (
+	errDirectChatMembers = fmt.Errorf("Members of direct chats can't be changed")
+	errRemoveChatCreator = fmt.Errorf("The chat creator can't leave the chat, it can be deleted instead")
+	errRemoveChatMember  = fmt.Errorf("Only the chat creator can remove other members")
+	errAddSuspendedUser  = fmt.Errorf("Suspended users can't be added to chats")
+)
+
+func (c *apiController) listChatMembers(w http.ResponseWriter, r *http.Request) {
+	chatUsers := []model.ChatUser{}
+	err := c.store.ChatUserRepo.ListByChatID(mux.Vars(r)["chatID"], &chatUsers)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	members := []model.PublicUser{}
+	for i := range chatUsers {
+		user := model.User{}
+		err = c.store.UserRepo.Get(chatUsers[i].UserID, &user)
+		if gorm.IsRecordNotFoundError(err) {
+			continue
+		} else if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+			return
+		}
+
+		members = append(members, user.PublicUser)
+	}
+
+	c.writeResponse(w, http.StatusOK, members)
+}
+
+func (c *apiController) putChatMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(vars["chatID"], &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	user := model.User{}
+	err = c.store.UserRepo.Get(vars["userID"], &user)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeUserNotFound)
+		return
+	}
+
+	err = c.addChatMember(&chat, &user)
+	if err == errDirectChatMembers || err == errAddSuspendedUser {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		return
+	} else if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *apiController) deleteChatMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(vars["chatID"], &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	isMember, err := c.store.ChatUserRepo.Exists(chat.ID, vars["userID"])
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	if !isMember {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeUserNotFound, "User is not a member of the chat")
+		return
+	}
+
+	err = c.removeChatMember(&chat, vars["userID"], contextUserID(r))
+	if err == errDirectChatMembers || err == errRemoveChatCreator || err == errRemoveChatMember {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		return
+	} else if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// discoverChats lists the public chats, the most popular first. The chats can be searched by their titles.
+func (c *apiController) discoverChats(w http.ResponseWriter, r *http.Request) {
+	limit, offset, errs := parsePagination(r)
+
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(search) >= 256 {
+		errs.add("q", FieldErrTooLong, "Search must be less than 256 characters long")
+	}
+
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
+		return
+	}
+
+	chats := []model.DiscoverableChat{}
+	err := c.store.ChatRepo.ListPublic(search, contextUserID(r), limit, offset, &chats)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, chats)
+}
+
+// joinChat adds the current user to the public chat, the private chats are reported as not found
+func (c *apiController) joinChat(w http.ResponseWriter, r *http.Request) {
+	currentUser := contextUser(r)
+
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(mux.Vars(r)["chatID"], &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	if chat.Visibility != model.ChatVisibilityPublic {
+		isMember, err := c.store.ChatUserRepo.Exists(chat.ID, currentUser.ID)
+		if err != nil {
+			c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+			return
+		}
+
+		if !isMember {
+			c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeChatNotFound, "Chat is not found")
+			return
+		}
+	}
+
+	err = c.addChatMember(&chat, currentUser)
+	if err == errAddSuspendedUser {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		return
+	} else if err != nil && err != errDirectChatMembers {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, chat)
+}
+
+func isChatVisibility(visibility string) bool {
+	return visibility == model.ChatVisibilityPrivate || visibility == model.ChatVisibilityPublic
+}
+
+// addChatMember adds the user to the chat. The new member receives chat_create and the other members chat_update.
+// Adding a member twice has no effect.
+func (c *apiController) addChatMember(chat *model.Chat, user *model.User) error {
+	if chat.DirectUserID != "" {
+		return errDirectChatMembers
+	}
+
+	if user.IsSuspended() {
+		return errAddSuspendedUser
+	}
+
+	isMember, err := c.store.ChatUserRepo.Exists(chat.ID, user.ID)
+	if err != nil || isMember {
+		return err
+	}
+
+	userIDs, err := c.listChatUserIDs(chat.ID)
+	if err != nil {
+		return err
+	}
+
+	err = c.store.ChatUserRepo.Create(&model.ChatUser{
+		ChatID: chat.ID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.broadcastChatChangeTo([]string{user.ID}, chat, WSTypeChatCreate)
+	c.broadcastChatChangeTo(userIDs, chat, WSTypeChatUpdate)
+
+	return nil
+}
+
+// removeChatMember removes the user from the chat on behalf of actorID. Members can leave the chat,
+// only the chat creator can remove others. The removed member receives chat_delete and the others chat_update.
+func (c *apiController) removeChatMember(chat *model.Chat, userID, actorID string) error {
+	if chat.DirectUserID != "" {
+		return errDirectChatMembers
+	}
+
+	if userID == chat.CreatorID {
+		return errRemoveChatCreator
+	}
+
+	if userID != actorID && actorID != chat.CreatorID {
+		return errRemoveChatMember
+	}
+
+	err := c.store.ChatUserRepo.Delete(chat.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	c.broadcastChatChangeTo([]string{userID}, chat, WSTypeChatDelete)
+	c.broadcastChatChange(chat, WSTypeChatUpdate)
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"./model"
+	"github.com/jinzhu/gorm"
+)
+
+// @all mentions all members of the chat. It can't be a username, usernames are at least 4 characters long.
+const mentionAll = "all"
+
+// Maximum number of distinct usernames resolved in a single message
+const maxMessageMentions = 50
+
+// A mention is "@" and a username which doesn't follow a word character, so emails are not mentions
+var mentionRe = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_@-])@([a-zA-Z0-9_-]+)`)
+
+// WSMentionData is sent to the mentioned users, also when they muted the chat
+type WSMentionData struct {
+	Type      string         `json:"type"`
+	ChatID    string         `json:"chatId"`
+	MessageID string         `json:"messageId"`
+	Message   *model.Message `json:"message,omitempty"`
+}
+
+// listMentions is the mention feed of the current user
+func (c *apiController) listMentions(w http.ResponseWriter, r *http.Request) {
+	limit, offset, errs := parsePagination(r)
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
+		return
+	}
+
+	items := []model.MentionItem{}
+	err := c.store.MessageMentionRepo.ListItemsByUserID(contextUserID(r), limit, offset, &items)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, items)
+}
+
+// parseMentions returns the distinct mentioned usernames in the order of their first appearance
+func parseMentions(text string) []string {
+	usernames := []string{}
+	seen := make(map[string]bool)
+	for _, match := range mentionRe.FindAllStringSubmatch(text, -1) {
+		key := strings.ToLower(match[1])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		usernames = append(usernames, match[1])
+		if len(usernames) == maxMessageMentions {
+			break
+		}
+	}
+
+	return usernames
+}
+
+// updateMentions stores the mentions of the created or edited message. Only members of the chat
+// other than the author can be mentioned. The users which weren't mentioned before receive a mention event.
+func (c *apiController) updateMentions(msg *model.Message) error {
+	usernames := parseMentions(msg.Message)
+
+	oldMentions := []model.MessageMention{}
+	err := c.store.MessageMentionRepo.ListByMessageID(msg.ID, &oldMentions)
+	if err != nil {
+		return err
+	}
+
+	if len(usernames) == 0 && len(oldMentions) == 0 {
+		return nil
+	}
+
+	memberIDs, err := c.listChatUserIDs(msg.ChatID)
+	if err != nil {
+		return err
+	}
+
+	isMember := make(map[string]bool)
+	for _, userID := range memberIDs {
+		isMember[userID] = true
+	}
+
+	mentioned := make(map[string]bool)
+	everyone := false
+	for _, username := range usernames {
+		if strings.ToLower(username) == mentionAll {
+			everyone = true
+			continue
+		}
+
+		user, err := c.store.UserRepo.GetByUsername(username)
+		if gorm.IsRecordNotFoundError(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if isMember[user.ID] && user.ID != msg.UserID {
+			mentioned[user.ID] = true
+		}
+	}
+
+	oldByUserID := make(map[string]*model.MessageMention)
+	for i := range oldMentions {
+		oldByUserID[oldMentions[i].UserID] = &oldMentions[i]
+	}
+
+	mentions := []model.MessageMention{}
+	newUserIDs := []string{}
+	for _, userID := range memberIDs {
+		if userID == msg.UserID || (!mentioned[userID] && !everyone) {
+			continue
+		}
+
+		mention := model.MessageMention{
+			MessageID: msg.ID,
+			UserID:    userID,
+			ChatID:    msg.ChatID,
+			AuthorID:  msg.UserID,
+			Everyone:  !mentioned[userID],
+			CreatedAt: msg.CreatedAt,
+		}
+
+		if old, ok := oldByUserID[userID]; ok {
+			mention.CreatedAt = old.CreatedAt
+		} else {
+			newUserIDs = append(newUserIDs, userID)
+		}
+
+		mentions = append(mentions, mention)
+	}
+
+	err = c.store.MessageMentionRepo.Replace(msg.ID, mentions)
+	if err != nil {
+		return err
+	}
+
+	if len(newUserIDs) > 0 {
+		data := &WSMentionData{
+			Type:      WSTypeMention,
+			ChatID:    msg.ChatID,
+			MessageID: msg.ID,
+		}
+
+		full := *data
+		full.Message = msg
+
+		c.wsHub.broadcastData(newUserIDs, data, &full)
+	}
+
+	return nil
+}
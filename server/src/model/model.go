@@ -1,6 +1,9 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -11,32 +14,183 @@ type Chat struct {
 	Title        string     `json:"title" db:"title" sql:"type:varchar(256)"`
 	CreatedAt    *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
 	UpdatedAt *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+
+	// Seconds after which the messages are removed, 0 keeps them unless the server has a default retention
+	MessageRetention int64 `json:"messageRetention" db:"message_retention" sql:"not null; default:0"`
+
+	// Seconds after which every new message disappears, 0 disables disappearing messages
+	MessageTTL int64 `json:"messageTtl" db:"message_ttl" sql:"not null; default:0"`
+
+	// Public chats are listed in the chat discovery and any user can join them
+	Visibility string `json:"visibility" db:"visibility" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null; default:'private'"`
+
+	// Normalized pair of the users of a direct chat, unique so two users have a single direct chat
+	DirectKey *string `json:"-" db:"direct_key" sql:"type:varchar(33) CHARACTER SET ascii COLLATE ascii_bin; unique_index;"`
 }
 
 func (c Chat) TableName() string {
 	return "chat"
 }
 
+// Chat visibilities
+const (
+	ChatVisibilityPrivate = "private"
+	ChatVisibilityPublic  = "public"
+)
+
+// DiscoverableChat is a public chat listed in the chat discovery
+type DiscoverableChat struct {
+	Chat
+	MemberCount int64 `json:"memberCount"`
+
+	// The current user is a member of the chat
+	Member bool `json:"member"`
+}
+
+// ChatListItem is a chat together with the data needed to render it in a chat list
+type ChatListItem struct {
+	Chat
+	LastMessage *MessagePreview `json:"lastMessage"`
+	MemberCount int64           `json:"memberCount"`
+	UnreadCount int64           `json:"unreadCount"`
+	DirectUser  *PublicUser     `json:"directUser"`
+	Muted       bool            `json:"muted"`
+}
+
+// UnreadMessage is a message which the user didn't read, together with its author and chat
+type UnreadMessage struct {
+	Message
+	Author    PublicUser `json:"author"`
+	ChatTitle string     `json:"chatTitle"`
+}
+
+type MessagePreview struct {
+	ID        string     `json:"id"`
+	Author    PublicUser `json:"author"`
+	Snippet   string     `json:"snippet"`
+	CreatedAt *time.Time `json:"createdAt"`
+}
+
 type Message struct {
 	ID        string     `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
 	UserID    string     `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
 	ChatID    string     `json:"chatId" db:"chat_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin;index; not null;"`
 	Message   string     `json:"message" db:"message" sql:"type:longtext CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+	Type      string     `json:"type" db:"type" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null; default:'text'"`
 	CreatedAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
 	UpdatedAt *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+
+	// Sanitized HTML rendering of the message markup, produced by the server. Clients render it instead of the raw text.
+	HTML string `json:"html" db:"html" sql:"type:longtext CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+
+	// Previews of the links in the message, fetched in the background after the message is created or edited
+	Previews LinkPreviews `json:"previews,omitempty" db:"previews" sql:"type:text CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+
+	// Set from the message TTL of the chat when the message is created
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" db:"expires_at" sql:"type:datetime(3); index"`
 }
 
 func (m Message) TableName() string {
 	return "message"
 }
 
-type ChatUser struct {
-	ChatID    string     `json:"chatId" db:"chat_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
-	UserID    string     `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+// ScheduledMessage is posted to the chat as a message of the user at SendAt. Reminders are scheduled
+// messages of the reminder bot in its direct chat with the user who set them.
+type ScheduledMessage struct {
+	ID        string     `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	ChatID    string     `json:"chatId" db:"chat_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	UserID    string     `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	CreatorID string     `json:"creatorId" db:"creator_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	Message   string     `json:"message" db:"message" sql:"type:longtext CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+	Reminder  bool       `json:"reminder" db:"reminder" sql:"not null; default:false"`
+	SendAt    *time.Time `json:"sendAt" db:"send_at" sql:"type:datetime(3); index; not null;"`
+
+	// A node which is publishing the message claims it until the time, so it is published by a single node
+	ClaimedUntil *time.Time `json:"-" db:"claimed_until" sql:"type:datetime(3)"`
+
 	CreatedAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
 	UpdatedAt *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
 }
 
+func (m ScheduledMessage) TableName() string {
+	return "scheduled_message"
+}
+
+// LinkPreview is the metadata of a linked page read from its OpenGraph tags or its oEmbed endpoint
+type LinkPreview struct {
+	URL         string `json:"url" db:"url" sql:"type:varchar(2048) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null;"`
+	Title       string `json:"title" db:"title" sql:"type:varchar(512) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null;"`
+	Description string `json:"description,omitempty" db:"description" sql:"type:text CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+	ImageURL    string `json:"imageUrl,omitempty" db:"image_url" sql:"type:varchar(2048) CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+	SiteName    string `json:"siteName,omitempty" db:"site_name" sql:"type:varchar(256) CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+}
+
+// LinkPreviews are stored as a JSON array in a single column
+type LinkPreviews []LinkPreview
+
+func (p LinkPreviews) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func (p *LinkPreviews) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported link previews value: %T", value)
+	}
+
+	if len(data) == 0 {
+		*p = nil
+		return nil
+	}
+
+	return json.Unmarshal(data, p)
+}
+
+// CachedLinkPreview is the result of fetching the preview of a URL. Failures are cached as well,
+// so the URLs which don't have a preview are not fetched for every message.
+type CachedLinkPreview struct {
+	URLHash string `json:"-" db:"url_hash" sql:"type:char(64) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	LinkPreview
+	Failed    bool       `json:"failed" db:"failed" sql:"not null; default:false"`
+	FetchedAt *time.Time `json:"fetchedAt" db:"fetched_at" sql:"type:datetime(3); index"`
+}
+
+func (p CachedLinkPreview) TableName() string {
+	return "link_preview"
+}
+
+// Message types. Action messages are created with /me and describe what the author does.
+const (
+	MessageTypeText   = "text"
+	MessageTypeAction = "action"
+)
+
+type ChatUser struct {
+	ChatID     string     `json:"chatId" db:"chat_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	UserID     string     `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	LastReadAt *time.Time `json:"lastReadAt" db:"last_read_at" sql:"type:datetime(3)"`
+	Muted      bool       `json:"muted" db:"muted" sql:"not null; default:false"`
+	CreatedAt  *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+	UpdatedAt  *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+}
+
 func (cu ChatUser) TableName() string {
 	return "chat_user"
 }
@@ -45,20 +199,56 @@ type PublicUser struct {
 	ID        string     `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
 	Username  string     `json:"username" db:"username" sql:"type:varchar(256) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
 	FullName  string     `json:"fullName" db:"full_name" sql:"type:varchar(256) CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+	Bot       bool       `json:"bot" db:"bot" sql:"not null; default:false"`
 	CreatedAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
 	UpdatedAt *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
 }
 
+// User roles
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+)
+
 type User struct {
 	PublicUser
-	Password     string `json:"password" sql:"-"`
-	PasswordHash string `json:"-" db:"password_hash" sql:"type:varchar(256) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	DigestSettings
+	Role         string     `json:"role" db:"role" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null; default:'user'"`
+	SuspendedAt  *time.Time `json:"suspendedAt" db:"suspended_at" sql:"type:datetime(3)"`
+	OwnerID      string     `json:"ownerId,omitempty" db:"owner_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null; default:''"`
+	DigestSentAt *time.Time `json:"-" db:"digest_sent_at" sql:"type:datetime(3)"`
+	Password     string     `json:"password,omitempty" sql:"-"`
+	PasswordHash string     `json:"-" db:"password_hash" sql:"type:varchar(256) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+}
+
+// Email digest frequencies
+const (
+	DigestFrequencyOff    = "off"
+	DigestFrequencyDaily  = "daily"
+	DigestFrequencyWeekly = "weekly"
+)
+
+// DigestSettings are the preferences of the opt-in email digest of unread messages.
+// The digest is sent at DigestHour UTC, weekly digests on DigestWeekday (0 is Sunday).
+type DigestSettings struct {
+	Email           string `json:"email" db:"email" sql:"type:varchar(256) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null; default:''"`
+	DigestFrequency string `json:"digestFrequency" db:"digest_frequency" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null; default:'off'"`
+	DigestHour      int    `json:"digestHour" db:"digest_hour" sql:"not null; default:8"`
+	DigestWeekday   int    `json:"digestWeekday" db:"digest_weekday" sql:"not null; default:1"`
 }
 
 func (u User) TableName() string {
 	return "user"
 }
 
+func (u *User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
+
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
 type UserAvatar struct {
 	UserID    string     `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
 	ContentType  string     `json:"contentType" db:"content_type" sql:"type:varchar(256) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
@@ -73,6 +263,10 @@ type AccessToken struct {
 	UserID    string     `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
 	Token     string     `json:"token" db:"token" sql:"type:varchar(64) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
 	ExpiresAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+
+	// Set when the request is authenticated with an API token instead of a session
+	APITokenID string   `json:"-" sql:"-"`
+	Scopes     []string `json:"-" sql:"-"`
 }
 
 func (at AccessToken) TableName() string {
@@ -82,3 +276,266 @@ func (at AccessToken) TableName() string {
 func (at *AccessToken) IsValid() bool {
 	return at.ExpiresAt.After(time.Now())
 }
+
+// HasScope reports whether the token grants the scope. Session tokens grant all scopes.
+func (at *AccessToken) HasScope(scope string) bool {
+	if at.APITokenID == "" {
+		return true
+	}
+
+	for _, s := range at.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Event is a WebSocket event kept in the event log, so reconnecting clients can replay it
+type Event struct {
+	Seq            int64      `json:"seq" db:"seq" sql:"type:bigint AUTO_INCREMENT; primary_key; not null;"`
+	Type           string     `json:"type" db:"type" sql:"type:varchar(64) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	BroadcastToAll bool       `json:"broadcastToAll" db:"broadcast_to_all" sql:"not null;"`
+	Data           string     `json:"data" db:"data" sql:"type:longtext CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+	FullData       string     `json:"fullData" db:"full_data" sql:"type:longtext CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+	CreatedAt      *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3); index;"`
+}
+
+func (e Event) TableName() string {
+	return "event"
+}
+
+// EventRecipient links an event, which is not broadcast to all users, to one of its recipients
+type EventRecipient struct {
+	UserID   string `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	EventSeq int64  `json:"eventSeq" db:"event_seq" sql:"type:bigint; primary_key; not null; index;"`
+}
+
+func (er EventRecipient) TableName() string {
+	return "event_recipient"
+}
+
+// WSTicket is a short-lived single-use credential for opening a WebSocket connection
+type WSTicket struct {
+	Ticket      string     `json:"ticket" db:"ticket" sql:"type:varchar(64) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	UserID      string     `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	AccessToken string     `json:"-" db:"access_token" sql:"type:varchar(64) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	ExpiresAt   *time.Time `json:"expiresAt" db:"expires_at" sql:"type:datetime(3); index;"`
+}
+
+func (t WSTicket) TableName() string {
+	return "ws_ticket"
+}
+
+// PushSubscription is a Web Push subscription of one of the user's browsers
+type PushSubscription struct {
+	ID        string     `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	UserID    string     `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	Endpoint  string     `json:"endpoint" db:"endpoint" sql:"type:varchar(2048) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	P256dh    string     `json:"p256dh" db:"p256dh" sql:"type:varchar(128) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	Auth      string     `json:"auth" db:"auth" sql:"type:varchar(64) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	CreatedAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+	UpdatedAt *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+}
+
+func (ps PushSubscription) TableName() string {
+	return "push_subscription"
+}
+
+// Webhook sends the events of a chat to an external URL
+type Webhook struct {
+	ID        string `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	ChatID    string `json:"chatId" db:"chat_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	CreatorID string `json:"creatorId" db:"creator_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	URL       string `json:"url" db:"url" sql:"type:varchar(2048) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null;"`
+
+	// Key of the HMAC-SHA256 signature of the requests. It is returned only when the webhook is created.
+	Secret string `json:"secret,omitempty" db:"secret" sql:"type:varchar(128) CHARSET utf8mb4 COLLATE utf8mb4_bin; not null;"`
+
+	// Comma separated list of the subscribed event types, exposed as Events
+	EventTypes string   `json:"-" db:"event_types" sql:"type:varchar(512) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	Events     []string `json:"events" sql:"-"`
+
+	Active    bool       `json:"active" db:"active" sql:"not null; default:true"`
+	CreatedAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+	UpdatedAt *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+}
+
+func (w Webhook) TableName() string {
+	return "webhook"
+}
+
+// Webhook delivery statuses. Deliveries which failed all attempts are dead and kept as the dead-letter log.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookDelivery is a single event sent to a webhook, together with the result of the last attempt
+type WebhookDelivery struct {
+	ID             string     `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	WebhookID      string     `json:"webhookId" db:"webhook_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	EventType      string     `json:"eventType" db:"event_type" sql:"type:varchar(64) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	Payload        string     `json:"payload" db:"payload" sql:"type:longtext CHARSET utf8mb4 COLLATE utf8mb4_general_ci"`
+	Status         string     `json:"status" db:"status" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null; index:idx_webhook_delivery_due"`
+	Attempts       int        `json:"attempts" db:"attempts" sql:"not null; default:0"`
+	ResponseStatus int        `json:"responseStatus" db:"response_status" sql:"not null; default:0"`
+	Error          string     `json:"error" db:"error" sql:"type:varchar(1024) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null; default:''"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt" db:"next_attempt_at" sql:"type:datetime(3); index:idx_webhook_delivery_due"`
+	DeliveredAt    *time.Time `json:"deliveredAt" db:"delivered_at" sql:"type:datetime(3)"`
+	CreatedAt      *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3); index;"`
+	UpdatedAt      *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+}
+
+func (wd WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// IncomingWebhook lets external systems post messages into a chat as the webhook's bot user
+type IncomingWebhook struct {
+	ID         string     `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	ChatID     string     `json:"chatId" db:"chat_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	CreatorID  string     `json:"creatorId" db:"creator_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	BotUserID  string     `json:"botUserId" db:"bot_user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	Name       string     `json:"name" db:"name" sql:"type:varchar(256) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null;"`
+	SecretHash string     `json:"-" db:"secret_hash" sql:"type:varchar(64) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	CreatedAt  *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+	UpdatedAt  *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+}
+
+func (iw IncomingWebhook) TableName() string {
+	return "incoming_webhook"
+}
+
+// API tokens start with the prefix, so they can be told apart from session tokens
+const APITokenPrefix = "cat_"
+
+// API token scopes
+const (
+	ScopeChatsRead     = "chats:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeMembersWrite  = "members:write"
+	ScopeCommandsWrite = "commands:write"
+)
+
+var APITokenScopes = []string{ScopeChatsRead, ScopeMessagesWrite, ScopeMembersWrite, ScopeCommandsWrite}
+
+// APIToken is a long-lived token of a bot user, created by the bot's owner
+type APIToken struct {
+	ID        string `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	UserID    string `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	Name      string `json:"name" db:"name" sql:"type:varchar(256) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null;"`
+	TokenHash string `json:"-" db:"token_hash" sql:"type:varchar(64) CHARACTER SET ascii COLLATE ascii_bin; unique_index; not null;"`
+
+	// Beginning of the token which helps to recognize it
+	Prefix string `json:"prefix" db:"prefix" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+
+	// Space separated list of the granted scopes, exposed as Scopes
+	Scope  string   `json:"-" db:"scope" sql:"type:varchar(256) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	Scopes []string `json:"scopes" sql:"-"`
+
+	ExpiresAt  *time.Time `json:"expiresAt" db:"expires_at" sql:"type:datetime(3)"`
+	LastUsedAt *time.Time `json:"lastUsedAt" db:"last_used_at" sql:"type:datetime(3)"`
+	CreatedAt  *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+}
+
+func (at APIToken) TableName() string {
+	return "api_token"
+}
+
+// IsValid reports whether the token didn't expire. Tokens without expiration date are valid until they are revoked.
+func (at *APIToken) IsValid() bool {
+	return at.ExpiresAt == nil || at.ExpiresAt.After(time.Now())
+}
+
+// BotCommand is a slash command registered by a bot user. It is available in the chats which the bot
+// is a member of, invocations are posted to the callback URL.
+type BotCommand struct {
+	ID          string `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	BotUserID   string `json:"botUserId" db:"bot_user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; unique_index:idx_bot_command_name; not null;"`
+	Name        string `json:"name" db:"name" sql:"type:varchar(32) CHARACTER SET ascii COLLATE ascii_bin; unique_index:idx_bot_command_name; not null;"`
+	Description string `json:"description" db:"description" sql:"type:varchar(256) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null;"`
+
+	// Arguments of the command shown in the help, e.g. "[environment]"
+	Hint string `json:"hint" db:"hint" sql:"type:varchar(256) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null;"`
+
+	CallbackURL string `json:"callbackUrl" db:"callback_url" sql:"type:varchar(2048) CHARSET utf8mb4 COLLATE utf8mb4_general_ci; not null;"`
+
+	// Key of the HMAC-SHA256 signature of the callbacks. It is returned only when the command is created.
+	Secret    string     `json:"secret,omitempty" db:"secret" sql:"type:varchar(128) CHARSET utf8mb4 COLLATE utf8mb4_bin; not null;"`
+	CreatedAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+	UpdatedAt *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+}
+
+func (bc BotCommand) TableName() string {
+	return "bot_command"
+}
+
+// MessageMention is a mention of a chat member in a message
+type MessageMention struct {
+	MessageID string `json:"messageId" db:"message_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	UserID    string `json:"userId" db:"user_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	ChatID    string `json:"chatId" db:"chat_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	AuthorID  string `json:"authorId" db:"author_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+
+	// The user is mentioned only with @all
+	Everyone bool `json:"everyone" db:"everyone" sql:"not null; default:false"`
+
+	CreatedAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3); index;"`
+}
+
+func (mm MessageMention) TableName() string {
+	return "message_mention"
+}
+
+// MentionItem is a mention together with its message, listed in the mention feed
+type MentionItem struct {
+	MessageMention
+	Message *Message `json:"message"`
+}
+
+// Kinds of the imported entities
+const (
+	ImportKindUser    = "user"
+	ImportKindChat    = "chat"
+	ImportKindMessage = "message"
+)
+
+// ImportRecord maps an entity imported from another chat service to its id in the source,
+// so importing the same export again doesn't duplicate it
+type ImportRecord struct {
+	Source     string     `json:"source" db:"source" sql:"type:varchar(64) CHARSET utf8mb4 COLLATE utf8mb4_bin; primary_key; not null;"`
+	Kind       string     `json:"kind" db:"kind" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	ExternalID string     `json:"externalId" db:"external_id" sql:"type:varchar(255) CHARSET utf8mb4 COLLATE utf8mb4_bin; primary_key; not null;"`
+	EntityID   string     `json:"entityId" db:"entity_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	CreatedAt  *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+}
+
+func (ir ImportRecord) TableName() string {
+	return "import_record"
+}
+
+// ChatInvite is a shareable code which adds the users who redeem it to the chat.
+// Invites without MaxUses can be redeemed any number of times, without ExpiresAt they don't expire.
+type ChatInvite struct {
+	ID        string     `json:"id" db:"id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; primary_key; not null;"`
+	ChatID    string     `json:"chatId" db:"chat_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; index; not null;"`
+	CreatorID string     `json:"creatorId" db:"creator_id" sql:"type:varchar(16) CHARACTER SET ascii COLLATE ascii_bin; not null;"`
+	Code      string     `json:"code" db:"code" sql:"type:varchar(32) CHARACTER SET ascii COLLATE ascii_bin; unique_index; not null;"`
+	MaxUses   int        `json:"maxUses" db:"max_uses" sql:"not null; default:0"`
+	Uses      int        `json:"uses" db:"uses" sql:"not null; default:0"`
+	ExpiresAt *time.Time `json:"expiresAt" db:"expires_at" sql:"type:datetime(3)"`
+	CreatedAt *time.Time `json:"createdAt" db:"created_at" sql:"type:datetime(3)"`
+	UpdatedAt *time.Time `json:"updatedAt" db:"updated_at" sql:"type:datetime(3)"`
+}
+
+func (ci ChatInvite) TableName() string {
+	return "chat_invite"
+}
+
+// IsUsable reports whether the invite can still be redeemed
+func (ci *ChatInvite) IsUsable(now time.Time) bool {
+	return (ci.MaxUses == 0 || ci.Uses < ci.MaxUses) && (ci.ExpiresAt == nil || ci.ExpiresAt.After(now))
+}
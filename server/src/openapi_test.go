@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"./broker"
+	"./model"
+	"./webpush"
+	"github.com/gorilla/mux"
+)
+
+// specValidator checks JSON values against the schemas of openAPISpec. It supports the subset of
+// the OpenAPI schema objects which the spec uses. Objects are validated strictly: properties which
+// the schema doesn't declare are reported, unless the schema allows additional properties or
+// doesn't declare any properties at all.
+type specValidator struct {
+	spec map[string]interface{}
+
+	// Sample values don't use the enumerated values, so the model tests skip the enums
+	checkEnums bool
+}
+
+func loadOpenAPISpec(t *testing.T) *specValidator {
+	spec := map[string]interface{}{}
+	err := json.Unmarshal([]byte(openAPISpec), &spec)
+	if err != nil {
+		t.Fatalf("Failed to parse the OpenAPI spec: %v", err)
+	}
+
+	return &specValidator{spec: spec, checkEnums: true}
+}
+
+func (v *specValidator) object(value interface{}, keys ...string) map[string]interface{} {
+	for _, key := range keys {
+		m, _ := value.(map[string]interface{})
+		value = m[key]
+	}
+
+	m, _ := value.(map[string]interface{})
+	return m
+}
+
+func (v *specValidator) component(name string) map[string]interface{} {
+	return v.object(v.spec, "components", "schemas", name)
+}
+
+func (v *specValidator) resolve(schema map[string]interface{}) map[string]interface{} {
+	for schema != nil {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			break
+		}
+
+		schema = v.component(strings.TrimPrefix(ref, "#/components/schemas/"))
+	}
+
+	return schema
+}
+
+// operation returns the spec operation of the path template relative to the API prefix
+func (v *specValidator) operation(method, path string) map[string]interface{} {
+	return v.object(v.spec, "paths", path, strings.ToLower(method))
+}
+
+func (v *specValidator) responseSchema(method, path string, status int) (map[string]interface{}, error) {
+	op := v.operation(method, path)
+	if op == nil {
+		return nil, fmt.Errorf("%s %s is not in the spec", method, path)
+	}
+
+	response := v.object(op, "responses", fmt.Sprint(status))
+	if response == nil {
+		return nil, fmt.Errorf("%s %s doesn't declare the %d response", method, path, status)
+	}
+
+	return v.object(response, "content", "application/json", "schema"), nil
+}
+
+func (v *specValidator) requestSchema(method, path string) map[string]interface{} {
+	return v.object(v.operation(method, path), "requestBody", "content", "application/json", "schema")
+}
+
+// flatten merges the allOf parts of the schema into a single schema
+func (v *specValidator) flatten(schema map[string]interface{}) (typ string, properties map[string]interface{}, required []string, additional interface{}) {
+	schema = v.resolve(schema)
+	properties = map[string]interface{}{}
+
+	parts, _ := schema["allOf"].([]interface{})
+	for _, part := range parts {
+		partSchema, _ := part.(map[string]interface{})
+		partType, partProperties, partRequired, partAdditional := v.flatten(partSchema)
+		if typ == "" {
+			typ = partType
+		}
+		for name, property := range partProperties {
+			properties[name] = property
+		}
+		required = append(required, partRequired...)
+		if partAdditional != nil {
+			additional = partAdditional
+		}
+	}
+
+	if schemaType, ok := schema["type"].(string); ok {
+		typ = schemaType
+	}
+	for name, property := range v.object(schema, "properties") {
+		properties[name] = property
+	}
+	names, _ := schema["required"].([]interface{})
+	for _, name := range names {
+		required = append(required, name.(string))
+	}
+	if schemaAdditional, ok := schema["additionalProperties"]; ok {
+		additional = schemaAdditional
+	}
+
+	return typ, properties, required, additional
+}
+
+func (v *specValidator) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	if schema == nil {
+		return nil
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		if nullable, _ := v.resolve(schema)["nullable"].(bool); nullable {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+
+	schema = v.resolve(schema)
+	errs := []string{}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && v.checkEnums {
+		found := false
+		for _, item := range enum {
+			if item == value {
+				found = true
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", at, value, enum))
+		}
+	}
+
+	typ, properties, required, additional := v.flatten(schema)
+	switch typ {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: %T is not an object", at, value))
+		}
+
+		for _, name := range required {
+			if _, ok := object[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: required property %s is missing", at, name))
+			}
+		}
+
+		for name, item := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				errs = append(errs, v.validate(property, item, at+"."+name)...)
+			} else if additionalSchema, ok := additional.(map[string]interface{}); ok {
+				errs = append(errs, v.validate(additionalSchema, item, at+"."+name)...)
+			} else if additional != true && len(properties) > 0 {
+				errs = append(errs, fmt.Sprintf("%s: property %s is not in the spec", at, name))
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: %T is not an array", at, value))
+		}
+
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			errs = append(errs, v.validate(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %T is not a string", at, value))
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != math.Trunc(number) {
+			errs = append(errs, fmt.Sprintf("%s: %v is not an integer", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %T is not a number", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: %T is not a boolean", at, value))
+		}
+	}
+
+	return errs
+}
+
+func (v *specValidator) validateJSON(t *testing.T, name string, schema map[string]interface{}, data []byte) {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		t.Errorf("%s: invalid JSON %q: %v", name, data, err)
+		return
+	}
+
+	for _, err := range v.validate(schema, value, name) {
+		t.Error(err)
+	}
+}
+
+// TestOpenAPISpecRoutes checks that the spec documents exactly the routes of the router
+func TestOpenAPISpecRoutes(t *testing.T) {
+	v := loadOpenAPISpec(t)
+
+	routes := map[string]bool{}
+	err := newRouter(&apiController{}).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouters and prefixes don't have methods
+			return nil
+		}
+
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+
+		for _, method := range methods {
+			routes[strings.ToLower(method)+" "+strings.TrimPrefix(template, apiV1Prefix)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk the routes: %v", err)
+	}
+
+	documented := map[string]bool{}
+	for path, operations := range v.object(v.spec, "paths") {
+		for method := range operations.(map[string]interface{}) {
+			if method == "parameters" {
+				continue
+			}
+			documented[method+" "+path] = true
+		}
+	}
+
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("Route %s is not in the spec", route)
+		}
+	}
+	for route := range documented {
+		if !routes[route] {
+			t.Errorf("Spec documents %s, which isn't routed", route)
+		}
+	}
+}
+
+// sampleValue fills every field of the value, so the JSON of the value has all of its properties
+func sampleValue(value reflect.Value) {
+	switch value.Interface().(type) {
+	case time.Time:
+		value.Set(reflect.ValueOf(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+		return
+	case json.RawMessage:
+		value.Set(reflect.ValueOf(json.RawMessage(`{"type":"message_create","seq":1}`)))
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		value.Set(reflect.New(value.Type().Elem()))
+		sampleValue(value.Elem())
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			// Passwords are only read from the requests, the handlers never write them
+			field := value.Type().Field(i)
+			if field.PkgPath == "" && field.Name != "Password" {
+				sampleValue(value.Field(i))
+			}
+		}
+	case reflect.Slice:
+		value.Set(reflect.MakeSlice(value.Type(), 1, 1))
+		sampleValue(value.Index(0))
+	case reflect.Map:
+		value.Set(reflect.MakeMap(value.Type()))
+		key := reflect.New(value.Type().Key()).Elem()
+		item := reflect.New(value.Type().Elem()).Elem()
+		sampleValue(key)
+		sampleValue(item)
+		value.SetMapIndex(key, item)
+	case reflect.String:
+		value.SetString("sample")
+	case reflect.Bool:
+		value.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		value.SetFloat(1.5)
+	}
+}
+
+// TestOpenAPISpecModels checks that the component schemas match the JSON of the types which the handlers write
+func TestOpenAPISpecModels(t *testing.T) {
+	v := loadOpenAPISpec(t)
+	v.checkEnums = false
+
+	models := map[string]interface{}{
+		"APIError":               APIError{},
+		"FieldError":             FieldError{},
+		"PublicUser":             model.PublicUser{},
+		"User":                   model.User{},
+		"UserWithToken":          UserWithToken{},
+		"Chat":                   model.Chat{},
+		"Message":                model.Message{},
+		"Role":                   RoleData{},
+		"AdminChat":              AdminChat{},
+		"ServerStats":            ServerStats{},
+		"MessagePreview":         model.MessagePreview{},
+		"ChatListItem":           model.ChatListItem{},
+		"EventList":              EventList{},
+		"HelloEvent":             WSHelloData{},
+		"WSTicket":               WSTicket{},
+		"VAPIDPublicKey":         VAPIDPublicKey{},
+		"PushSubscriptionData":   PushSubscriptionData{},
+		"PushSubscription":       model.PushSubscription{},
+		"DigestSettings":         model.DigestSettings{},
+		"WebhookData":            WebhookData{},
+		"Webhook":                model.Webhook{},
+		"WebhookDelivery":        model.WebhookDelivery{},
+		"IncomingWebhookData":    IncomingWebhookData{},
+		"IncomingWebhook":        model.IncomingWebhook{},
+		"IncomingWebhookWithURL": IncomingWebhookWithURL{},
+		"IncomingWebhookMessage": IncomingWebhookMessage{},
+		"BotData":                BotData{},
+		"APITokenData":           APITokenData{},
+		"APIToken":               model.APIToken{},
+		"APITokenWithValue":      APITokenWithValue{},
+		"ChatCommand":            ChatCommand{},
+		"BotCommandData":         BotCommandData{},
+		"BotCommand":             model.BotCommand{},
+		"BotCommandPayload":      BotCommandPayload{},
+		"BotCommandResponse":     BotCommandResponse{},
+		"EphemeralEvent":         WSEphemeralData{},
+		"MessageMention":         model.MessageMention{},
+		"MentionItem":            model.MentionItem{},
+		"MentionEvent":           WSMentionData{},
+		"LinkPreview":            model.LinkPreview{},
+		"MessageData":            MessageData{},
+		"ScheduledMessage":       model.ScheduledMessage{},
+		"RetentionData":          RetentionData{},
+		"RetentionReport":        RetentionReport{},
+		"RetentionStatus":        RetentionStatus{},
+		"ExportAuthor":           ExportAuthor{},
+		"ExportedMessage":        ExportedMessage{},
+		"DiscoverableChat":       model.DiscoverableChat{},
+		"ChatInviteData":         ChatInviteData{},
+		"ChatInvite":             model.ChatInvite{},
+	}
+
+	names := []string{}
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		schema := v.component(name)
+		if schema == nil {
+			t.Errorf("Schema %s is not in the spec", name)
+			continue
+		}
+
+		value := reflect.New(reflect.TypeOf(models[name]))
+		sampleValue(value.Elem())
+
+		data, err := json.Marshal(value.Interface())
+		if err != nil {
+			t.Errorf("Failed to marshal %s: %v", name, err)
+			continue
+		}
+
+		v.validateJSON(t, name, schema, data)
+	}
+}
+
+// TestOpenAPISpecHandlers runs requests which don't need the database through the router and
+// validates the request bodies and the responses against the spec
+func TestOpenAPISpecHandlers(t *testing.T) {
+	v := loadOpenAPISpec(t)
+
+	vapidKeys, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("Failed to generate VAPID keys: %v", err)
+	}
+
+	tokenCache := newTokenCache(time.Hour)
+	expiresAt := time.Now().Add(time.Hour)
+	users := map[string]*model.User{
+		"user-token":  {PublicUser: model.PublicUser{ID: "user", Username: "user"}, Role: model.UserRoleUser},
+		"admin-token": {PublicUser: model.PublicUser{ID: "admin", Username: "admin"}, Role: model.UserRoleAdmin},
+		"bot-token":   {PublicUser: model.PublicUser{ID: "bot", Username: "bot", Bot: true}, Role: model.UserRoleUser},
+	}
+	for tokenString, user := range users {
+		token := &model.AccessToken{UserID: user.ID, Token: tokenString, ExpiresAt: &expiresAt}
+		if user.Bot {
+			token.APITokenID = "api-token"
+		}
+		tokenCache.set(token, user)
+	}
+
+	api := &apiController{
+		tokenCache:       tokenCache,
+		wsHub:            newWsHub(broker.NewMemoryBroker(), nil, tokenCache, nil),
+		vapidKeys:        vapidKeys,
+		retentionSweeper: newRetentionSweeper(nil, 30*24*time.Hour),
+	}
+	router := newRouter(api)
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/openapi.json", "", "", http.StatusOK},
+		{http.MethodGet, "/users/active", "user-token", "", http.StatusOK},
+		{http.MethodGet, "/users/active", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/push/vapid-public-key", "user-token", "", http.StatusOK},
+		{http.MethodGet, "/admin/retention", "admin-token", "", http.StatusOK},
+		{http.MethodGet, "/admin/retention", "user-token", "", http.StatusForbidden},
+		{http.MethodGet, "/push/vapid-public-key", "bot-token", "", http.StatusForbidden},
+		{http.MethodPost, "/register", "", `{"username":"ab","password":"secret"}`, http.StatusBadRequest},
+		{http.MethodPost, "/chat", "user-token", `{"id":"","creatorId":"","directUserId":"","title":"` + strings.Repeat("t", 300) + `"}`, http.StatusBadRequest},
+		{http.MethodPut, "/digest/settings", "user-token", `{"email":"invalid","digestFrequency":"daily"}`, http.StatusBadRequest},
+		{http.MethodPost, "/bots", "user-token", `{"username":"b!","fullName":"Bot"}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		name := test.method + " " + test.path
+		if test.body != "" {
+			v.validateJSON(t, name+" request", v.requestSchema(test.method, test.path), []byte(test.body))
+		}
+
+		req := httptest.NewRequest(test.method, apiV1Prefix+test.path, bytes.NewBufferString(test.body))
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("%s: got status %d, want %d: %s", name, rec.Code, test.status, rec.Body.String())
+			continue
+		}
+
+		schema, err := v.responseSchema(test.method, test.path, rec.Code)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		v.validateJSON(t, fmt.Sprintf("%s %d response", name, rec.Code), schema, rec.Body.Bytes())
+	}
+
+	// Errors of the unknown routes aren't part of any operation, but they have the same body
+	req := httptest.NewRequest(http.MethodGet, apiV1Prefix+"/unknown", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /unknown: got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	v.validateJSON(t, "GET /unknown response", v.component("APIError"), rec.Body.Bytes())
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"./model"
+	"./webpush"
+	"github.com/gorilla/mux"
+)
+
+type VAPIDPublicKey struct {
+	PublicKey string `json:"publicKey"`
+}
+
+// PushSubscriptionData is the JSON form of the browser's PushSubscription
+type PushSubscriptionData struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+func (c *apiController) getVAPIDPublicKey(w http.ResponseWriter, r *http.Request) {
+	c.writeResponse(w, http.StatusOK, &VAPIDPublicKey{
+		PublicKey: c.vapidKeys.PublicKey(),
+	})
+}
+
+func (c *apiController) listPushSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions := []model.PushSubscription{}
+	err := c.store.PushSubscriptionRepo.ListByUserID(contextUserID(r), &subscriptions)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, subscriptions)
+}
+
+func (c *apiController) createPushSubscription(w http.ResponseWriter, r *http.Request) {
+	data := PushSubscriptionData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Validate subscription
+	{
+		errs := validationErrors{}
+
+		endpoint, err := url.Parse(data.Endpoint)
+		if data.Endpoint == "" {
+			errs.add("endpoint", FieldErrRequired, "Endpoint is required")
+		} else if len(data.Endpoint) > 2048 {
+			errs.add("endpoint", FieldErrTooLong, "Endpoint must be at most 2048 characters long")
+		} else if err != nil || endpoint.Host == "" || !c.isAllowedPushScheme(endpoint.Scheme) {
+			errs.add("endpoint", FieldErrInvalid, "Endpoint must be an https URL")
+		}
+
+		sub := webpush.Subscription{
+			Endpoint: data.Endpoint,
+			P256dh:   data.Keys.P256dh,
+			Auth:     data.Keys.Auth,
+		}
+		if data.Keys.P256dh == "" {
+			errs.add("keys.p256dh", FieldErrRequired, "Key p256dh is required")
+		}
+		if data.Keys.Auth == "" {
+			errs.add("keys.auth", FieldErrRequired, "Key auth is required")
+		}
+		if data.Keys.P256dh != "" && data.Keys.Auth != "" {
+			if err := sub.Validate(); err != nil {
+				errs.add("keys", FieldErrInvalid, err.Error())
+			}
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
+	subscription := model.PushSubscription{
+		UserID:   contextUserID(r),
+		Endpoint: data.Endpoint,
+		P256dh:   data.Keys.P256dh,
+		Auth:     data.Keys.Auth,
+	}
+	err = c.store.PushSubscriptionRepo.Save(&subscription)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusCreated, subscription)
+}
+
+func (c *apiController) deletePushSubscription(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	subscription := model.PushSubscription{}
+	err := c.store.PushSubscriptionRepo.Get(vars["subscriptionID"], &subscription)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	if subscription.UserID != contextUserID(r) {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeNotFound, "Push subscription is not found")
+		return
+	}
+
+	err = c.store.PushSubscriptionRepo.Delete(subscription.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+func (c *apiController) muteChat(w http.ResponseWriter, r *http.Request) {
+	c.setChatMuted(w, r, true)
+}
+
+func (c *apiController) unmuteChat(w http.ResponseWriter, r *http.Request) {
+	c.setChatMuted(w, r, false)
+}
+
+func (c *apiController) setChatMuted(w http.ResponseWriter, r *http.Request, muted bool) {
+	vars := mux.Vars(r)
+
+	err := c.store.ChatUserRepo.UpdateMuted(vars["chatID"], contextUserID(r), muted)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// isAllowedPushScheme allows plain http endpoints only when they are enabled for local push service stubs
+func (c *apiController) isAllowedPushScheme(scheme string) bool {
+	return scheme == "https" || (scheme == "http" && c.allowInsecurePush)
+}
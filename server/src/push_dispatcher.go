@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"./dbcontroller"
+	"./model"
+	"./webpush"
+)
+
+const (
+	// Notifications of a user within the window are coalesced into a single push message
+	pushBatchWindow = 5 * time.Second
+
+	// Seconds for which the push service keeps undelivered messages
+	pushTTL = 24 * 60 * 60
+
+	pushMaxAttempts    = 4
+	pushRetryBaseDelay = 2 * time.Second
+
+	pushQueueSize   = 1000
+	pushWorkers     = 10
+	pushSnippetLen  = 120
+	pushCoalesceTag = "messages"
+)
+
+const PushTypeMessages = "messages"
+
+// PushPayload is the decrypted content of a push message, handled by the service worker
+type PushPayload struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Count int    `json:"count"`
+
+	// Set when all coalesced messages belong to a single chat
+	ChatID string `json:"chatId,omitempty"`
+
+	// Set when the push message carries a single chat message
+	MessageID string `json:"messageId,omitempty"`
+}
+
+// pushSubscriptionStore is the part of the store which delivers the push messages
+type pushSubscriptionStore interface {
+	ListByUserID(userID string, subscriptions *[]model.PushSubscription) error
+	Delete(id string) error
+}
+
+type pushItem struct {
+	userID    string
+	chatID    string
+	messageID string
+	title     string
+	body      string
+}
+
+// pushDelivery is a push message to a single subscription, it is retried until it is delivered or the attempts run out
+type pushDelivery struct {
+	subscription *model.PushSubscription
+	data         []byte
+	opts         *webpush.Options
+	attempt      int
+	delay        time.Duration
+}
+
+// PushDispatcher sends Web Push notifications about new messages to the chat members
+// which are not connected over WebSocket to any server node
+type PushDispatcher struct {
+	store         *dbcontroller.Store
+	subscriptions pushSubscriptionStore
+	hub           *WSHub
+	sender        *webpush.Sender
+
+	messages chan *model.Message
+	items    chan *pushItem
+	retries  chan *pushDelivery
+	workers  chan struct{}
+
+	batchWindow time.Duration
+	retryDelay  time.Duration
+
+	// Notifications waiting for the end of their user's batch window
+	pending   map[string][]*pushItem
+	deadlines map[string]time.Time
+}
+
+func newPushDispatcher(store *dbcontroller.Store, hub *WSHub, sender *webpush.Sender) *PushDispatcher {
+	return &PushDispatcher{
+		store:         store,
+		subscriptions: store.PushSubscriptionRepo,
+		hub:           hub,
+		sender:        sender,
+		messages:      make(chan *model.Message, pushQueueSize),
+		items:         make(chan *pushItem, pushQueueSize),
+		retries:       make(chan *pushDelivery, pushQueueSize),
+		workers:       make(chan struct{}, pushWorkers),
+		batchWindow:   pushBatchWindow,
+		retryDelay:    pushRetryBaseDelay,
+		pending:       make(map[string][]*pushItem),
+		deadlines:     make(map[string]time.Time),
+	}
+}
+
+// notifyMessage queues notifications about the new message without blocking the caller
+func (d *PushDispatcher) notifyMessage(msg *model.Message) {
+	msgCopy := *msg
+
+	select {
+	case d.messages <- &msgCopy:
+	default:
+		log.Printf("Push queue is full, dropping notifications of message %s\n", msg.ID)
+	}
+}
+
+func (d *PushDispatcher) run() {
+	go d.runPrepare()
+
+	ticker := time.NewTicker(d.batchWindow / 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item := <-d.items:
+			if _, ok := d.deadlines[item.userID]; !ok {
+				d.deadlines[item.userID] = time.Now().Add(d.batchWindow)
+			}
+			d.pending[item.userID] = append(d.pending[item.userID], item)
+		case now := <-ticker.C:
+			for userID, deadline := range d.deadlines {
+				if now.Before(deadline) {
+					continue
+				}
+
+				items := d.pending[userID]
+				delete(d.pending, userID)
+				delete(d.deadlines, userID)
+
+				d.workers <- struct{}{}
+				go func(userID string, items []*pushItem) {
+					defer func() { <-d.workers }()
+					d.deliver(userID, items)
+				}(userID, items)
+			}
+		case delivery := <-d.retries:
+			d.workers <- struct{}{}
+			go func(delivery *pushDelivery) {
+				defer func() { <-d.workers }()
+				d.send(delivery)
+			}(delivery)
+		}
+	}
+}
+
+// runPrepare resolves the recipients of the queued messages
+func (d *PushDispatcher) runPrepare() {
+	for msg := range d.messages {
+		err := d.prepare(msg)
+		if err != nil {
+			log.Printf("Failed to prepare push notifications of message %s: %+v\n", msg.ID, err)
+		}
+	}
+}
+
+func (d *PushDispatcher) prepare(msg *model.Message) error {
+	chatUsers := []model.ChatUser{}
+	err := d.store.ChatUserRepo.ListByChatID(msg.ChatID, &chatUsers)
+	if err != nil {
+		return err
+	}
+
+	online := make(map[string]bool)
+	for _, userID := range d.hub.listActiveUserIDs() {
+		online[userID] = true
+	}
+
+	recipients := []string{}
+	for i := range chatUsers {
+		userID := chatUsers[i].UserID
+		if userID == msg.UserID || chatUsers[i].Muted || online[userID] {
+			continue
+		}
+
+		recipients = append(recipients, userID)
+	}
+
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	author := model.User{}
+	err = d.store.UserRepo.Get(msg.UserID, &author)
+	if err != nil {
+		return err
+	}
+
+	chat := model.Chat{}
+	err = d.store.ChatRepo.Get(msg.ChatID, &chat)
+	if err != nil {
+		return err
+	}
+
+	title := displayName(&author.PublicUser)
+	if chat.DirectUserID == "" && chat.Title != "" {
+		title = title + " in " + chat.Title
+	}
+
+	for _, userID := range recipients {
+		d.items <- &pushItem{
+			userID:    userID,
+			chatID:    msg.ChatID,
+			messageID: msg.ID,
+			title:     title,
+			body:      truncate(msg.Message, pushSnippetLen),
+		}
+	}
+
+	return nil
+}
+
+// deliver coalesces the notifications into a single push message and sends it to all subscriptions of the user
+func (d *PushDispatcher) deliver(userID string, items []*pushItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	// The user may have connected during the batch window
+	for _, onlineUserID := range d.hub.listActiveUserIDs() {
+		if onlineUserID == userID {
+			return
+		}
+	}
+
+	subscriptions := []model.PushSubscription{}
+	err := d.subscriptions.ListByUserID(userID, &subscriptions)
+	if err != nil {
+		log.Printf("Failed to list push subscriptions of %s: %+v\n", userID, err)
+		return
+	}
+
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	payload, topic := coalescePushItems(items)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to marshal push payload: %+v\n", err)
+		return
+	}
+
+	opts := &webpush.Options{
+		TTL:     pushTTL,
+		Topic:   topic,
+		Urgency: "normal",
+	}
+
+	for i := range subscriptions {
+		d.send(&pushDelivery{
+			subscription: &subscriptions[i],
+			data:         data,
+			opts:         opts,
+			attempt:      1,
+			delay:        d.retryDelay,
+		})
+	}
+}
+
+// send delivers the push message and schedules the retry of temporary failures with exponential backoff
+func (d *PushDispatcher) send(delivery *pushDelivery) {
+	subscription := delivery.subscription
+	sub := &webpush.Subscription{
+		Endpoint: subscription.Endpoint,
+		P256dh:   subscription.P256dh,
+		Auth:     subscription.Auth,
+	}
+
+	err := d.sender.Send(sub, delivery.data, delivery.opts)
+	if err == nil {
+		return
+	}
+
+	sendErr, isSendErr := err.(*webpush.SendError)
+	if isSendErr && sendErr.Gone() {
+		// The browser unsubscribed or the subscription expired
+		err = d.subscriptions.Delete(subscription.ID)
+		if err != nil {
+			log.Printf("Failed to remove push subscription %s: %+v\n", subscription.ID, err)
+		}
+		return
+	}
+
+	if isSendErr && !sendErr.Temporary() {
+		log.Printf("Push message to subscription %s was rejected: %+v\n", subscription.ID, err)
+		return
+	}
+
+	if delivery.attempt == pushMaxAttempts {
+		log.Printf("Failed to send push message to subscription %s: %+v\n", subscription.ID, err)
+		return
+	}
+
+	// The retry waits without holding a worker, so the backoff doesn't delay the messages of other users
+	retry := *delivery
+	retry.attempt++
+	retry.delay *= 2
+	time.AfterFunc(delivery.delay, func() {
+		d.retries <- &retry
+	})
+}
+
+// coalescePushItems builds the push payload and its topic. Pending push messages with the
+// same topic are replaced by the push service, so an offline device receives only the latest one.
+func coalescePushItems(items []*pushItem) (*PushPayload, string) {
+	chatIDs := make(map[string]bool)
+	for _, item := range items {
+		chatIDs[item.chatID] = true
+	}
+
+	last := items[len(items)-1]
+	payload := &PushPayload{
+		Type:  PushTypeMessages,
+		Title: last.title,
+		Body:  last.body,
+		Count: len(items),
+	}
+
+	if len(items) == 1 {
+		payload.ChatID = last.chatID
+		payload.MessageID = last.messageID
+
+		return payload, last.chatID
+	}
+
+	if len(chatIDs) == 1 {
+		payload.ChatID = last.chatID
+		payload.Body = fmt.Sprintf("%d new messages", len(items))
+
+		return payload, last.chatID
+	}
+
+	payload.Title = "ChatApp"
+	payload.Body = fmt.Sprintf("%d new messages in %d chats", len(items), len(chatIDs))
+
+	return payload, pushCoalesceTag
+}
+
+func displayName(user *model.PublicUser) string {
+	if user.FullName != "" {
+		return user.FullName
+	}
+
+	return user.Username
+}
+
+// truncate shortens the text to at most n characters
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	return string(runes[:n-1]) + "…"
+}
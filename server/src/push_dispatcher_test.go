@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"./broker"
+	"./dbcontroller"
+	"./model"
+	"./webpush"
+)
+
+// testPushSubscriptions is an in-memory store of the push subscriptions
+type testPushSubscriptions struct {
+	mu       sync.Mutex
+	byUserID map[string][]model.PushSubscription
+	deleted  []string
+}
+
+func (s *testPushSubscriptions) ListByUserID(userID string, subscriptions *[]model.PushSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	*subscriptions = append(*subscriptions, s.byUserID[userID]...)
+	return nil
+}
+
+func (s *testPushSubscriptions) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+type testPushRequest struct {
+	path  string
+	topic string
+}
+
+// testPushService responds to the push messages with the queued status codes of their path, 201 by default
+type testPushService struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	statuses map[string][]int
+	requests chan testPushRequest
+}
+
+func newTestPushService() *testPushService {
+	s := &testPushService{
+		statuses: make(map[string][]int),
+		requests: make(chan testPushRequest, 100),
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		status := http.StatusCreated
+		if len(s.statuses[r.URL.Path]) > 0 {
+			status = s.statuses[r.URL.Path][0]
+			s.statuses[r.URL.Path] = s.statuses[r.URL.Path][1:]
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+		s.requests <- testPushRequest{path: r.URL.Path, topic: r.Header.Get("Topic")}
+	}))
+
+	return s
+}
+
+// respond queues the status codes of the next messages to the path
+func (s *testPushService) respond(path string, statuses ...int) {
+	s.mu.Lock()
+	s.statuses[path] = append(s.statuses[path], statuses...)
+	s.mu.Unlock()
+}
+
+func (s *testPushService) expectRequest(t *testing.T, path string) testPushRequest {
+	select {
+	case req := <-s.requests:
+		if req.path != path {
+			t.Fatalf("Push service received a message to %s, want %s", req.path, path)
+		}
+		return req
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Push service didn't receive a message to %s", path)
+	}
+
+	return testPushRequest{}
+}
+
+func (s *testPushService) expectNoRequest(t *testing.T, wait time.Duration) {
+	select {
+	case req := <-s.requests:
+		t.Fatalf("Push service received an unexpected message to %s", req.path)
+	case <-time.After(wait):
+	}
+}
+
+func newTestPushSubscription(t *testing.T, id, endpoint string) model.PushSubscription {
+	curve := elliptic.P256()
+	_, x, y, err := elliptic.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate subscription key: %v", err)
+	}
+
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	return model.PushSubscription{
+		ID:       id,
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(elliptic.Marshal(curve, x, y)),
+		Auth:     base64.RawURLEncoding.EncodeToString(auth),
+	}
+}
+
+func startTestPushDispatcher(t *testing.T, service *testPushService, workers int) (*PushDispatcher, *testPushSubscriptions) {
+	keys, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("Failed to generate VAPID keys: %v", err)
+	}
+
+	subscriptions := &testPushSubscriptions{byUserID: make(map[string][]model.PushSubscription)}
+	for _, userID := range []string{"a", "b", "gone"} {
+		subscriptions.byUserID[userID] = []model.PushSubscription{
+			newTestPushSubscription(t, "sub-"+userID, service.server.URL+"/"+userID),
+		}
+	}
+
+	hub := newWsHub(broker.NewMemoryBroker(), nil, newTokenCache(time.Hour), nil)
+	d := newPushDispatcher(&dbcontroller.Store{}, hub, webpush.NewSender(keys, "mailto:admin@example.com", nil))
+	d.subscriptions = subscriptions
+	d.workers = make(chan struct{}, workers)
+	d.batchWindow = 100 * time.Millisecond
+	d.retryDelay = 500 * time.Millisecond
+	go d.run()
+
+	return d, subscriptions
+}
+
+func TestPushDispatcherBatching(t *testing.T) {
+	service := newTestPushService()
+	defer service.server.Close()
+
+	d, subscriptions := startTestPushDispatcher(t, service, pushWorkers)
+
+	// Notifications of one user within the batch window are sent as a single push message
+	d.items <- &pushItem{userID: "a", chatID: "chat1", messageID: "m1"}
+	d.items <- &pushItem{userID: "a", chatID: "chat2", messageID: "m2"}
+	d.items <- &pushItem{userID: "a", chatID: "chat1", messageID: "m3"}
+
+	req := service.expectRequest(t, "/a")
+	if req.topic != pushCoalesceTag {
+		t.Errorf("Push message about several chats has topic %q, want %q", req.topic, pushCoalesceTag)
+	}
+	service.expectNoRequest(t, 300*time.Millisecond)
+
+	d.items <- &pushItem{userID: "b", chatID: "chat1", messageID: "m4"}
+	req = service.expectRequest(t, "/b")
+	if req.topic != "chat1" {
+		t.Errorf("Push message about one chat has topic %q, want %q", req.topic, "chat1")
+	}
+
+	// Subscriptions which the push service reports as gone are removed without retries
+	service.respond("/gone", http.StatusGone)
+	d.items <- &pushItem{userID: "gone", chatID: "chat1", messageID: "m5"}
+	service.expectRequest(t, "/gone")
+	service.expectNoRequest(t, 800*time.Millisecond)
+
+	subscriptions.mu.Lock()
+	defer subscriptions.mu.Unlock()
+	if len(subscriptions.deleted) != 1 || subscriptions.deleted[0] != "sub-gone" {
+		t.Errorf("Deleted subscriptions are %v, want [sub-gone]", subscriptions.deleted)
+	}
+}
+
+func TestPushDispatcherRetry(t *testing.T) {
+	service := newTestPushService()
+	defer service.server.Close()
+
+	// A single worker shows that waiting for the retry doesn't block the other users
+	d, _ := startTestPushDispatcher(t, service, 1)
+
+	service.respond("/a", http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	d.items <- &pushItem{userID: "a", chatID: "chat1", messageID: "m1"}
+	service.expectRequest(t, "/a")
+
+	d.items <- &pushItem{userID: "b", chatID: "chat1", messageID: "m2"}
+	service.expectRequest(t, "/b")
+
+	// The retries back off exponentially and stop after the message is delivered
+	start := time.Now()
+	service.expectRequest(t, "/a")
+	service.expectRequest(t, "/a")
+	if elapsed := time.Since(start); elapsed < d.retryDelay {
+		t.Errorf("Retries were sent after %v, want at least %v", elapsed, d.retryDelay)
+	}
+	service.expectNoRequest(t, 2*time.Second)
+}
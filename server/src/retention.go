@@ -0,0 +1,310 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"./dbcontroller"
+	"./model"
+	"github.com/gorilla/mux"
+)
+
+const (
+	retentionSweepInterval = time.Minute
+	retentionBatchSize     = 500
+
+	minMessageRetention = time.Hour
+	maxMessageRetention = 10 * 365 * 24 * time.Hour
+
+	minMessageTTL = 30 * time.Second
+	maxMessageTTL = 365 * 24 * time.Hour
+)
+
+// RetentionData is the request body of changing the retention settings of a chat, in seconds
+type RetentionData struct {
+	MessageRetention int64 `json:"messageRetention"`
+	MessageTTL       int64 `json:"messageTtl"`
+}
+
+// RetentionReport describes the messages removed by a single sweep
+type RetentionReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	// Messages removed after their TTL and after the retention of their chat
+	Expired  int64 `json:"expired"`
+	Retained int64 `json:"retained"`
+
+	// Removed messages by chat id
+	Chats map[string]int64 `json:"chats"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// RetentionStatus is the retention configuration of the server with the report of the last sweep
+type RetentionStatus struct {
+	DefaultRetention int64            `json:"defaultRetention"`
+	TotalPurged      int64            `json:"totalPurged"`
+	LastSweep        *RetentionReport `json:"lastSweep"`
+}
+
+// RetentionSweeper removes the messages which outlived the message TTL or the retention of their chat.
+// The default retention applies to all chats, the chats can only shorten it. Every server node
+// sweeps, removing a message twice is harmless.
+type RetentionSweeper struct {
+	store *dbcontroller.Store
+
+	// Zero keeps the messages of the chats without their own retention
+	defaultRetention time.Duration
+
+	mu          sync.Mutex
+	lastReport  *RetentionReport
+	totalPurged int64
+}
+
+func newRetentionSweeper(store *dbcontroller.Store, defaultRetention time.Duration) *RetentionSweeper {
+	return &RetentionSweeper{
+		store:            store,
+		defaultRetention: defaultRetention,
+	}
+}
+
+// run sweeps the messages periodically, deleted is called with the removed messages of every chat
+func (s *RetentionSweeper) run(deleted func(chatID string, messages []model.Message)) {
+	for {
+		report := s.sweep(deleted)
+
+		s.mu.Lock()
+		s.lastReport = report
+		s.totalPurged += report.Expired + report.Retained
+		s.mu.Unlock()
+
+		if report.Error != "" {
+			log.Printf("Message retention sweep failed: %s\n", report.Error)
+		}
+		if report.Expired > 0 || report.Retained > 0 {
+			log.Printf("Message retention removed %d expired and %d retained messages of %d chats\n", report.Expired, report.Retained, len(report.Chats))
+		}
+
+		time.Sleep(retentionSweepInterval)
+	}
+}
+
+func (s *RetentionSweeper) status() *RetentionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &RetentionStatus{
+		DefaultRetention: int64(s.defaultRetention / time.Second),
+		TotalPurged:      s.totalPurged,
+		LastSweep:        s.lastReport,
+	}
+}
+
+// effectiveRetention is the shorter of the chat retention and the default retention, zero keeps the messages
+func (s *RetentionSweeper) effectiveRetention(chat *model.Chat) time.Duration {
+	retention := time.Duration(chat.MessageRetention) * time.Second
+	if s.defaultRetention > 0 && (retention <= 0 || s.defaultRetention < retention) {
+		retention = s.defaultRetention
+	}
+
+	return retention
+}
+
+func (s *RetentionSweeper) sweep(deleted func(chatID string, messages []model.Message)) *RetentionReport {
+	now := time.Now()
+	report := &RetentionReport{
+		StartedAt: now,
+		Chats:     make(map[string]int64),
+	}
+
+	err := s.sweepExpired(now, report, deleted)
+	if err == nil {
+		err = s.sweepRetained(now, report, deleted)
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	report.FinishedAt = time.Now()
+
+	return report
+}
+
+func (s *RetentionSweeper) sweepExpired(now time.Time, report *RetentionReport, deleted func(chatID string, messages []model.Message)) error {
+	for {
+		messages := []model.Message{}
+		err := s.store.MessageRepo.ListExpired(now, retentionBatchSize, &messages)
+		if err != nil {
+			return err
+		}
+
+		removed, err := s.purge(messages, report, deleted)
+		if err != nil {
+			return err
+		}
+		report.Expired += removed
+
+		if len(messages) < retentionBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *RetentionSweeper) sweepRetained(now time.Time, report *RetentionReport, deleted func(chatID string, messages []model.Message)) error {
+	chats := []model.Chat{}
+	err := s.store.ChatRepo.ListWithRetention(&chats)
+	if err != nil {
+		return err
+	}
+
+	for i := range chats {
+		err = s.sweepCreatedBefore(chats[i].ID, now.Add(-s.effectiveRetention(&chats[i])), report, deleted)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.defaultRetention > 0 {
+		return s.sweepCreatedBefore("", now.Add(-s.defaultRetention), report, deleted)
+	}
+
+	return nil
+}
+
+// sweepCreatedBefore removes the messages of the chat created before date, an empty chat id removes them in all chats
+func (s *RetentionSweeper) sweepCreatedBefore(chatID string, date time.Time, report *RetentionReport, deleted func(chatID string, messages []model.Message)) error {
+	for {
+		messages := []model.Message{}
+		err := s.store.MessageRepo.ListCreatedBefore(chatID, date, retentionBatchSize, &messages)
+		if err != nil {
+			return err
+		}
+
+		removed, err := s.purge(messages, report, deleted)
+		if err != nil {
+			return err
+		}
+		report.Retained += removed
+
+		if len(messages) < retentionBatchSize {
+			return nil
+		}
+	}
+}
+
+// purge removes the messages with their mentions and reports them by chat
+func (s *RetentionSweeper) purge(messages []model.Message, report *RetentionReport, deleted func(chatID string, messages []model.Message)) (int64, error) {
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, len(messages))
+	byChatID := make(map[string][]model.Message)
+	for i := range messages {
+		ids[i] = messages[i].ID
+		byChatID[messages[i].ChatID] = append(byChatID[messages[i].ChatID], messages[i])
+	}
+
+	err := s.store.MessageMentionRepo.DeleteByMessageIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	removed, err := s.store.MessageRepo.DeleteByIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	for chatID, chatMessages := range byChatID {
+		report.Chats[chatID] += int64(len(chatMessages))
+		deleted(chatID, chatMessages)
+	}
+
+	return removed, nil
+}
+
+// broadcastMessagesDeleted sends the message_delete events of the messages removed from the chat
+func (c *apiController) broadcastMessagesDeleted(chatID string, messages []model.Message) {
+	userIDs, err := c.listChatUserIDs(chatID)
+	if err != nil {
+		log.Printf("Failed to list members of chat %s: %+v\n", chatID, err)
+		return
+	}
+
+	for i := range messages {
+		data := &WSMessageData{
+			Type:      WSTypeMessageDelete,
+			MessageID: messages[i].ID,
+			ChatID:    chatID,
+		}
+
+		if len(userIDs) > 0 {
+			c.wsHub.broadcastData(userIDs, data, nil)
+		}
+		c.webhookDispatcher.notify(chatID, WSTypeMessageDelete, data)
+	}
+}
+
+// updateChatRetention changes the message retention and the message TTL of the chat. The TTL applies
+// to the messages created after the change. Only the creator can change them, except in direct chats.
+func (c *apiController) updateChatRetention(w http.ResponseWriter, r *http.Request) {
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(mux.Vars(r)["chatID"], &chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	if chat.DirectUserID == "" && chat.CreatorID != contextUserID(r) {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the chat creator can change the retention")
+		return
+	}
+
+	data := RetentionData{}
+	err = c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Validate retention data
+	{
+		errs := validationErrors{}
+
+		if data.MessageRetention != 0 && !isSecondsInRange(data.MessageRetention, minMessageRetention, maxMessageRetention) {
+			errs.add("messageRetention", FieldErrInvalid, "Message retention must be 0 or from 1 hour to 10 years")
+		}
+
+		if data.MessageTTL != 0 && !isSecondsInRange(data.MessageTTL, minMessageTTL, maxMessageTTL) {
+			errs.add("messageTtl", FieldErrInvalid, "Message TTL must be 0 or from 30 seconds to 1 year")
+		}
+
+		if len(errs) > 0 {
+			c.writeValidationErrorResponse(w, r, errs)
+			return
+		}
+	}
+
+	chat.MessageRetention = data.MessageRetention
+	chat.MessageTTL = data.MessageTTL
+	err = c.store.ChatRepo.UpdateRetention(&chat)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeChatNotFound)
+		return
+	}
+
+	c.broadcastChatChange(&chat, WSTypeChatUpdate)
+
+	c.writeResponse(w, http.StatusOK, chat)
+}
+
+func isSecondsInRange(seconds int64, min, max time.Duration) bool {
+	return seconds >= int64(min/time.Second) && seconds <= int64(max/time.Second)
+}
+
+func (c *apiController) adminGetRetention(w http.ResponseWriter, r *http.Request) {
+	c.writeResponse(w, http.StatusOK, c.retentionSweeper.status())
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+
+	"./model"
+	"github.com/gorilla/mux"
+)
+
+// API version path prefix. Breaking changes in the API must be served under a new prefix.
+const apiV1Prefix = "/api/v1"
+
+func newRouter(api *apiController) *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(api.notFoundHandler)
+	r.MethodNotAllowedHandler = http.HandlerFunc(api.methodNotAllowedHandler)
+
+	v1 := r.PathPrefix(apiV1Prefix).Subrouter()
+	v1.HandleFunc("/openapi.json", api.getOpenAPISpec).Methods(http.MethodGet)
+	v1.HandleFunc("/ws", api.wsHandler).Methods(http.MethodGet)
+
+	v1.HandleFunc("/login", api.login).Methods(http.MethodPost)
+	v1.HandleFunc("/register", api.register).Methods(http.MethodPost)
+
+	v1.HandleFunc("/digest/unsubscribe", api.unsubscribeDigest).Methods(http.MethodGet, http.MethodPost)
+
+	v1.HandleFunc("/hooks/{hookID}/{secret}", api.postIncomingWebhook).Methods(http.MethodPost)
+
+	auth := v1.NewRoute().Subrouter()
+	auth.Use(api.authMiddleware)
+	auth.Use(api.apiTokenScopeMiddleware)
+	auth.HandleFunc("/logout", api.logout).Methods(http.MethodPost)
+	auth.HandleFunc("/ws/ticket", api.createWSTicket).Methods(http.MethodPost)
+	auth.HandleFunc("/users", api.listUsers).Methods(http.MethodGet)
+	auth.HandleFunc("/users/active", api.listActiveUserIDs).Methods(http.MethodGet)
+	auth.HandleFunc("/user/{userID}/avatar", api.getAvatar).Methods(http.MethodGet)
+	auth.HandleFunc("/user/{userID}/avatar", api.uploadAvatar).Methods(http.MethodPost)
+	auth.HandleFunc("/user/{userID}", api.getUser).Methods(http.MethodGet)
+	auth.HandleFunc("/user/{userID}", api.updateUser).Methods(http.MethodPut)
+
+	auth.HandleFunc("/events", api.listEvents).Methods(http.MethodGet)
+	auth.HandleFunc("/mentions", api.listMentions).Methods(http.MethodGet)
+	auth.HandleFunc("/scheduled-messages", api.listScheduledMessages).Methods(http.MethodGet)
+	auth.HandleFunc("/scheduled-message/{scheduledID}", api.deleteScheduledMessage).Methods(http.MethodDelete)
+
+	auth.HandleFunc("/bots", api.listBots).Methods(http.MethodGet)
+	auth.HandleFunc("/bots", api.createBot).Methods(http.MethodPost)
+	auth.HandleFunc("/bot/{botID}", api.updateBot).Methods(http.MethodPut)
+	auth.HandleFunc("/bot/{botID}", api.deleteBot).Methods(http.MethodDelete)
+	auth.HandleFunc("/bot/{botID}/tokens", api.listAPITokens).Methods(http.MethodGet)
+	auth.HandleFunc("/bot/{botID}/tokens", api.createAPIToken).Methods(http.MethodPost)
+	auth.HandleFunc("/bot/{botID}/token/{tokenID}", api.revokeAPIToken).Methods(http.MethodDelete)
+
+	auth.HandleFunc("/commands", api.listBotCommands).Methods(http.MethodGet)
+	auth.HandleFunc("/command/{name}", api.putBotCommand).Methods(http.MethodPut)
+	auth.HandleFunc("/command/{name}", api.deleteBotCommand).Methods(http.MethodDelete)
+
+	auth.HandleFunc("/digest/settings", api.getDigestSettings).Methods(http.MethodGet)
+	auth.HandleFunc("/digest/settings", api.updateDigestSettings).Methods(http.MethodPut)
+
+	auth.HandleFunc("/push/vapid-public-key", api.getVAPIDPublicKey).Methods(http.MethodGet)
+	auth.HandleFunc("/push/subscriptions", api.listPushSubscriptions).Methods(http.MethodGet)
+	auth.HandleFunc("/push/subscriptions", api.createPushSubscription).Methods(http.MethodPost)
+	auth.HandleFunc("/push/subscriptions/{subscriptionID}", api.deletePushSubscription).Methods(http.MethodDelete)
+
+	auth.HandleFunc("/chat", api.createChat).Methods(http.MethodPost)
+	auth.HandleFunc("/chats", api.listChats).Methods(http.MethodGet)
+	auth.HandleFunc("/chats/discover", api.discoverChats).Methods(http.MethodGet)
+	auth.HandleFunc("/dm/{userID}", api.putDirectChat).Methods(http.MethodPut)
+	auth.HandleFunc("/chat/{chatID}/join", api.joinChat).Methods(http.MethodPost)
+	auth.HandleFunc("/invite/{code}", api.getChatInvite).Methods(http.MethodGet)
+	auth.HandleFunc("/invite/{code}", api.redeemChatInvite).Methods(http.MethodPost)
+
+	chat := auth.PathPrefix("/chat/{chatID}").Subrouter()
+	chat.Use(api.chatMemberMiddleware)
+	chat.HandleFunc("", api.getChat).Methods(http.MethodGet)
+	chat.HandleFunc("", api.updateChat).Methods(http.MethodPut)
+	chat.HandleFunc("", api.deleteChat).Methods(http.MethodDelete)
+	chat.HandleFunc("/read", api.markChatRead).Methods(http.MethodPost)
+	chat.HandleFunc("/mute", api.muteChat).Methods(http.MethodPost)
+	chat.HandleFunc("/mute", api.unmuteChat).Methods(http.MethodDelete)
+	chat.HandleFunc("/retention", api.updateChatRetention).Methods(http.MethodPut)
+
+	chat.HandleFunc("/webhook", api.createWebhook).Methods(http.MethodPost)
+	chat.HandleFunc("/webhooks", api.listWebhooks).Methods(http.MethodGet)
+	chat.HandleFunc("/webhook/{webhookID}", api.getWebhook).Methods(http.MethodGet)
+	chat.HandleFunc("/webhook/{webhookID}", api.updateWebhook).Methods(http.MethodPut)
+	chat.HandleFunc("/webhook/{webhookID}", api.deleteWebhook).Methods(http.MethodDelete)
+	chat.HandleFunc("/webhook/{webhookID}/deliveries", api.listWebhookDeliveries).Methods(http.MethodGet)
+	chat.HandleFunc("/webhook/{webhookID}/delivery/{deliveryID}/redeliver", api.redeliverWebhookDelivery).Methods(http.MethodPost)
+
+	chat.HandleFunc("/incoming-webhook", api.createIncomingWebhook).Methods(http.MethodPost)
+	chat.HandleFunc("/incoming-webhooks", api.listIncomingWebhooks).Methods(http.MethodGet)
+	chat.HandleFunc("/incoming-webhook/{webhookID}", api.deleteIncomingWebhook).Methods(http.MethodDelete)
+
+	chat.HandleFunc("/commands", api.getChatCommands).Methods(http.MethodGet)
+
+	chat.HandleFunc("/members", api.listChatMembers).Methods(http.MethodGet)
+	chat.HandleFunc("/member/{userID}", api.putChatMember).Methods(http.MethodPut)
+	chat.HandleFunc("/member/{userID}", api.deleteChatMember).Methods(http.MethodDelete)
+	chat.HandleFunc("/invites", api.listChatInvites).Methods(http.MethodGet)
+	chat.HandleFunc("/invites", api.createChatInvite).Methods(http.MethodPost)
+	chat.HandleFunc("/invite/{inviteID}", api.deleteChatInvite).Methods(http.MethodDelete)
+
+	chat.HandleFunc("/message", api.createMessage).Methods(http.MethodPost)
+	chat.HandleFunc("/messages", api.listMessages).Methods(http.MethodGet)
+	chat.HandleFunc("/export", api.exportChat).Methods(http.MethodGet)
+	chat.HandleFunc("/message/{messageID}", api.getMessage).Methods(http.MethodGet)
+	chat.HandleFunc("/message/{messageID}", api.updateMessage).Methods(http.MethodPut)
+	chat.HandleFunc("/message/{messageID}", api.deleteMessage).Methods(http.MethodDelete)
+
+	admin := auth.PathPrefix("/admin").Subrouter()
+	admin.Use(api.requireRole(model.UserRoleAdmin))
+	admin.HandleFunc("/users", api.adminListUsers).Methods(http.MethodGet)
+	admin.HandleFunc("/user/{userID}", api.adminDeleteUser).Methods(http.MethodDelete)
+	admin.HandleFunc("/user/{userID}/role", api.adminUpdateUserRole).Methods(http.MethodPut)
+	admin.HandleFunc("/user/{userID}/suspend", api.adminSuspendUser).Methods(http.MethodPost)
+	admin.HandleFunc("/user/{userID}/suspend", api.adminUnsuspendUser).Methods(http.MethodDelete)
+	admin.HandleFunc("/user/{userID}/logout", api.adminLogoutUser).Methods(http.MethodPost)
+	admin.HandleFunc("/chat/{chatID}", api.adminGetChat).Methods(http.MethodGet)
+	admin.HandleFunc("/chat/{chatID}/export", api.exportChat).Methods(http.MethodGet)
+	admin.HandleFunc("/stats", api.adminGetStats).Methods(http.MethodGet)
+	admin.HandleFunc("/retention", api.adminGetRetention).Methods(http.MethodGet)
+
+	return r
+}
+
+// Scopes which API tokens need for the routes, keyed by method and path template.
+// Requests authenticated with API tokens can't use the other routes.
+var apiTokenRouteScopes = map[string]string{
+	"POST /ws/ticket":                        model.ScopeChatsRead,
+	"GET /users":                             model.ScopeChatsRead,
+	"GET /users/active":                      model.ScopeChatsRead,
+	"GET /user/{userID}":                     model.ScopeChatsRead,
+	"GET /user/{userID}/avatar":              model.ScopeChatsRead,
+	"GET /events":                            model.ScopeChatsRead,
+	"GET /mentions":                          model.ScopeChatsRead,
+	"GET /chats":                             model.ScopeChatsRead,
+	"GET /chats/discover":                    model.ScopeChatsRead,
+	"GET /invite/{code}":                     model.ScopeChatsRead,
+	"GET /chat/{chatID}":                     model.ScopeChatsRead,
+	"POST /chat/{chatID}/read":               model.ScopeChatsRead,
+	"GET /chat/{chatID}/members":             model.ScopeChatsRead,
+	"GET /chat/{chatID}/invites":             model.ScopeChatsRead,
+	"GET /chat/{chatID}/commands":            model.ScopeChatsRead,
+	"GET /chat/{chatID}/messages":            model.ScopeChatsRead,
+	"GET /chat/{chatID}/export":              model.ScopeChatsRead,
+	"GET /chat/{chatID}/message/{messageID}": model.ScopeChatsRead,
+
+	"POST /chat/{chatID}/message":               model.ScopeMessagesWrite,
+	"PUT /chat/{chatID}/message/{messageID}":    model.ScopeMessagesWrite,
+	"DELETE /chat/{chatID}/message/{messageID}": model.ScopeMessagesWrite,
+	"GET /scheduled-messages":                   model.ScopeMessagesWrite,
+	"DELETE /scheduled-message/{scheduledID}":   model.ScopeMessagesWrite,
+
+	"POST /chat":                              model.ScopeMembersWrite,
+	"PUT /dm/{userID}":                        model.ScopeMembersWrite,
+	"PUT /chat/{chatID}/member/{userID}":      model.ScopeMembersWrite,
+	"DELETE /chat/{chatID}/member/{userID}":   model.ScopeMembersWrite,
+	"POST /chat/{chatID}/join":                model.ScopeMembersWrite,
+	"POST /chat/{chatID}/invites":             model.ScopeMembersWrite,
+	"DELETE /chat/{chatID}/invite/{inviteID}": model.ScopeMembersWrite,
+	"POST /invite/{code}":                     model.ScopeMembersWrite,
+
+	"GET /commands":          model.ScopeCommandsWrite,
+	"PUT /command/{name}":    model.ScopeCommandsWrite,
+	"DELETE /command/{name}": model.ScopeCommandsWrite,
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"./dbcontroller"
+	"./model"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	scheduledMessagePollInterval = time.Second
+	scheduledMessageBatchSize    = 100
+
+	// A claimed message is published by any node if the claiming node didn't publish it within the lease
+	scheduledMessageLease = time.Minute
+
+	// Messages can be scheduled at most that far ahead
+	maxScheduleAhead = 365 * 24 * time.Hour
+
+	minReminderDelay = time.Minute
+)
+
+// The system bot which sends the reminders in its direct chats with the users
+const (
+	reminderBotUsername = "reminders"
+	reminderBotFullName = "Reminders"
+)
+
+// A part of the reminder delay, e.g. 2h, 30 min or 3 days
+var reminderDurationRe = regexp.MustCompile(`(?i)^(\d{1,4})\s*(weeks|week|w|days|day|d|hours|hour|hrs|hr|h|minutes|minute|mins|min|m)`)
+
+// MessageData is the request body of creating messages
+type MessageData struct {
+	model.Message
+
+	// Schedules the message instead of posting it immediately
+	SendAt *time.Time `json:"sendAt"`
+}
+
+// MessageScheduler posts the scheduled messages when they are due. The messages are stored,
+// so the messages which were due while the server was down are posted after it is started.
+type MessageScheduler struct {
+	store *dbcontroller.Store
+}
+
+func newMessageScheduler(store *dbcontroller.Store) *MessageScheduler {
+	return &MessageScheduler{
+		store: store,
+	}
+}
+
+// run publishes the due messages, the messages which failed to publish are retried after the lease
+func (s *MessageScheduler) run(publish func(scheduled *model.ScheduledMessage) error) {
+	ticker := time.NewTicker(scheduledMessagePollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.publishDue(publish)
+	}
+}
+
+func (s *MessageScheduler) publishDue(publish func(scheduled *model.ScheduledMessage) error) {
+	now := time.Now()
+
+	due := []model.ScheduledMessage{}
+	err := s.store.ScheduledMessageRepo.ListDue(now, scheduledMessageBatchSize, &due)
+	if err != nil {
+		log.Printf("Failed to list due scheduled messages: %+v\n", err)
+		return
+	}
+
+	for i := range due {
+		scheduled := &due[i]
+
+		claimed, err := s.store.ScheduledMessageRepo.Claim(scheduled, now, now.Add(scheduledMessageLease))
+		if err != nil {
+			log.Printf("Failed to claim scheduled message %s: %+v\n", scheduled.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = publish(scheduled)
+		if err != nil {
+			log.Printf("Failed to publish scheduled message %s: %+v\n", scheduled.ID, err)
+			continue
+		}
+
+		err = s.store.ScheduledMessageRepo.Delete(scheduled.ID)
+		if err != nil {
+			log.Printf("Failed to remove published scheduled message %s: %+v\n", scheduled.ID, err)
+		}
+	}
+}
+
+// scheduleMessage stores the message of the current user, which is posted at sendAt
+func (c *apiController) scheduleMessage(w http.ResponseWriter, r *http.Request, msg *model.Message, sendAt *time.Time) {
+	scheduled := model.ScheduledMessage{
+		ChatID:    msg.ChatID,
+		UserID:    msg.UserID,
+		CreatorID: msg.UserID,
+		Message:   msg.Message,
+		SendAt:    sendAt,
+	}
+	err := c.store.ScheduledMessageRepo.Create(&scheduled)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeMessageNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusAccepted, scheduled)
+}
+
+// publishScheduledMessage posts the due message the same way as createMessage. Messages of users
+// which were suspended or which are no longer members of the chat are dropped.
+func (c *apiController) publishScheduledMessage(scheduled *model.ScheduledMessage) error {
+	user := model.User{}
+	err := c.store.UserRepo.Get(scheduled.UserID, &user)
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if user.SuspendedAt != nil {
+		log.Printf("Dropping scheduled message %s of suspended user %s\n", scheduled.ID, user.ID)
+		return nil
+	}
+
+	isMember, err := c.store.ChatUserRepo.Exists(scheduled.ChatID, scheduled.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !isMember {
+		log.Printf("Dropping scheduled message %s, user %s is not a member of chat %s\n", scheduled.ID, user.ID, scheduled.ChatID)
+		return nil
+	}
+
+	return c.postMessage(&model.Message{
+		UserID:  scheduled.UserID,
+		ChatID:  scheduled.ChatID,
+		Message: scheduled.Message,
+		Type:    model.MessageTypeText,
+	})
+}
+
+// listScheduledMessages lists the messages and reminders which the current user scheduled, the next one first
+func (c *apiController) listScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	scheduled := []model.ScheduledMessage{}
+	err := c.store.ScheduledMessageRepo.ListByCreatorID(contextUserID(r), &scheduled)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, scheduled)
+}
+
+// deleteScheduledMessage cancels the message or reminder scheduled by the current user
+func (c *apiController) deleteScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	scheduled := model.ScheduledMessage{}
+	err := c.store.ScheduledMessageRepo.Get(mux.Vars(r)["scheduledID"], &scheduled)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	if scheduled.CreatorID != contextUserID(r) {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeNotFound, "Scheduled message is not found")
+		return
+	}
+
+	err = c.store.ScheduledMessageRepo.Delete(scheduled.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// runRemindCommand schedules a message of the reminder bot in its direct chat with the user
+func (c *apiController) runRemindCommand(inv *commandInvocation) (*model.Message, error) {
+	delay, text, ok := parseReminder(inv.args)
+	if !ok {
+		return nil, newCommandUsageError("remind", "me in <time> <text>")
+	}
+
+	if delay < minReminderDelay || delay > maxScheduleAhead {
+		return nil, &commandError{code: ErrCodeInvalidCommand, message: "Reminders can be set from 1 minute to 1 year ahead"}
+	}
+
+	if utf8.RuneCountInString(text) > incomingWebhookMaxTextLen {
+		return nil, &commandError{code: ErrCodeInvalidCommand, message: "Reminder text is too long"}
+	}
+
+	if c.reminderBot == nil {
+		return nil, &commandError{code: ErrCodeInvalidCommand, message: "Reminders are not available"}
+	}
+
+	chat, _, err := c.getOrCreateDirectChat(c.reminderBot.ID, inv.user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sendAt := time.Now().Add(delay)
+	scheduled := model.ScheduledMessage{
+		ChatID:    chat.ID,
+		UserID:    c.reminderBot.ID,
+		CreatorID: inv.user.ID,
+		Message:   "Reminder: " + text,
+		Reminder:  true,
+		SendAt:    &sendAt,
+	}
+	err = c.store.ScheduledMessageRepo.Create(&scheduled)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendEphemeral(inv, "I will remind you at "+sendAt.UTC().Format("2006-01-02 15:04 MST"))
+
+	return nil, nil
+}
+
+// parseReminder reads "me in <time> <text>". The time is a sequence of amounts and units, e.g. 2h, 1h30m or 3 days.
+func parseReminder(args string) (time.Duration, string, bool) {
+	fields := strings.Fields(args)
+	if len(fields) < 3 || strings.ToLower(fields[0]) != "me" || strings.ToLower(fields[1]) != "in" {
+		return 0, "", false
+	}
+
+	rest := strings.TrimSpace(args)
+	rest = strings.TrimSpace(rest[len(fields[0]):])
+	rest = strings.TrimSpace(rest[len(fields[1]):])
+
+	var delay time.Duration
+	parts := 0
+	for {
+		match := reminderDurationRe.FindStringSubmatch(rest)
+		if match == nil {
+			break
+		}
+
+		// The unit must not be a prefix of a word, e.g. "2 months"
+		next := rest[len(match[0]):]
+		if r, _ := utf8.DecodeRuneInString(next); next != "" && unicode.IsLetter(r) {
+			break
+		}
+
+		amount, _ := strconv.Atoi(match[1])
+		delay += time.Duration(amount) * reminderUnit(strings.ToLower(match[2]))
+		parts++
+
+		rest = strings.TrimLeft(next, " ,")
+	}
+
+	text := strings.TrimSpace(rest)
+	if parts == 0 || text == "" {
+		return 0, "", false
+	}
+
+	return delay, text, true
+}
+
+func reminderUnit(unit string) time.Duration {
+	switch unit[0] {
+	case 'w':
+		return 7 * 24 * time.Hour
+	case 'd':
+		return 24 * time.Hour
+	case 'h':
+		return time.Hour
+	}
+
+	return time.Minute
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"./model"
+)
+
+const tokenCacheTTL = time.Second * 30
+
+type tokenCacheEntry struct {
+	token    *model.AccessToken
+	user     *model.User
+	cachedAt time.Time
+}
+
+// TokenCache keeps recently validated access tokens together with their users
+// for a short time, so authenticated requests don't hit the store every time
+type TokenCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]*tokenCacheEntry
+}
+
+func newTokenCache(ttl time.Duration) *TokenCache {
+	return &TokenCache{
+		ttl:     ttl,
+		entries: make(map[string]*tokenCacheEntry),
+	}
+}
+
+func (tc *TokenCache) get(tokenString string) (*model.AccessToken, *model.User, bool) {
+	tc.mu.RLock()
+	entry, ok := tc.entries[tokenString]
+	tc.mu.RUnlock()
+
+	if !ok {
+		return nil, nil, false
+	}
+
+	if time.Since(entry.cachedAt) > tc.ttl || !entry.token.IsValid() {
+		tc.delete(tokenString)
+		return nil, nil, false
+	}
+
+	return entry.token, entry.user, true
+}
+
+func (tc *TokenCache) set(token *model.AccessToken, user *model.User) {
+	tc.mu.Lock()
+	tc.entries[token.Token] = &tokenCacheEntry{
+		token:    token,
+		user:     user,
+		cachedAt: time.Now(),
+	}
+	tc.mu.Unlock()
+}
+
+// run drops the stale entries periodically, so the requests don't wait for the sweeps
+func (tc *TokenCache) run() {
+	ticker := time.NewTicker(tc.ttl)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		tc.deleteStale()
+	}
+}
+
+func (tc *TokenCache) deleteStale() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range tc.entries {
+		if now.Sub(entry.cachedAt) > tc.ttl {
+			delete(tc.entries, key)
+		}
+	}
+}
+
+func (tc *TokenCache) delete(tokenString string) {
+	tc.mu.Lock()
+	delete(tc.entries, tokenString)
+	tc.mu.Unlock()
+}
+
+func (tc *TokenCache) deleteByUserID(userID string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	for key, entry := range tc.entries {
+		if entry.token.UserID == userID {
+			delete(tc.entries, key)
+		}
+	}
+}
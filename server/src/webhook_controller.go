@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"./model"
+	"github.com/gorilla/mux"
+)
+
+// WebhookData is the request body of creating and updating webhooks
+type WebhookData struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+
+	// Generated when a webhook is created without it. Updates keep the current secret when it is empty.
+	Secret string `json:"secret"`
+
+	// Defaults to true
+	Active *bool `json:"active"`
+}
+
+func (c *apiController) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	webhooks := []model.Webhook{}
+	err := c.store.WebhookRepo.ListByChatID(vars["chatID"], &webhooks)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	c.writeResponse(w, http.StatusOK, webhooks)
+}
+
+func (c *apiController) createWebhook(w http.ResponseWriter, r *http.Request) {
+	data := WebhookData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	errs := validateWebhookData(&data, c.webhookDispatcher.allowPrivateNetworks)
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
+		return
+	}
+
+	if data.Secret == "" {
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		if err != nil {
+			c.writeErrorResponse(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate webhook secret")
+			return
+		}
+		data.Secret = hex.EncodeToString(secret)
+	}
+
+	webhook := model.Webhook{
+		ChatID:    mux.Vars(r)["chatID"],
+		CreatorID: contextUserID(r),
+		URL:       data.URL,
+		Secret:    data.Secret,
+		Events:    data.Events,
+		Active:    data.Active == nil || *data.Active,
+	}
+	err = c.store.WebhookRepo.Create(&webhook)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusCreated, webhook)
+}
+
+func (c *apiController) getWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := c.loadChatWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	webhook.Secret = ""
+
+	c.writeResponse(w, http.StatusOK, webhook)
+}
+
+func (c *apiController) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := c.loadChatWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if !c.canManageWebhook(r, webhook) {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the webhook creator or the chat creator can update the webhook")
+		return
+	}
+
+	data := WebhookData{}
+	err := c.readData(r.Body, &data)
+	if err != nil {
+		c.writeErrorResponse(w, r, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	errs := validateWebhookData(&data, c.webhookDispatcher.allowPrivateNetworks)
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
+		return
+	}
+
+	webhook.URL = data.URL
+	webhook.Events = data.Events
+	webhook.Secret = data.Secret
+	webhook.Active = data.Active == nil || *data.Active
+
+	err = c.store.WebhookRepo.Update(webhook)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	webhook.Secret = ""
+
+	c.writeResponse(w, http.StatusOK, webhook)
+}
+
+func (c *apiController) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := c.loadChatWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if !c.canManageWebhook(r, webhook) {
+		c.writeErrorResponse(w, r, http.StatusForbidden, ErrCodeForbidden, "Only the webhook creator or the chat creator can delete the webhook")
+		return
+	}
+
+	err := c.store.WebhookRepo.Delete(webhook.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// listWebhookDeliveries lists the delivery history, status=dead lists the dead-letter log
+func (c *apiController) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := c.loadChatWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset, errs := parsePagination(r)
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", model.WebhookDeliveryPending, model.WebhookDeliveryDelivered, model.WebhookDeliveryDead:
+	default:
+		errs.add("status", FieldErrInvalid, "Status must be one of pending, delivered, dead")
+	}
+
+	if len(errs) > 0 {
+		c.writeValidationErrorResponse(w, r, errs)
+		return
+	}
+
+	deliveries := []model.WebhookDelivery{}
+	err := c.store.WebhookDeliveryRepo.ListByWebhookID(webhook.ID, status, limit, offset, &deliveries)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusOK, deliveries)
+}
+
+// redeliverWebhookDelivery schedules a new series of attempts of the delivery, e.g. from the dead-letter log
+func (c *apiController) redeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := c.loadChatWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	delivery := model.WebhookDelivery{}
+	err := c.store.WebhookDeliveryRepo.Get(mux.Vars(r)["deliveryID"], &delivery)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	if delivery.WebhookID != webhook.ID {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeNotFound, "Webhook delivery is not found")
+		return
+	}
+
+	err = c.store.WebhookDeliveryRepo.Retry(delivery.ID)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.webhookDispatcher.wakeUp()
+
+	c.writeResponse(w, http.StatusNoContent, nil)
+}
+
+// loadChatWebhook reads the webhook of the URL and checks that it belongs to the chat of the URL
+func (c *apiController) loadChatWebhook(w http.ResponseWriter, r *http.Request) (*model.Webhook, bool) {
+	vars := mux.Vars(r)
+
+	webhook := model.Webhook{}
+	err := c.store.WebhookRepo.Get(vars["webhookID"], &webhook)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return nil, false
+	}
+
+	if webhook.ChatID != vars["chatID"] {
+		c.writeErrorResponse(w, r, http.StatusNotFound, ErrCodeNotFound, "Webhook is not found")
+		return nil, false
+	}
+
+	return &webhook, true
+}
+
+func (c *apiController) canManageWebhook(r *http.Request, webhook *model.Webhook) bool {
+	currentUserID := contextUserID(r)
+	if webhook.CreatorID == currentUserID {
+		return true
+	}
+
+	chat := model.Chat{}
+	err := c.store.ChatRepo.Get(webhook.ChatID, &chat)
+
+	return err == nil && chat.CreatorID == currentUserID
+}
+
+func validateWebhookData(data *WebhookData, allowPrivateNetworks bool) validationErrors {
+	errs := validationErrors{}
+
+	target, err := url.Parse(data.URL)
+	if data.URL == "" {
+		errs.add("url", FieldErrRequired, "URL is required")
+	} else if len(data.URL) > 2048 {
+		errs.add("url", FieldErrTooLong, "URL must be at most 2048 characters long")
+	} else if err != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") {
+		errs.add("url", FieldErrInvalid, "URL must be an http or https URL")
+	} else if !allowPrivateNetworks && checkPublicHost(target.Hostname()) != nil {
+		errs.add("url", FieldErrInvalid, "URL host must resolve to a public address")
+	}
+
+	if len(data.Secret) > 128 {
+		errs.add("secret", FieldErrTooLong, "Secret must be at most 128 characters long")
+	}
+
+	if len(data.Events) == 0 {
+		errs.add("events", FieldErrRequired, "At least one event type is required")
+	}
+
+	seen := make(map[string]bool)
+	for _, event := range data.Events {
+		valid := false
+		for _, eventType := range webhookEventTypes {
+			if event == eventType {
+				valid = true
+			}
+		}
+
+		if !valid || seen[event] {
+			errs.add("events", FieldErrInvalid, "Event types must be distinct values of "+strings.Join(webhookEventTypes, ", "))
+			break
+		}
+		seen[event] = true
+	}
+
+	return errs
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"./dbcontroller"
+	"./model"
+)
+
+const (
+	webhookPollInterval = time.Second
+	webhookTimeout      = 10 * time.Second
+
+	// Attempts are retried after 10s, 20s, 40s, ... about 21 minutes in total
+	webhookMaxAttempts    = 8
+	webhookRetryBaseDelay = 10 * time.Second
+
+	// A claimed delivery is retried by any node if the claiming node didn't finish the attempt within the lease
+	webhookLease = webhookTimeout + time.Minute
+
+	// Successful deliveries are removed from the history after the retention, dead deliveries are kept
+	webhookDeliveryRetention = 7 * 24 * time.Hour
+	webhookSweepInterval     = time.Hour
+
+	webhookQueueSize    = 1000
+	webhookWorkers      = 10
+	webhookBatchSize    = 100
+	webhookMaxErrorSize = 1024
+)
+
+// Headers of the webhook requests
+const (
+	webhookHeaderEvent     = "X-ChatApp-Event"
+	webhookHeaderDelivery  = "X-ChatApp-Delivery"
+	webhookHeaderTimestamp = "X-ChatApp-Timestamp"
+	webhookHeaderSignature = "X-ChatApp-Signature"
+)
+
+// Event types which webhooks can subscribe to
+var webhookEventTypes = []string{
+	WSTypeMessageCreate,
+	WSTypeMessageUpdate,
+	WSTypeMessageDelete,
+	WSTypeChatUpdate,
+}
+
+// WebhookPayload is the body of the webhook requests. Data is the WebSocket event with the changed entity.
+type WebhookPayload struct {
+	Type      string      `json:"type"`
+	ChatID    string      `json:"chatId"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+type webhookEvent struct {
+	chatID    string
+	eventType string
+	data      interface{}
+}
+
+// WebhookDispatcher sends the events of the chats to their webhooks. The deliveries are stored,
+// so the attempts are retried with exponential backoff also after the server is restarted.
+type WebhookDispatcher struct {
+	store  *dbcontroller.Store
+	client *http.Client
+
+	// Webhooks can be delivered to loopback and private network addresses, e.g. for development
+	allowPrivateNetworks bool
+
+	events  chan *webhookEvent
+	wake    chan struct{}
+	workers chan struct{}
+}
+
+func newWebhookDispatcher(store *dbcontroller.Store, allowPrivateNetworks bool) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store: store,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			Transport: &http.Transport{
+				// Proxies from the environment would dial the addresses instead of the dialer
+				Proxy:                 nil,
+				DialContext:           newPublicDialer(webhookTimeout, allowPrivateNetworks).DialContext,
+				TLSHandshakeTimeout:   webhookTimeout,
+				ResponseHeaderTimeout: webhookTimeout,
+				MaxIdleConns:          webhookWorkers,
+				IdleConnTimeout:       30 * time.Second,
+			},
+			// Redirects are reported as failed attempts
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		allowPrivateNetworks: allowPrivateNetworks,
+		events:               make(chan *webhookEvent, webhookQueueSize),
+		wake:                 make(chan struct{}, 1),
+		workers:              make(chan struct{}, webhookWorkers),
+	}
+}
+
+// notify queues the event for the webhooks of the chat without blocking the caller
+func (d *WebhookDispatcher) notify(chatID, eventType string, data interface{}) {
+	select {
+	case d.events <- &webhookEvent{chatID: chatID, eventType: eventType, data: data}:
+	default:
+		log.Printf("Webhook queue is full, dropping %s event of chat %s\n", eventType, chatID)
+	}
+}
+
+func (d *WebhookDispatcher) run() {
+	go d.runEnqueue()
+	go d.runSweeper()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		}
+
+		d.deliverDue()
+	}
+}
+
+// runEnqueue stores a delivery for every webhook subscribed to the queued events
+func (d *WebhookDispatcher) runEnqueue() {
+	for event := range d.events {
+		err := d.enqueue(event)
+		if err != nil {
+			log.Printf("Failed to enqueue webhook deliveries of %s event of chat %s: %+v\n", event.eventType, event.chatID, err)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) enqueue(event *webhookEvent) error {
+	webhooks := []model.Webhook{}
+	err := d.store.WebhookRepo.ListSubscribed(event.chatID, event.eventType, &webhooks)
+	if err != nil {
+		return err
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(&WebhookPayload{
+		Type:      event.eventType,
+		ChatID:    event.chatID,
+		CreatedAt: time.Now().UTC(),
+		Data:      event.data,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range webhooks {
+		err = d.store.WebhookDeliveryRepo.Create(&model.WebhookDelivery{
+			WebhookID: webhooks[i].ID,
+			EventType: event.eventType,
+			Payload:   string(payload),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	d.wakeUp()
+
+	return nil
+}
+
+func (d *WebhookDispatcher) wakeUp() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue attempts the pending deliveries which are due and claimed by this node
+func (d *WebhookDispatcher) deliverDue() {
+	now := time.Now()
+
+	deliveries := []model.WebhookDelivery{}
+	err := d.store.WebhookDeliveryRepo.ListDue(now, webhookBatchSize, &deliveries)
+	if err != nil {
+		log.Printf("Failed to list due webhook deliveries: %+v\n", err)
+		return
+	}
+
+	for i := range deliveries {
+		delivery := deliveries[i]
+
+		claimed, err := d.store.WebhookDeliveryRepo.Claim(&delivery, now.Add(webhookLease))
+		if err != nil {
+			log.Printf("Failed to claim webhook delivery %s: %+v\n", delivery.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		d.workers <- struct{}{}
+		go func() {
+			defer func() { <-d.workers }()
+			d.attempt(&delivery)
+		}()
+	}
+}
+
+// attempt sends the delivery and stores the result, scheduling the next attempt on failure
+func (d *WebhookDispatcher) attempt(delivery *model.WebhookDelivery) {
+	webhook := model.Webhook{}
+	err := d.store.WebhookRepo.Get(delivery.WebhookID, &webhook)
+	if err != nil {
+		log.Printf("Failed to load webhook %s: %+v\n", delivery.WebhookID, err)
+		return
+	}
+
+	delivery.Attempts++
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+
+	if webhook.Active {
+		delivery.ResponseStatus, err = d.send(&webhook, delivery)
+	} else {
+		err = fmt.Errorf("Webhook is not active")
+		delivery.Attempts = webhookMaxAttempts
+	}
+
+	now := time.Now()
+	if err == nil {
+		delivery.Status = model.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	} else {
+		delivery.Error = truncate(err.Error(), webhookMaxErrorSize)
+
+		if delivery.Attempts >= webhookMaxAttempts {
+			delivery.Status = model.WebhookDeliveryDead
+			delivery.NextAttemptAt = nil
+			log.Printf("Webhook delivery %s to %s failed %d times: %+v\n", delivery.ID, webhook.ID, delivery.Attempts, err)
+		} else {
+			next := now.Add(webhookRetryBaseDelay << uint(delivery.Attempts-1))
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	err = d.store.WebhookDeliveryRepo.SaveAttempt(delivery)
+	if err != nil {
+		log.Printf("Failed to save webhook delivery %s: %+v\n", delivery.ID, err)
+	}
+}
+
+// send posts the signed payload and returns the response status
+func (d *WebhookDispatcher) send(webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ChatApp-Webhook/"+serverVersion)
+	req.Header.Set(webhookHeaderEvent, delivery.EventType)
+	req.Header.Set(webhookHeaderDelivery, delivery.ID)
+	req.Header.Set(webhookHeaderTimestamp, timestamp)
+	req.Header.Set(webhookHeaderSignature, "sha256="+signWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// The response is not used, but reading it allows reusing the connection
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Webhook responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (d *WebhookDispatcher) runSweeper() {
+	for {
+		removed, err := d.store.WebhookDeliveryRepo.DeleteDeliveredBefore(time.Now().Add(-webhookDeliveryRetention))
+		if err != nil {
+			log.Printf("Failed to remove webhook delivery history: %+v\n", err)
+		} else if removed > 0 {
+			log.Printf("Removed %d webhook deliveries from the history\n", removed)
+		}
+
+		time.Sleep(webhookSweepInterval)
+	}
+}
+
+// signWebhookPayload computes the hex encoded HMAC-SHA256 of "<timestamp>.<payload>". Receivers
+// should verify it and reject old timestamps, so captured requests can't be replayed.
+func signWebhookPayload(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
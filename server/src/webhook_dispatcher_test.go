@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"./model"
+)
+
+func TestValidateWebhookDataBlockedHosts(t *testing.T) {
+	tests := []struct {
+		url                  string
+		allowPrivateNetworks bool
+		valid                bool
+	}{
+		{"https://93.184.216.34/hook", false, true},
+		{"http://127.0.0.1:8080/hook", false, false},
+		{"http://localhost/hook", false, false},
+		{"http://[::1]/hook", false, false},
+		{"http://169.254.169.254/latest/meta-data", false, false},
+		{"http://10.0.0.1/hook", false, false},
+		{"http://127.0.0.1:8080/hook", true, true},
+	}
+
+	for _, test := range tests {
+		data := WebhookData{URL: test.url, Events: []string{WSTypeMessageCreate}}
+		errs := validateWebhookData(&data, test.allowPrivateNetworks)
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("%s with private networks allowed %v: got valid %v, want %v: %v", test.url, test.allowPrivateNetworks, valid, test.valid, errs)
+		}
+	}
+}
+
+func TestWebhookDispatcherBlockedAddress(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook := &model.Webhook{URL: server.URL + "/hook", Secret: "secret"}
+	delivery := &model.WebhookDelivery{ID: "delivery", EventType: WSTypeMessageCreate, Payload: "{}"}
+
+	// Webhooks saved before their host started resolving to a private address are rejected when they are dialed
+	_, err := newWebhookDispatcher(nil, false).send(webhook, delivery)
+	if err == nil || !strings.Contains(err.Error(), errLinkPreviewForbiddenAddress.Error()) {
+		t.Errorf("Delivery to a loopback address returned %v, want %v", err, errLinkPreviewForbiddenAddress)
+	}
+	if requests != 0 {
+		t.Errorf("Blocked webhook received %d requests", requests)
+	}
+
+	status, err := newWebhookDispatcher(nil, true).send(webhook, delivery)
+	if err != nil || status != http.StatusOK {
+		t.Errorf("Delivery with private networks allowed returned %d, %v", status, err)
+	}
+}
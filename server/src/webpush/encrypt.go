@@ -0,0 +1,117 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Record size of the encrypted content. The payload must fit into a single record.
+const recordSize = 4096
+
+// MaxPayloadSize is the maximum size of the plaintext payload
+const MaxPayloadSize = recordSize - headerSize - 16 - 1
+
+// salt(16) + record size(4) + key id length(1) + key id(65)
+const headerSize = 16 + 4 + 1 + 65
+
+// encrypt encrypts the payload for the subscription with the aes128gcm content encoding (RFC 8291)
+func encrypt(sub *Subscription, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("webpush: payload is too large")
+	}
+
+	uaPublic, err := decodeBase64(sub.P256dh)
+	if err != nil {
+		return nil, err
+	}
+
+	authSecret, err := decodeBase64(sub.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	curve := elliptic.P256()
+	uaX, uaY := elliptic.Unmarshal(curve, uaPublic)
+	if uaX == nil {
+		return nil, fmt.Errorf("webpush: invalid subscription public key")
+	}
+
+	asPrivate, _, _, err := elliptic.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptWithKey(uaX, uaY, uaPublic, authSecret, asPrivate, salt, payload)
+}
+
+// encryptWithKey encrypts the payload with the given application server private key and salt
+func encryptWithKey(uaX, uaY *big.Int, uaPublic, authSecret, asPrivate, salt, payload []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	asX, asY := curve.ScalarBaseMult(asPrivate)
+	asPublic := elliptic.Marshal(curve, asX, asY)
+
+	sharedX, _ := curve.ScalarMult(uaX, uaY, asPrivate)
+	ecdhSecret := padLeft(sharedX.Bytes(), 32)
+
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public, 32)
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm, err := hkdfExpand(hkdf.New(sha256.New, ecdhSecret, authSecret, keyInfo), 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek, err := hkdfExpand(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), 16)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hkdfExpand(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// 0x02 marks the last record, no further padding is added
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	header := make([]byte, headerSize)
+	copy(header, salt)
+	binary.BigEndian.PutUint32(header[16:], recordSize)
+	header[20] = byte(len(asPublic))
+	copy(header[21:], asPublic)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+func hkdfExpand(r io.Reader, size int) ([]byte, error) {
+	result := make([]byte, size)
+	_, err := io.ReadFull(r, result)
+
+	return result, err
+}
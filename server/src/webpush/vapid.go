@@ -0,0 +1,124 @@
+package webpush
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// VAPIDKeys identify the application server to the push services (RFC 8292)
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+}
+
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VAPIDKeys{private: private}, nil
+}
+
+// ParseVAPIDKeys reads the base64url encoded P-256 private key
+func ParseVAPIDKeys(privateKey string) (*VAPIDKeys, error) {
+	d, err := decodeBase64(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d) != 32 {
+		return nil, fmt.Errorf("webpush: VAPID private key must be 32 bytes long")
+	}
+
+	curve := elliptic.P256()
+	private := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(d)
+
+	return &VAPIDKeys{private: private}, nil
+}
+
+// PublicKey returns the base64url encoded uncompressed public key,
+// passed to the browsers as applicationServerKey
+func (k *VAPIDKeys) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), k.private.X, k.private.Y))
+}
+
+// PrivateKey returns the base64url encoded private key
+func (k *VAPIDKeys) PrivateKey() string {
+	return base64.RawURLEncoding.EncodeToString(padLeft(k.private.D.Bytes(), 32))
+}
+
+// authorization returns the Authorization header value for requests to the endpoint
+func (k *VAPIDKeys) authorization(endpoint, subject string, expiresAt time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{
+		"typ": "JWT",
+		"alg": "ES256",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": expiresAt.Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	signature := append(padLeft(r.Bytes(), 32), padLeft(s.Bytes(), 32)...)
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	return "vapid t=" + token + ", k=" + k.PublicKey(), nil
+}
+
+func padLeft(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	result := make([]byte, size)
+	copy(result[size-len(b):], b)
+
+	return result
+}
+
+// decodeBase64 accepts both padded and unpadded, standard and URL safe base64,
+// since browsers and libraries encode the subscription keys differently
+func decodeBase64(value string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{
+		base64.RawURLEncoding,
+		base64.URLEncoding,
+		base64.RawStdEncoding,
+		base64.StdEncoding,
+	} {
+		if result, err := encoding.DecodeString(value); err == nil {
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("webpush: invalid base64 value")
+}
@@ -0,0 +1,148 @@
+// Package webpush sends Web Push messages (RFC 8030) encrypted with the
+// aes128gcm content encoding (RFC 8291) and authorized with VAPID (RFC 8292).
+package webpush
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Lifetime of the VAPID authorization tokens, at most 24 hours are allowed
+const vapidTokenTTL = 12 * time.Hour
+
+// Subscription is the PushSubscription of a browser
+type Subscription struct {
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// Validate checks the keys of the subscription
+func (sub *Subscription) Validate() error {
+	uaPublic, err := decodeBase64(sub.P256dh)
+	if err != nil {
+		return fmt.Errorf("webpush: p256dh is not valid base64")
+	}
+
+	x, _ := elliptic.Unmarshal(elliptic.P256(), uaPublic)
+	if x == nil {
+		return fmt.Errorf("webpush: p256dh is not a valid P-256 public key")
+	}
+
+	authSecret, err := decodeBase64(sub.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return fmt.Errorf("webpush: auth must be 16 bytes long")
+	}
+
+	return nil
+}
+
+// Options of a single push message
+type Options struct {
+	// Seconds for which the push service keeps the message if the device is offline
+	TTL int
+
+	// Pending messages with the same topic are replaced by the push service
+	Topic string
+
+	// One of very-low, low, normal and high
+	Urgency string
+}
+
+// SendError is returned when the push service rejects the message
+type SendError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("webpush: push service responded with %d: %s", e.StatusCode, e.Body)
+}
+
+// Gone reports whether the subscription expired or was unsubscribed and must be removed
+func (e *SendError) Gone() bool {
+	return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+}
+
+// Temporary reports whether sending the message can be retried
+func (e *SendError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+type Sender struct {
+	keys    *VAPIDKeys
+	subject string
+	client  *http.Client
+}
+
+// NewSender creates a sender which identifies itself with the keys and the contact
+// subject, a mailto: or https: URL
+func NewSender(keys *VAPIDKeys, subject string, client *http.Client) *Sender {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Sender{
+		keys:    keys,
+		subject: subject,
+		client:  client,
+	}
+}
+
+// Send encrypts the payload and delivers it to the push service of the subscription.
+// Rejections of the push service are returned as *SendError.
+func (s *Sender) Send(sub *Subscription, payload []byte, opts *Options) error {
+	body, err := encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := s.keys.authorization(sub.Endpoint, s.subject, time.Now().Add(vapidTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(opts.TTL))
+	if opts.Topic != "" {
+		req.Header.Set("Topic", opts.Topic)
+	}
+	if opts.Urgency != "" {
+		req.Header.Set("Urgency", opts.Urgency)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return &SendError{
+		StatusCode: resp.StatusCode,
+		Body:       string(respBody),
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"./model"
+)
+
+// Cookie which carries the access token. It is accepted only by the WebSocket
+// handler, where the origin of the request is validated.
+const accessTokenCookie = "chatapp_access_token"
+
+type WSTicket struct {
+	Ticket    string     `json:"ticket"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// createWSTicket issues a single-use ticket which authenticates the next WebSocket
+// connection of the user, so the access token doesn't have to be sent in the URL or headers
+func (c *apiController) createWSTicket(w http.ResponseWriter, r *http.Request) {
+	ticket := model.WSTicket{
+		UserID:      contextUserID(r),
+		AccessToken: contextToken(r).Token,
+	}
+
+	err := c.store.WSTicketRepo.Create(&ticket)
+	if err != nil {
+		c.writeStoreErrorResponse(w, r, err, ErrCodeNotFound)
+		return
+	}
+
+	c.writeResponse(w, http.StatusCreated, &WSTicket{
+		Ticket:    ticket.Ticket,
+		ExpiresAt: ticket.ExpiresAt,
+	})
+}
+
+// authenticateWSRequest authenticates the WebSocket request with a ticket, an access token
+// offered as a subprotocol, the Authorization header or the access token cookie, in this order
+func (c *apiController) authenticateWSRequest(r *http.Request, protocolToken string) (*model.AccessToken, *model.User, error) {
+	if value := r.URL.Query().Get("ticket"); value != "" {
+		ticket := model.WSTicket{}
+		err := c.store.WSTicketRepo.Consume(value, &ticket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("WebSocket ticket is invalid or expired")
+		}
+
+		return c.validateAccessToken(ticket.AccessToken)
+	}
+
+	if protocolToken != "" {
+		return c.validateAccessToken(protocolToken)
+	}
+
+	// Bots and other non-browser clients can send the Authorization header
+	if header := r.Header.Get("Authorization"); header != "" {
+		return c.authenticateRequest(r)
+	}
+
+	if cookie, err := r.Cookie(accessTokenCookie); err == nil {
+		// Browsers send cookies with cross-site WebSocket requests, so the origin must be trusted explicitly
+		if !c.isTrustedOrigin(r) {
+			return nil, nil, fmt.Errorf("Cookie authentication is not allowed from this origin")
+		}
+
+		return c.validateAccessToken(cookie.Value)
+	}
+
+	return nil, nil, fmt.Errorf("Access token is missing")
+}
+
+// checkOrigin validates the origin of WebSocket requests against the CORS allowlist.
+// Requests without origin don't come from browsers and are allowed.
+func checkOrigin(allowedOrigins []string, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return isSameOrigin(r)
+}
+
+// isTrustedOrigin reports whether the request comes from the server's own origin or
+// from an origin listed explicitly in the CORS allowlist
+func (c *apiController) isTrustedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	for _, allowed := range c.allowedOrigins {
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return isSameOrigin(r)
+}
+
+func isSameOrigin(r *http.Request) bool {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(origin.Host, r.Host)
+}
+
+// setAccessTokenCookie stores the access token in an HTTP only cookie used for WebSocket authentication
+func setAccessTokenCookie(w http.ResponseWriter, r *http.Request, token *model.AccessToken) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    token.Token,
+		Path:     apiV1Prefix,
+		Expires:  *token.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearAccessTokenCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    "",
+		Path:     apiV1Prefix,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
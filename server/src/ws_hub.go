@@ -2,12 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"./broker"
+	"./dbcontroller"
 	"./model"
 )
 
@@ -18,169 +23,350 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = 2 * time.Second
 
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 3 * pingPeriod
+
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
 )
 
-var (
-	newline = []byte{'\n'}
-	space   = []byte{' '}
-)
-
-type BroadcastData struct {
-	BroadcastToAll bool
-	UserIDs []string
-	Data    []byte
+// wsFrame is a single event queued for sending to a client
+type wsFrame struct {
+	seq  int64
+	data []byte
 }
 
 type WSHub struct {
 	clients map[string][]*WsClient
 
-	broadcast chan *BroadcastData
+	// Number of open connections on this node, accessed atomically
+	connections int64
+
+	broadcast chan *broker.BroadcastData
 
 	register   chan *WsClient
 	unregister chan *WsClient
 
+	// Presence changes which are not reported to the broker yet, by user id. The hub never waits
+	// for the reports, so the changes of a user are coalesced to the latest one.
+	presenceMu      sync.Mutex
+	pendingPresence map[string]bool
+	presenceChanged chan struct{}
+
+	broker   broker.Broker
+	events   *dbcontroller.EventRepo
 	upgrader *websocket.Upgrader
+
+	// Serializes storing and publishing of the events, so concurrent handlers of this node publish them
+	// in the order of their sequence numbers. Events of the other nodes may still arrive out of order.
+	publishMu sync.Mutex
+
+	// Cache of the access tokens of this node, revocations on any node are applied to it
+	tokenCache *TokenCache
 }
 
-func newWsHub() *WSHub {
+func newWsHub(b broker.Broker, events *dbcontroller.EventRepo, tokenCache *TokenCache, allowedOrigins []string) *WSHub {
 	upgrader := &websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		Subprotocols:    []string{"access_token"},
 		CheckOrigin: func(r *http.Request) bool {
-			// Origin is checked by CORS middleware
-			return true
+			// CORS doesn't apply to WebSocket requests
+			return checkOrigin(allowedOrigins, r)
 		},
 	}
 
 	return &WSHub{
-		broadcast:  make(chan *BroadcastData, 1000),
-		register:   make(chan *WsClient, 100),
-		unregister: make(chan *WsClient, 100),
-		clients:    make(map[string][]*WsClient),
-		upgrader:   upgrader,
+		broadcast:       make(chan *broker.BroadcastData, 1000),
+		register:        make(chan *WsClient, 100),
+		unregister:      make(chan *WsClient, 100),
+		pendingPresence: make(map[string]bool),
+		presenceChanged: make(chan struct{}, 1),
+		clients:         make(map[string][]*WsClient),
+		broker:          b,
+		events:          events,
+		upgrader:        upgrader,
+		tokenCache:      tokenCache,
 	}
 }
 
 func (h *WSHub) run() {
+	// Events published by any node, including this one, are delivered to the local clients
+	err := h.broker.Subscribe(func(data *broker.BroadcastData) {
+		h.broadcast <- data
+	})
+	if err != nil {
+		log.Printf("Failed to subscribe to the broker: %+v\n", err)
+	}
+
+	go h.runPresence()
+
 	for {
 		select {
 		case client := <-h.register:
-			log.Printf("%+v\n", len(h.clients[client.userID]))
-			prevLen := 0
-			if _, ok := h.clients[client.userID]; !ok {
-				h.clients[client.userID] = []*WsClient{client}
-			} else {
-				prevLen = len(h.clients[client.userID])
-				h.clients[client.userID] = append(h.clients[client.userID], client)
-			}
+			prevLen := len(h.clients[client.userID])
+			h.clients[client.userID] = append(h.clients[client.userID], client)
+			atomic.AddInt64(&h.connections, 1)
 
 			if prevLen == 0 {
-				h.broadcastDataToAll(map[string]string{
-					"type": WSTypeUserStatusChange,
-				})
+				h.setOnline(client.userID, true)
 			}
 
-			client.send <- []byte("connected:" + client.userID)
+			client.send <- &wsFrame{data: client.hello}
 		case client := <-h.unregister:
-			if _, ok := h.clients[client.userID]; ok {
-				prevLen := len(h.clients[client.userID])
-				for i := range h.clients[client.userID] {
-					if h.clients[client.userID][i] == client {
-						h.clients[client.userID] = append(h.clients[client.userID][:i], h.clients[client.userID][i+1:]...)
-						break
-					}
-				}
-
-				if prevLen > 0 && len(h.clients[client.userID]) == 0 {
-					h.broadcastDataToAll(map[string]string{
-						"type": WSTypeUserStatusChange,
-					})
+			for i := range h.clients[client.userID] {
+				if h.clients[client.userID][i] == client {
+					// The send channel is already closed if the client was dropped
+					// by a broadcast or a forced disconnect
+					h.removeClient(client.userID, i)
+					break
 				}
-
-				close(client.send)
 			}
 		case data := <-h.broadcast:
-			if data.BroadcastToAll {
-				for userID := range h.clients {
+			if data.InvalidateTokens {
+				for _, userID := range data.UserIDs {
+					h.tokenCache.deleteByUserID(userID)
+				}
+			} else if data.Disconnect {
+				for _, userID := range data.UserIDs {
 					for i := len(h.clients[userID]) - 1; i >= 0; i-- {
-						select {
-						case h.clients[userID][i].send <- data.Data:
-						default:
-							close(h.clients[userID][i].send)
-							h.clients[userID] = append(h.clients[userID][:i], h.clients[userID][i+1:]...)
-						}
+						h.removeClient(userID, i)
 					}
 				}
+			} else if data.BroadcastToAll {
+				for userID := range h.clients {
+					h.sendToUser(userID, data)
+				}
 			} else {
 				for _, userID := range data.UserIDs {
-					if _, ok := h.clients[userID]; ok {
-						for i := len(h.clients[userID]) - 1; i >= 0; i-- {
-							select {
-							case h.clients[userID][i].send <- data.Data:
-							default:
-								close(h.clients[userID][i].send)
-								h.clients[userID] = append(h.clients[userID][:i], h.clients[userID][i+1:]...)
-							}
-						}
-					}
+					h.sendToUser(userID, data)
 				}
 			}
 		}
 	}
 }
 
-func (h *WSHub) listActiveUserIDs() []string {
-	result := []string{}
-	for userID := range h.clients {
-		if len(h.clients[userID]) > 0 {
-			result = append(result, userID)
+// sendToUser queues the data to all clients of the user and drops the clients which are too slow
+func (h *WSHub) sendToUser(userID string, data *broker.BroadcastData) {
+	frame := &wsFrame{
+		seq:  data.Seq,
+		data: data.Data,
+	}
+
+	fullFrame := frame
+	if len(data.FullData) > 0 {
+		fullFrame = &wsFrame{
+			seq:  data.Seq,
+			data: data.FullData,
+		}
+	}
+
+	for i := len(h.clients[userID]) - 1; i >= 0; i-- {
+		clientFrame := frame
+		if h.clients[userID][i].fullPayload {
+			clientFrame = fullFrame
+		}
+
+		select {
+		case h.clients[userID][i].send <- clientFrame:
+		default:
+			h.removeClient(userID, i)
 		}
 	}
+}
+
+// removeClient closes the client's send channel and removes it from the hub
+func (h *WSHub) removeClient(userID string, idx int) {
+	client := h.clients[userID][idx]
+	h.clients[userID] = append(h.clients[userID][:idx], h.clients[userID][idx+1:]...)
+	atomic.AddInt64(&h.connections, -1)
+	close(client.send)
+
+	if len(h.clients[userID]) == 0 {
+		delete(h.clients, userID)
+		h.setOnline(userID, false)
+	}
+}
+
+// setOnline queues the presence change without blocking the hub. The broker may deliver the published
+// status change back to the hub, which would deadlock if the hub waited for runPresence.
+func (h *WSHub) setOnline(userID string, online bool) {
+	h.presenceMu.Lock()
+	h.pendingPresence[userID] = online
+	h.presenceMu.Unlock()
+
+	select {
+	case h.presenceChanged <- struct{}{}:
+	default:
+	}
+}
+
+// runPresence reports the latest presence of the changed users to the broker,
+// without blocking the hub on the broker's I/O
+func (h *WSHub) runPresence() {
+	for range h.presenceChanged {
+		h.presenceMu.Lock()
+		pending := h.pendingPresence
+		h.pendingPresence = make(map[string]bool)
+		h.presenceMu.Unlock()
+
+		for userID, online := range pending {
+			err := h.broker.SetPresence(userID, online)
+			if err != nil {
+				log.Printf("Failed to update presence of %s: %+v\n", userID, err)
+			}
+		}
+
+		// Status changes are not logged, clients reload the statuses after reconnecting
+		h.publish(&broker.BroadcastData{
+			BroadcastToAll: true,
+			Data:           []byte(`{"type":"` + WSTypeUserStatusChange + `"}`),
+		})
+	}
+}
+
+// listActiveUserIDs lists the users which are connected to any server node
+func (h *WSHub) listActiveUserIDs() []string {
+	result, err := h.broker.ListOnlineUserIDs()
+	if err != nil {
+		log.Printf("Failed to list online users: %+v\n", err)
+		return []string{}
+	}
 
 	return result
 }
 
-func (h *WSHub) broadcastData(userIDs []string, data interface{}) {
-	if data == nil {
-		log.Println("Data is nil")
+// countConnections returns the number of open connections on this node
+func (h *WSHub) countConnections() int {
+	return int(atomic.LoadInt64(&h.connections))
+}
+
+// disconnectUser closes the WebSocket connections of the given user on all server nodes
+func (h *WSHub) disconnectUser(userID string) {
+	h.publish(&broker.BroadcastData{
+		UserIDs:    []string{userID},
+		Disconnect: true,
+	})
+}
+
+// invalidateTokens drops the cached access tokens of the user, so revoked tokens are checked against
+// the store again. The cache of this node is cleared right away, the other nodes clear it when the
+// broker delivers the invalidation.
+func (h *WSHub) invalidateTokens(userID string) {
+	h.tokenCache.deleteByUserID(userID)
+
+	h.publish(&broker.BroadcastData{
+		UserIDs:          []string{userID},
+		InvalidateTokens: true,
+	})
+}
+
+// broadcastData sends the event to the given users. fullData is the variant of the event
+// with embedded entities, sent to the connections in the full payload mode.
+// If it is nil, all connections receive data.
+func (h *WSHub) broadcastData(userIDs []string, data, fullData interface{}) {
+	broadcastData, err := marshalBroadcastData(data, fullData)
+	if err != nil {
+		log.Printf("Failed to marshal the data: %+v\n", err)
 		return
 	}
 
-	bytes, err := json.Marshal(data)
+	broadcastData.UserIDs = userIDs
+	h.publishEvent(broadcastData)
+}
+
+func (h *WSHub) broadcastDataToAll(data, fullData interface{}) {
+	broadcastData, err := marshalBroadcastData(data, fullData)
 	if err != nil {
-		log.Println("Failed to marshal the data")
+		log.Printf("Failed to marshal the data: %+v\n", err)
 		return
 	}
 
-	broadcastData := &BroadcastData{
-		UserIDs: userIDs,
-		Data:    bytes,
+	broadcastData.BroadcastToAll = true
+	h.publishEvent(broadcastData)
+}
+
+// sendTransientData sends the event to the given users without storing it in the event log,
+// so it isn't replayed to clients which reconnect
+func (h *WSHub) sendTransientData(userIDs []string, data interface{}) {
+	broadcastData, err := marshalBroadcastData(data, nil)
+	if err != nil {
+		log.Printf("Failed to marshal the data: %+v\n", err)
+		return
 	}
 
-	h.broadcast <- broadcastData
+	broadcastData.UserIDs = userIDs
+	h.publish(broadcastData)
 }
 
-func (h *WSHub) broadcastDataToAll(data interface{}) {
+func marshalBroadcastData(data, fullData interface{}) (*broker.BroadcastData, error) {
 	if data == nil {
-		log.Println("Data is nil")
+		return nil, fmt.Errorf("Data is nil")
+	}
+
+	result := &broker.BroadcastData{}
+
+	var err error
+	result.Data, err = json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if fullData != nil {
+		result.FullData, err = json.Marshal(fullData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// publishEvent stores the event in the event log before publishing it, so it is
+// available for replay as soon as any client can receive it
+func (h *WSHub) publishEvent(data *broker.BroadcastData) {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+
+	event := model.Event{
+		Type:           eventType(data.Data),
+		BroadcastToAll: data.BroadcastToAll,
+		Data:           string(data.Data),
+		FullData:       string(data.FullData),
+	}
+
+	err := h.events.Create(&event, data.UserIDs)
+	if err != nil {
+		log.Printf("Failed to store event: %+v\n", err)
+		h.publish(data)
 		return
 	}
 
-	bytes, err := json.Marshal(data)
+	frame, err := eventFrame(event.Seq, data.Data)
 	if err != nil {
-		log.Println("Failed to marshal the data")
+		log.Printf("Failed to add sequence number to event: %+v\n", err)
+		h.publish(data)
 		return
 	}
 
-	broadcastData := &BroadcastData{
-		BroadcastToAll: true,
-		Data:    bytes,
+	data.Seq = event.Seq
+	data.Data = frame
+
+	if len(data.FullData) > 0 {
+		data.FullData, err = eventFrame(event.Seq, data.FullData)
+		if err != nil {
+			log.Printf("Failed to add sequence number to event: %+v\n", err)
+			data.FullData = nil
+		}
 	}
 
-	h.broadcast <- broadcastData
+	h.publish(data)
+}
+
+func (h *WSHub) publish(data *broker.BroadcastData) {
+	err := h.broker.Publish(data)
+	if err != nil {
+		log.Printf("Failed to publish broadcast data: %+v\n", err)
+	}
 }
 
 type WsClient struct {
@@ -191,7 +377,40 @@ type WsClient struct {
 	conn *websocket.Conn
 
 	// Buffered channel of outbound messages.
-	send chan []byte
+	send chan *wsFrame
+
+	// First event sent to the client, after it is registered in the hub
+	hello []byte
+
+	// Frame mode negotiated with the WebSocket subprotocol
+	frameMode string
+
+	// The client receives events with embedded entities
+	fullPayload bool
+
+	// The client resumes the event stream after the event with sequence number resumeSince
+	resume      bool
+	resumeSince int64
+
+	// Sequence numbers of the replayed events, their live copies are skipped
+	replayed map[int64]bool
+}
+
+// readPump handles the control frames of the peer. Clients are not expected to send messages.
+func (c *WsClient) readPump() {
+	defer c.conn.Close()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
 }
 
 func (c *WsClient) writePump() {
@@ -201,30 +420,45 @@ func (c *WsClient) writePump() {
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
+
+	if c.resume {
+		// The hub sends the hello event after the client is registered, so every event
+		// stored before that is replayed and every event stored after it is queued
+		frame, ok := <-c.send
+		if !ok {
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		}
+
+		if err := c.writeFrames([][]byte{frame.data}); err != nil {
+			return
+		}
+
+		if err := c.replayEvents(); err != nil {
+			log.Printf("Failed to replay events: %+v\n", err)
+			return
+		}
+	}
+
 	for {
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case frame, ok := <-c.send:
 			if !ok {
 				// The hub closed the channel.
+				c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued chat messages to the current websocket message.
+			// Send the queued events together, in batch mode they share a frame
+			frames := c.filterFrames(nil, frame)
 			n := len(c.send)
 			for i := 0; i < n; i++ {
-				w.Write(newline)
-				w.Write(<-c.send)
+				frames = c.filterFrames(frames, <-c.send)
 			}
 
-			if err := w.Close(); err != nil {
+			if err := c.writeFrames(frames); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -235,3 +469,53 @@ func (c *WsClient) writePump() {
 		}
 	}
 }
+
+// filterFrames appends the event unless the replay already sent it. The nodes publish their events
+// independently, so an event with a lower sequence number may arrive after a higher one and is still sent.
+func (c *WsClient) filterFrames(frames [][]byte, frame *wsFrame) [][]byte {
+	if frame == nil {
+		return frames
+	}
+
+	if c.replayed[frame.seq] {
+		delete(c.replayed, frame.seq)
+		return frames
+	}
+
+	return append(frames, frame.data)
+}
+
+// replayEvents sends the events missed since resumeSince. If the event log can't
+// fill the gap, the client is asked to reload its state instead.
+func (c *WsClient) replayEvents() error {
+	list, err := listEventsSince(c.hub.events, c.userID, c.resumeSince, maxReplayEvents, c.fullPayload)
+	if err != nil && err != errEventsExpired {
+		return err
+	}
+
+	if err == errEventsExpired || list.HasMore {
+		lastSeq, err := c.hub.events.LastSeq()
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(&WSResyncData{
+			Type: WSTypeResyncRequired,
+			Seq:  lastSeq,
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.writeFrames([][]byte{data})
+	}
+
+	frames := make([][]byte, len(list.Events))
+	c.replayed = make(map[int64]bool, len(list.Events))
+	for i := range list.Events {
+		frames[i] = list.Events[i]
+		c.replayed[list.seqs[i]] = true
+	}
+
+	return c.writeFrames(frames)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"./broker"
+)
+
+// startTestHubs runs hubs of two server nodes which share an in-process broker
+func startTestHubs() (*WSHub, *WSHub) {
+	bus := broker.NewMemoryBus()
+	tokenCache := newTokenCache(time.Hour)
+
+	hubA := newWsHub(bus.Connect("a"), nil, tokenCache, nil)
+	hubB := newWsHub(bus.Connect("b"), nil, tokenCache, nil)
+	go hubA.run()
+	go hubB.run()
+
+	return hubA, hubB
+}
+
+func connectTestClient(hub *WSHub, userID string) *WsClient {
+	client := &WsClient{
+		userID: userID,
+		hub:    hub,
+		send:   make(chan *wsFrame, 100),
+		hello:  []byte("hello"),
+	}
+	hub.register <- client
+
+	return client
+}
+
+// expectFrame waits for the frame with the given data, the other frames are skipped
+func expectFrame(t *testing.T, client *WsClient, data string) {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case frame, ok := <-client.send:
+			if !ok {
+				t.Fatalf("Client of %s was disconnected while waiting for %s", client.userID, data)
+			}
+			if string(frame.data) == data {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Client of %s didn't receive %s", client.userID, data)
+		}
+	}
+}
+
+func expectDisconnect(t *testing.T, client *WsClient) {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-client.send:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Client of %s wasn't disconnected", client.userID)
+		}
+	}
+}
+
+func TestWSHubBroadcastReachesAllNodes(t *testing.T) {
+	hubA, hubB := startTestHubs()
+
+	clientA := connectTestClient(hubA, "user1")
+	clientB := connectTestClient(hubB, "user2")
+	expectFrame(t, clientA, "hello")
+	expectFrame(t, clientB, "hello")
+
+	hubA.publish(&broker.BroadcastData{BroadcastToAll: true, Data: []byte("to all")})
+	expectFrame(t, clientA, "to all")
+	expectFrame(t, clientB, "to all")
+
+	hubA.sendTransientData([]string{"user2"}, map[string]string{"type": "to user2"})
+	expectFrame(t, clientB, `{"type":"to user2"}`)
+
+	hubB.disconnectUser("user1")
+	expectDisconnect(t, clientA)
+}
+
+func TestWSHubPresenceOfAllNodes(t *testing.T) {
+	hubA, hubB := startTestHubs()
+
+	clientA := connectTestClient(hubA, "user1")
+	clientB := connectTestClient(hubB, "user2")
+
+	// Presence changes on either node are announced to the clients of both nodes
+	statusChange := `{"type":"` + WSTypeUserStatusChange + `"}`
+	expectFrame(t, clientA, statusChange)
+	expectFrame(t, clientB, statusChange)
+
+	want := []string{"user1", "user2"}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		active := hubA.listActiveUserIDs()
+		if reflect.DeepEqual(active, want) && reflect.DeepEqual(hubB.listActiveUserIDs(), want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Active users are %v and %v, want %v", active, hubB.listActiveUserIDs(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	hubB.unregister <- clientB
+	deadline = time.Now().Add(2 * time.Second)
+	for !reflect.DeepEqual(hubA.listActiveUserIDs(), []string{"user1"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Active users are %v after user2 disconnected", hubA.listActiveUserIDs())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if hubA.countConnections() != 1 || hubB.countConnections() != 0 {
+		t.Errorf("Nodes count %d and %d connections, want 1 and 0", hubA.countConnections(), hubB.countConnections())
+	}
+}
+
+func TestWSHubEventsOfAllNodesOutOfOrder(t *testing.T) {
+	hubA, hubB := startTestHubs()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := hubB.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		client := &WsClient{
+			userID:    "user1",
+			hub:       hubB,
+			conn:      conn,
+			send:      make(chan *wsFrame, 100),
+			hello:     []byte("hello"),
+			frameMode: wsFrameModeSingle,
+			replayed:  map[int64]bool{12: true},
+		}
+		hubB.register <- client
+
+		go client.writePump()
+		go client.readPump()
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// read returns the next event, the presence changes are skipped
+	read := func() string {
+		for {
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("Failed to read the next event: %v", err)
+			}
+			if !strings.Contains(string(data), WSTypeUserStatusChange) {
+				return string(data)
+			}
+		}
+	}
+
+	if data := read(); data != "hello" {
+		t.Fatalf("First event is %s, want hello", data)
+	}
+
+	// Node b publishes the event 10 after node a published the event 11, and the replayed event 12 is skipped
+	for _, event := range []struct {
+		hub *WSHub
+		seq int64
+	}{{hubA, 11}, {hubB, 10}, {hubA, 12}, {hubB, 13}} {
+		event.hub.publish(&broker.BroadcastData{
+			UserIDs: []string{"user1"},
+			Seq:     event.seq,
+			Data:    []byte(fmt.Sprintf(`{"seq":%d}`, event.seq)),
+		})
+	}
+
+	for _, want := range []string{`{"seq":11}`, `{"seq":10}`, `{"seq":13}`} {
+		if data := read(); data != want {
+			t.Errorf("Client received %s, want %s", data, want)
+		}
+	}
+}
+
+func TestWSHubPresenceDoesNotBlockHub(t *testing.T) {
+	hub := newWsHub(broker.NewMemoryBroker(), nil, newTokenCache(time.Hour), nil)
+	go hub.run()
+
+	// Every user who comes online publishes a status change, which the in-process broker delivers
+	// back to the hub while it is still registering the next users
+	registered := make(chan struct{})
+	go func() {
+		for i := 0; i < 5000; i++ {
+			connectTestClient(hub, fmt.Sprintf("user%d", i))
+		}
+		close(registered)
+	}()
+
+	select {
+	case <-registered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Hub stopped registering clients while publishing the presence changes")
+	}
+
+	client := connectTestClient(hub, "last")
+	expectFrame(t, client, "hello")
+}
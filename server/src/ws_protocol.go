@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// serverVersion is reported to WebSocket clients. It is set at build time with
+// go build -ldflags "-X main.serverVersion=<version>"
+var serverVersion = "dev"
+
+// WebSocket subprotocols. Breaking changes of the event format must be served under a new name.
+const (
+	wsProtocolPrefix = "chatapp."
+
+	// Every frame is a single JSON event
+	wsProtocolJSON = "chatapp.v1.json"
+
+	// Every frame is a JSON array of one or more events
+	wsProtocolBatch = "chatapp.v1.batch"
+
+	// Not a real protocol, the value after it is the client's access token
+	wsProtocolAccessToken = "access_token"
+)
+
+// WebSocket frame modes
+const (
+	wsFrameModeSingle = "single"
+	wsFrameModeBatch  = "batch"
+)
+
+// Maximum number of events in a single frame of the batch mode
+const wsMaxBatchSize = 100
+
+const WSTypeHello = "hello"
+
+// WSHelloData is the first event sent over every WebSocket connection
+type WSHelloData struct {
+	Type          string `json:"type"`
+	ServerVersion string `json:"serverVersion"`
+	Protocol      string `json:"protocol"`
+	FrameMode     string `json:"frameMode"`
+	PayloadMode   string `json:"payloadMode"`
+
+	// The server sends pings with this interval in milliseconds and closes the
+	// connection if the client doesn't respond within pongWait
+	HeartbeatInterval int64 `json:"heartbeatInterval"`
+
+	Session WSSession `json:"session"`
+
+	// Sequence number of the newest event at the time of connecting.
+	// Clients which don't resume can use it as the starting point of the event stream.
+	LastSeq int64 `json:"lastSeq"`
+}
+
+type WSSession struct {
+	ConnectionID         string     `json:"connectionId"`
+	UserID               string     `json:"userId"`
+	AccessTokenExpiresAt *time.Time `json:"accessTokenExpiresAt"`
+}
+
+// negotiateWSProtocol selects the first versioned protocol offered by the client and reads the
+// access token which follows the access_token protocol. Clients which don't offer a versioned
+// protocol get the access_token protocol echoed back, if they offered it, and the single frame mode.
+func negotiateWSProtocol(offered []string) (protocol, frameMode, accessToken string, err error) {
+	unsupported := ""
+	for i, value := range offered {
+		if strings.HasPrefix(value, wsProtocolPrefix) && value != wsProtocolJSON && value != wsProtocolBatch {
+			unsupported = value
+		}
+
+		switch value {
+		case wsProtocolJSON:
+			if protocol == "" {
+				protocol, frameMode = wsProtocolJSON, wsFrameModeSingle
+			}
+		case wsProtocolBatch:
+			if protocol == "" {
+				protocol, frameMode = wsProtocolBatch, wsFrameModeBatch
+			}
+		case wsProtocolAccessToken:
+			if i+1 < len(offered) {
+				accessToken = offered[i+1]
+			}
+		}
+	}
+
+	if protocol == "" && unsupported != "" {
+		return "", "", "", fmt.Errorf("WebSocket protocol %s is not supported", unsupported)
+	}
+
+	if protocol == "" {
+		frameMode = wsFrameModeSingle
+		if accessToken != "" {
+			protocol = wsProtocolAccessToken
+		}
+	}
+
+	return protocol, frameMode, accessToken, nil
+}
+
+// writeFrames sends the events in the negotiated frame mode
+func (c *WsClient) writeFrames(frames [][]byte) error {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+	if c.frameMode == wsFrameModeBatch {
+		for len(frames) > 0 {
+			n := len(frames)
+			if n > wsMaxBatchSize {
+				n = wsMaxBatchSize
+			}
+
+			data := append([]byte{'['}, bytes.Join(frames[:n], []byte{','})...)
+			data = append(data, ']')
+
+			err := c.conn.WriteMessage(websocket.TextMessage, data)
+			if err != nil {
+				return err
+			}
+
+			frames = frames[n:]
+		}
+
+		return nil
+	}
+
+	for _, frame := range frames {
+		err := c.conn.WriteMessage(websocket.TextMessage, frame)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -127,7 +127,7 @@ export default class App extends React.Component {
 				currentUser: null,
 			});
 
-			this.wsClient.closeConnection();
+			this.wsClient.disconnect();
 		}
 	}
 
@@ -25,10 +25,18 @@ const styles = theme => ({
 		marginRight: 10,
 		alignSelf: 'flex-end',
 	},
+	body: {
+		display: 'flex',
+		flexDirection: 'column',
+		alignItems: 'flex-start',
+		maxWidth: '70%',
+	},
+	bodyReversed: {
+		alignItems: 'flex-end',
+	},
 	text: {
 		padding: '5px 10px',
 		borderRadius: 10,
-		maxWidth: '70%',
 		wordBreak: 'break-word',
 		backgroundColor: theme.palette.divider,
 	},
@@ -37,6 +45,51 @@ const styles = theme => ({
 		color: theme.palette.common.white,
 		// marginRight: 10,
 	},
+	html: {
+		'& p': {
+			margin: 0,
+		},
+		'& p + p, & pre': {
+			marginTop: 5,
+		},
+		'& pre': {
+			marginBottom: 0,
+			whiteSpace: 'pre-wrap',
+		},
+		'& a': {
+			color: 'inherit',
+		},
+	},
+	textAction: {
+		fontStyle: 'italic',
+	},
+	textEphemeral: {
+		fontStyle: 'italic',
+		whiteSpace: 'pre-wrap',
+		backgroundColor: 'transparent',
+		border: '1px dashed ' + theme.palette.divider,
+	},
+	preview: {
+		display: 'flex',
+		marginTop: 5,
+		padding: '5px 10px',
+		maxWidth: 400,
+		borderLeft: '3px solid ' + theme.palette.primary.main,
+		color: 'inherit',
+		textDecoration: 'none',
+		wordBreak: 'break-word',
+	},
+	previewText: {
+		flex: 1,
+		minWidth: 0,
+	},
+	previewImage: {
+		width: 64,
+		height: 64,
+		marginLeft: 10,
+		objectFit: 'cover',
+		borderRadius: 4,
+	},
 	time: {
 		padding: '5px',
 		alignSelf: 'center',
@@ -57,7 +110,19 @@ const styles = theme => ({
 class Message extends React.Component {
 	render() {
 		const {classes, message, hasAvatar, isCurrentUser, hasDateSeparator} = this.props;
-		const {message: text, userId, createdAt} = message;
+		const {message: text, html, previews, userId, createdAt, type} = message;
+
+		let textClassName = classes.text;
+		if (type === 'ephemeral') {
+			textClassName += ` ${classes.textEphemeral}`;
+		} else {
+			if (isCurrentUser) {
+				textClassName += ` ${classes.textCurrentUser}`;
+			}
+			if (type === 'action') {
+				textClassName += ` ${classes.textAction}`;
+			}
+		}
 
 		let time = dateformat(createdAt, 'HH:MM');
 		let daySeparatorText = dateformat(createdAt, 'mmmm dS, yyyy');
@@ -78,7 +143,36 @@ class Message extends React.Component {
 						:
 						<span className={classes.noAvatar} />
 					}
-					<Typography variant='body2' className={`${classes.text} ${isCurrentUser ? classes.textCurrentUser : ''}`}>{text}</Typography>
+					<div className={isCurrentUser ? `${classes.body} ${classes.bodyReversed}` : classes.body}>
+						{html ?
+							// the HTML is rendered and sanitized by the server
+							<Typography variant='body2' component='div' className={`${textClassName} ${classes.html}`} dangerouslySetInnerHTML={{__html: html}} />
+							:
+							<Typography variant='body2' className={textClassName}>{text}</Typography>
+						}
+						{previews && previews.map(preview => (
+							<a
+								key={preview.url}
+								href={preview.url}
+								target='_blank'
+								rel='noopener noreferrer nofollow'
+								className={classes.preview}
+							>
+								<div className={classes.previewText}>
+									{preview.siteName &&
+										<Typography variant='caption' color='textSecondary'>{preview.siteName}</Typography>
+									}
+									<Typography variant='subtitle2'>{preview.title}</Typography>
+									{preview.description &&
+										<Typography variant='caption'>{preview.description}</Typography>
+									}
+								</div>
+								{preview.imageUrl &&
+									<img src={preview.imageUrl} alt='' className={classes.previewImage} />
+								}
+							</a>
+						))}
+					</div>
 					<span className={classes.time}>{time}</span>
 				</div>
 			</div>
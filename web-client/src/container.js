@@ -5,7 +5,8 @@ import WsClient from './core/ws-client';
 
 // const API_HOST = 'localhost:3000';
 const API_HOST = `${window.location.hostname}:3000`;
-const API_URL = `http://${API_HOST}/`;
+const API_PATH = '/api/v1';
+const API_URL = `http://${API_HOST}${API_PATH}/`;
 const container = {};
 
 export default {
@@ -13,7 +14,7 @@ export default {
 		container['userClient'] = new UserClient(API_URL, handleUnauthorizedCallback);
 		container['chatClient'] = new ChatClient(API_URL, handleUnauthorizedCallback);
 		container['messageClient'] = new MessageClient(API_URL, handleUnauthorizedCallback);
-		container['wsClient'] = new WsClient(API_HOST);
+		container['wsClient'] = new WsClient(`${API_HOST}${API_PATH}`);
 	},
 	get(key) {
 		return container[key];
@@ -13,6 +13,10 @@ export default class ChatClient extends RestClient {
 		return this.doRequest('POST', 'chat', data, true);
 	}
 
+	getOrCreateDirect(userId) {
+		return this.doRequest('PUT', `dm/${userId}`, null, true);
+	}
+
 	update(chatId, data) {
 		return this.doRequest('POST', `chat/${chatId}`, data, true);
 	}
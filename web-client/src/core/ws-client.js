@@ -6,6 +6,9 @@ export default class WsClient {
 
 		this.connection = null;
 
+		// sequence number of the last received event, used to replay missed events after reconnect
+		this.lastSeq = null;
+
 		this.changeListenersMap = {
 			message: [],
 			user: [],
@@ -62,10 +65,16 @@ export default class WsClient {
 		}
 
 		if (msg) {
+			// events of different server nodes may arrive out of the order of their sequence numbers
+			if (msg.seq && (this.lastSeq === null || msg.seq > this.lastSeq)) {
+				this.lastSeq = msg.seq;
+			}
+
 			switch (msg.type) {
 				case 'message_create':
 				case 'message_update':
 				case 'message_delete':
+				case 'ephemeral':
 					for (let cb of this.changeListenersMap.message) {
 						cb(msg);
 					}
@@ -88,6 +97,18 @@ export default class WsClient {
 						cb(msg);
 					}
 
+					break;
+				case 'hello':
+					if (this.lastSeq === null) {
+						this.lastSeq = msg.lastSeq;
+					}
+
+					break;
+				case 'resync_required':
+					// missed events are no longer available, the current state has to be reloaded
+					this.lastSeq = null;
+					window.location.reload();
+
 					break;
 				default:
 					console.log('Unrecognized message type: ' + msg.type);
@@ -97,6 +118,8 @@ export default class WsClient {
 
 	handleClose(e) {
 		this.connection = null;
+
+		// lastSeq is kept, so the reconnected client resumes after the last received event
 		this.tryToReconnect();
 		console.log('WS connection is closed', e);
 	}
@@ -111,6 +134,22 @@ export default class WsClient {
 		}
 	}
 
+	requestTicket(accessToken) {
+		return fetch(`http://${this.cfg.host}/ws/ticket`, {
+			method: 'POST',
+			headers: {
+				'Authorization': `Bearer ${accessToken}`,
+			},
+		})
+			.then(response => {
+				if (!response.ok) {
+					return Promise.reject({message: 'Failed to get WS ticket', statusCode: response.status});
+				}
+
+				return response.json();
+			});
+	}
+
 	openConnection() {
 		if (this.connection) {
 			// maintain only one open connection
@@ -124,13 +163,36 @@ export default class WsClient {
 			return;
 		}
 
-		this.connection = new WebSocket(`ws://${this.cfg.host}/ws`, ['access_token', accessToken]);
+		// the connection is authenticated with a single-use ticket instead of the access token
+		this.requestTicket(accessToken)
+			.then(({ticket}) => {
+				// events embed the changed entities, so they don't have to be fetched separately
+				let url = `ws://${this.cfg.host}/ws?payload=full&ticket=${encodeURIComponent(ticket)}`;
+				if (this.lastSeq !== null) {
+					url += `&since=${this.lastSeq}`;
+				}
+
+				// every frame is a single JSON event
+				this.connection = new WebSocket(url, ['chatapp.v1.json']);
 
-		this.connection.onclose = this.handleClose;
-		this.connection.onmessage = this.handleMessage;
+				this.connection.onclose = this.handleClose;
+				this.connection.onmessage = this.handleMessage;
+			})
+			.catch(err => {
+				console.error(err);
+				this.tryToReconnect();
+			});
 	}
 
 	closeConnection() {
 		this.connection.close();
 	}
+
+	disconnect() {
+		// events of the logged out user are not resumed by the next user
+		this.lastSeq = null;
+		if (this.connection) {
+			this.closeConnection();
+		}
+	}
 }
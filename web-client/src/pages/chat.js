@@ -144,6 +144,11 @@ class Chat extends React.Component {
 	}
 
 	handleMessageChange(msg) {
+		if (msg && msg.type === 'ephemeral' && msg.chatId) {
+			this.addEphemeralMessage(msg.chatId, msg.text);
+			return;
+		}
+
 		if (!msg || !msg.type || !msg.messageId || !msg.chatId) {
 			return;
 		}
@@ -152,7 +157,11 @@ class Chat extends React.Component {
 			case 'message_create':
 			case 'message_update':
 
-				this.messageClient.get(msg.chatId, msg.messageId)
+				let messagePromise = msg.message
+					? Promise.resolve(msg.message)
+					: this.messageClient.get(msg.chatId, msg.messageId);
+
+				messagePromise
 					.then(message => {
 						if (!message) {
 							return;
@@ -308,12 +317,34 @@ class Chat extends React.Component {
 			.catch(err => {
 				console.error(err);
 
+				// errors of slash commands are shown only to the current user
+				if (message.startsWith('/') && err && err.message) {
+					this.addEphemeralMessage(currentChatId, err.message);
+				}
+
 				this.setState({
 					creatingMessage: false,
 				});
 			});
 	}
 
+	// addEphemeralMessage shows a response of a slash command, it is not stored and disappears on reload
+	addEphemeralMessage(chatId, text) {
+		let messagesMap = this.addNewMessageToMessageMap({
+			id: `ephemeral-${Date.now()}-${Math.random()}`,
+			chatId,
+			userId: null,
+			message: text,
+			type: 'ephemeral',
+			createdAt: new Date().toISOString(),
+		});
+		this.setState({messagesMap});
+
+		if (chatId === this.state.currentChatId) {
+			this.scrollToEnd();
+		}
+	}
+
 	addNewMessageToMessageMap(message) {
 		let chatMessages = this.state.messagesMap[message.chatId] || [];
 		let idx = chatMessages.findIndex(m => m.id === message.id);
@@ -367,40 +398,28 @@ class Chat extends React.Component {
 			return;
 		}
 
-		const {currentUser} = this.context;
-		let chat = this.state.chats.find(c => c.creatorId === userId || c.directUserId === userId);
-		if (chat) {
-			this.setState({
-				currentChatId: chat.id,
-				createChatDialogOpen: false,
-			});
-		} else {
-			this.setState({
-				createChatDialogOpen: false,
-				creatingChat: true,
-			});
+		this.setState({
+			createChatDialogOpen: false,
+			creatingChat: true,
+		});
 
-			this.chatClient.create({
-				creatorId: currentUser.id,
-				directUserId: userId,
+		this.chatClient.getOrCreateDirect(userId)
+			.then(chat => {
+				let chats = this.addOrReplaceById(this.state.chats, chat);
+				this.setState({
+					chats,
+					creatingChat: false,
+					currentChatId: chat.id,
+				});
 			})
-				.then(chat => {
-					let chats = this.addOrReplaceById(this.state.chats, chat);
-					this.setState({
-						chats,
-						creatingChat: false,
-						currentChatId: chat.id,
-					});
-				})
-				.catch(err => {
-					console.error(err);
+			.catch(err => {
+				console.error(err);
 
-					this.setState({
-						creatingChat: false,
-						currentChatId: null,
-					});
+				this.setState({
+					creatingChat: false,
+					currentChatId: null,
 				});
-		}
+			});
 	}
 
 	sortByCreatedAt(isAsc = true) {